@@ -3,12 +3,16 @@ package ast
 import (
 	"bytes"
 	"go-compiler/main/token"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	// Span returns the range of source text the node was parsed from.
+	Span() token.Span
 }
 
 type Statement interface {
@@ -33,6 +37,13 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Span() token.Span {
+	if len(p.Statements) == 0 {
+		return token.Span{}
+	}
+	return spanTo(p.Statements[0].Span(), p.Statements[len(p.Statements)-1])
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -45,12 +56,19 @@ type LetStatement struct {
 	Token *token.Token // token.Let
 	Name  *Identifier
 	Value Expression
+	Doc   string // the "///" comments before the statement, one per line
 }
 
 func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Lexeme
 }
+func (ls *LetStatement) Span() token.Span {
+	if ls.Value == nil {
+		return spanTo(ls.Token.Span(), ls.Name)
+	}
+	return spanTo(ls.Token.Span(), ls.Value)
+}
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
@@ -73,6 +91,9 @@ type AssignStatement struct {
 
 func (as *AssignStatement) expressionNode()      {}
 func (as *AssignStatement) TokenLiteral() string { return as.Token.Lexeme }
+func (as *AssignStatement) Span() token.Span {
+	return spanTo(as.Name.Span(), as.Value)
+}
 func (as *AssignStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("(" + as.Name.Value + " = " + as.Value.String() + ")")
@@ -88,10 +109,29 @@ func (i *Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Lexeme
 }
+func (i *Identifier) Span() token.Span { return i.Token.Span() }
 func (i *Identifier) String() string {
 	return i.Value
 }
 
+// IntegerLiteral is a number literal without a fraction or an exponent.
+type IntegerLiteral struct {
+	Token *token.Token // token.NUMBER
+	Value int64
+}
+
+func (i *IntegerLiteral) expressionNode() {}
+func (i *IntegerLiteral) TokenLiteral() string {
+	return i.Token.Lexeme
+}
+func (i *IntegerLiteral) Span() token.Span { return i.Token.Span() }
+
+// String returns the value in decimal, whatever base the source used.
+func (i *IntegerLiteral) String() string {
+	return strconv.FormatInt(i.Value, 10)
+}
+
+// NumberLiteral is a number literal with a fraction or an exponent.
 type NumberLiteral struct {
 	Token *token.Token // token.NUMBER
 	Value float64
@@ -101,8 +141,16 @@ func (i *NumberLiteral) expressionNode() {}
 func (i *NumberLiteral) TokenLiteral() string {
 	return i.Token.Lexeme
 }
+func (i *NumberLiteral) Span() token.Span { return i.Token.Span() }
+
+// String returns the shortest spelling that scans back to the same value.
+// It always has a fraction or an exponent, so it is not read as an integer.
 func (i *NumberLiteral) String() string {
-	return i.Token.Lexeme
+	out := strconv.FormatFloat(i.Value, 'g', -1, 64)
+	if !strings.ContainsAny(out, ".e") {
+		out += ".0"
+	}
+	return out
 }
 
 type StringLiteral struct {
@@ -114,6 +162,7 @@ func (i *StringLiteral) expressionNode() {}
 func (i *StringLiteral) TokenLiteral() string {
 	return i.Token.Lexeme
 }
+func (i *StringLiteral) Span() token.Span { return i.Token.Span() }
 func (i *StringLiteral) String() string {
 	return i.Token.Lexeme
 }
@@ -127,6 +176,9 @@ func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Lexeme
 }
+func (rs *ReturnStatement) Span() token.Span {
+	return spanTo(rs.Token.Span(), rs.ReturnValue)
+}
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(rs.TokenLiteral() + " ")
@@ -137,6 +189,27 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// BreakStatement ends the innermost loop around it.
+type BreakStatement struct {
+	Token *token.Token // token.BREAK
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Lexeme }
+func (bs *BreakStatement) Span() token.Span     { return bs.Token.Span() }
+func (bs *BreakStatement) String() string       { return "break;" }
+
+// ContinueStatement skips to the next iteration of the innermost loop
+// around it.
+type ContinueStatement struct {
+	Token *token.Token // token.CONTINUE
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Lexeme }
+func (cs *ContinueStatement) Span() token.Span     { return cs.Token.Span() }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+
 type ExpressionStatement struct {
 	Token      *token.Token // the first token of the expression
 	Expression Expression
@@ -146,6 +219,12 @@ func (es *ExpressionStatement) statementNode() {}
 func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Lexeme
 }
+func (es *ExpressionStatement) Span() token.Span {
+	if es.Expression == nil {
+		return es.Token.Span()
+	}
+	return es.Expression.Span()
+}
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -163,6 +242,9 @@ func (pe *PrefixExpression) expressionNode() {}
 func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Lexeme
 }
+func (pe *PrefixExpression) Span() token.Span {
+	return spanTo(pe.Token.Span(), pe.Right)
+}
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(" + pe.Operator + pe.Right.String() + ")")
@@ -181,6 +263,12 @@ func (ie *InfixExpression) expressionNode() {}
 func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Lexeme
 }
+func (ie *InfixExpression) Span() token.Span {
+	if ie.Left == nil {
+		return spanTo(ie.Token.Span(), ie.Right)
+	}
+	return spanTo(ie.Left.Span(), ie.Right)
+}
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(" + ie.Left.String() + " " + ie.Operator + " " + ie.Right.String() + ")")
@@ -188,6 +276,47 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// LogicalExpression is an and, an or, or a ??, which yields its left operand
+// unless that is null. It evaluates its right operand only if the left one
+// does not decide the result, and yields the operand that decided it.
+type LogicalExpression struct {
+	Token    *token.Token // token.AND, token.OR or token.QUESTION_QUESTION
+	Left     Expression
+	Operator string
+	Right    Expression
+}
+
+func (le *LogicalExpression) expressionNode() {}
+func (le *LogicalExpression) TokenLiteral() string {
+	return le.Token.Lexeme
+}
+func (le *LogicalExpression) Span() token.Span {
+	return spanTo(le.Left.Span(), le.Right)
+}
+func (le *LogicalExpression) String() string {
+	return "(" + le.Left.String() + " " + le.Operator + " " + le.Right.String() + ")"
+}
+
+// ConditionalExpression is cond ? then : else. Only the branch the condition
+// selects is evaluated.
+type ConditionalExpression struct {
+	Token     *token.Token // '?' token
+	Condition Expression
+	Then      Expression
+	Else      Expression
+}
+
+func (ce *ConditionalExpression) expressionNode() {}
+func (ce *ConditionalExpression) TokenLiteral() string {
+	return ce.Token.Lexeme
+}
+func (ce *ConditionalExpression) Span() token.Span {
+	return spanTo(ce.Condition.Span(), ce.Else)
+}
+func (ce *ConditionalExpression) String() string {
+	return "(" + ce.Condition.String() + " ? " + ce.Then.String() + " : " + ce.Else.String() + ")"
+}
+
 type Boolean struct {
 	Token *token.Token
 	Value bool
@@ -197,6 +326,7 @@ func (b *Boolean) expressionNode() {}
 func (b *Boolean) TokenLiteral() string {
 	return b.Token.Lexeme
 }
+func (b *Boolean) Span() token.Span { return b.Token.Span() }
 func (b *Boolean) String() string {
 	return b.Token.Lexeme
 }
@@ -212,6 +342,15 @@ func (ie *IfExpression) expressionNode() {}
 func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Lexeme
 }
+func (ie *IfExpression) Span() token.Span {
+	switch {
+	case ie.Else != nil:
+		return ie.Token.Span().To(ie.Else.Span())
+	case ie.Then != nil:
+		return ie.Token.Span().To(ie.Then.Span())
+	}
+	return spanTo(ie.Token.Span(), ie.Condition)
+}
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if" + ie.Condition.String() + " " + ie.Then.String())
@@ -231,19 +370,92 @@ func (we *WhileExpression) expressionNode() {}
 func (we *WhileExpression) TokenLiteral() string {
 	return we.Token.Lexeme
 }
+func (we *WhileExpression) Span() token.Span {
+	if we.Body != nil {
+		return we.Token.Span().To(we.Body.Span())
+	}
+	return spanTo(we.Token.Span(), we.Condition)
+}
 func (we *WhileExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("while" + we.Condition.String() + " " + we.Body.String())
 	return we.Token.Lexeme
 }
 
+// ForExpression is a C-style loop: for (init; condition; update) { body }.
+// Each clause may be left out; without a condition the loop only ends by
+// returning. Variables the loop declares are scoped to it, and every
+// iteration gets its own copy of them.
+type ForExpression struct {
+	Token     *token.Token // for token
+	Init      Statement    // nil if absent
+	Condition Expression   // nil if absent
+	Update    Expression   // nil if absent
+	Body      *BlockStatment
+}
+
+func (fe *ForExpression) expressionNode() {}
+func (fe *ForExpression) TokenLiteral() string {
+	return fe.Token.Lexeme
+}
+func (fe *ForExpression) Span() token.Span {
+	if fe.Body != nil {
+		return fe.Token.Span().To(fe.Body.Span())
+	}
+	return fe.Token.Span()
+}
+func (fe *ForExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("for (")
+	if fe.Init != nil {
+		out.WriteString(strings.TrimSuffix(fe.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fe.Condition != nil {
+		out.WriteString(fe.Condition.String())
+	}
+	out.WriteString("; ")
+	if fe.Update != nil {
+		out.WriteString(fe.Update.String())
+	}
+	out.WriteString(") " + fe.Body.String())
+	return out.String()
+}
+
+// ForInExpression runs its body once for each element of an array, each
+// character of a string or each key of a hash: for (name in iterable) { }.
+type ForInExpression struct {
+	Token    *token.Token // for token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatment
+}
+
+func (fe *ForInExpression) expressionNode() {}
+func (fe *ForInExpression) TokenLiteral() string {
+	return fe.Token.Lexeme
+}
+func (fe *ForInExpression) Span() token.Span {
+	if fe.Body != nil {
+		return fe.Token.Span().To(fe.Body.Span())
+	}
+	return spanTo(fe.Token.Span(), fe.Iterable)
+}
+func (fe *ForInExpression) String() string {
+	return "for (" + fe.Variable.String() + " in " + fe.Iterable.String() + ") " + fe.Body.String()
+}
+
 type BlockStatment struct {
 	Token      token.Token // { token
 	Statements []Statement
+	EndToken   *token.Token // } token
 }
 
 func (bs *BlockStatment) statementNode()       {}
 func (bs *BlockStatment) TokenLiteral() string { return bs.Token.Lexeme }
+func (bs *BlockStatment) Span() token.Span {
+	return spanEnd(bs.Token.Span(), bs.EndToken)
+}
 func (bs *BlockStatment) String() string {
 	var out bytes.Buffer
 	for _, s := range bs.Statements {
@@ -263,6 +475,12 @@ func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Lexeme
 }
+func (fl *FunctionLiteral) Span() token.Span {
+	if fl.Body != nil {
+		return fl.Token.Span().To(fl.Body.Span())
+	}
+	return fl.Token.Span()
+}
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := []string{}
@@ -277,12 +495,16 @@ type CallExpression struct {
 	Token     *token.Token // '(' Token
 	Function  Expression
 	Arguments []Expression // Identifier or FunctionLiteral
+	EndToken  *token.Token // ')' Token
 }
 
 func (ce *CallExpression) expressionNode() {}
 func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Lexeme
 }
+func (ce *CallExpression) Span() token.Span {
+	return spanEnd(ce.Function.Span(), ce.EndToken)
+}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	args := []string{}
@@ -296,10 +518,12 @@ func (ce *CallExpression) String() string {
 type ArrayLiteral struct {
 	Token    token.Token // '[' Token
 	Elements []Expression
+	EndToken *token.Token // ']' Token
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Lexeme }
+func (al *ArrayLiteral) Span() token.Span     { return spanEnd(al.Token.Span(), al.EndToken) }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -313,34 +537,246 @@ func (al *ArrayLiteral) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token    token.Token // '[' Token
+	Left     Expression
+	Index    Expression
+	EndToken *token.Token // ']' Token
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Lexeme }
+func (ie *IndexExpression) Span() token.Span     { return spanEnd(ie.Left.Span(), ie.EndToken) }
+
+// Optional reports whether this is an optional index, a?[i], which is null
+// without evaluating the index when a is null.
+func (ie *IndexExpression) Optional() bool { return ie.Token.Type == token.QUESTION_BRACKET }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
-	out.WriteString("(" + ie.Left.String() + "[" + ie.Index.String() + "])")
+	out.WriteString("(" + ie.Left.String() + ie.Token.Lexeme + ie.Index.String() + "])")
 
 	return out.String()
 }
 
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token    token.Token // '{' Token
+	Pairs    map[Expression]Expression
+	EndToken *token.Token // '}' Token
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Lexeme }
+func (hl *HashLiteral) Span() token.Span     { return spanEnd(hl.Token.Span(), hl.EndToken) }
+
+// SortedKeys returns the keys of the hash literal in source order.
+func (hl *HashLiteral) SortedKeys() []Expression {
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Span().Start.Offset < keys[j].Span().Start.Offset
+	})
+	return keys
+}
+
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.SortedKeys() {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 	out.WriteString("{" + strings.Join(pairs, ", ") + "}")
 	return out.String()
 }
+
+// StructStatement declares a struct type with its fields, each with an
+// optional default value, and its methods. A struct with a superclass
+// inherits the superclass's fields and methods.
+type StructStatement struct {
+	Token      *token.Token // token.STRUCT
+	Name       *Identifier
+	Superclass *Identifier // nil if the struct does not inherit
+	Fields     []*StructField
+	Methods    []*Method
+	EndToken   *token.Token // '}' token
+	Doc        string       // the "///" comments before the struct, one per line
+}
+
+// StructField is a field declared in a struct. Value is nil if the field has
+// no default.
+type StructField struct {
+	Name  *Identifier
+	Value Expression
+}
+
+// Method is a function declared in a struct, called on its instances.
+type Method struct {
+	Name     *Identifier
+	Function *FunctionLiteral
+	Doc      string // the "///" comments before the method, one per line
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Lexeme }
+func (ss *StructStatement) Span() token.Span     { return spanEnd(ss.Token.Span(), ss.EndToken) }
+func (ss *StructStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ss.TokenLiteral() + " " + ss.Name.String())
+	if ss.Superclass != nil {
+		out.WriteString(" < " + ss.Superclass.String())
+	}
+	out.WriteString(" { ")
+	for _, f := range ss.Fields {
+		out.WriteString(f.Name.String())
+		if f.Value != nil {
+			out.WriteString(" = " + f.Value.String())
+		}
+		out.WriteString("; ")
+	}
+	for _, m := range ss.Methods {
+		params := []string{}
+		for _, p := range m.Function.Parameters {
+			params = append(params, p.String())
+		}
+		out.WriteString(m.Function.TokenLiteral() + " " + m.Name.String() +
+			"(" + strings.Join(params, ",") + ")" + m.Function.Body.String() + " ")
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+type ThisExpression struct {
+	Token *token.Token // token.THIS
+}
+
+func (te *ThisExpression) expressionNode()      {}
+func (te *ThisExpression) TokenLiteral() string { return te.Token.Lexeme }
+func (te *ThisExpression) Span() token.Span     { return te.Token.Span() }
+func (te *ThisExpression) String() string       { return te.Token.Lexeme }
+
+// SuperExpression looks up a method of the superclass of the struct whose
+// method it is in, bound to this: super.name.
+type SuperExpression struct {
+	Token  *token.Token // token.SUPER
+	Method *Identifier
+}
+
+func (se *SuperExpression) expressionNode()      {}
+func (se *SuperExpression) TokenLiteral() string { return se.Token.Lexeme }
+func (se *SuperExpression) Span() token.Span     { return spanTo(se.Token.Span(), se.Method) }
+func (se *SuperExpression) String() string       { return "super." + se.Method.String() }
+
+// PropertyExpression reads a field or method of an instance: object.name.
+type PropertyExpression struct {
+	Token  *token.Token // '.' token
+	Object Expression
+	Name   *Identifier
+}
+
+func (pe *PropertyExpression) expressionNode()      {}
+func (pe *PropertyExpression) TokenLiteral() string { return pe.Token.Lexeme }
+func (pe *PropertyExpression) Span() token.Span {
+	if pe.Name == nil {
+		return spanEnd(pe.Object.Span(), pe.Token)
+	}
+	return pe.Object.Span().To(pe.Name.Span())
+}
+func (pe *PropertyExpression) String() string {
+	return "(" + pe.Object.String() + "." + pe.Name.String() + ")"
+}
+
+// PropertyAssignment sets a field of an instance: object.name = value.
+type PropertyAssignment struct {
+	Token  *token.Token // '=' token
+	Target *PropertyExpression
+	Value  Expression
+}
+
+func (pa *PropertyAssignment) expressionNode()      {}
+func (pa *PropertyAssignment) TokenLiteral() string { return pa.Token.Lexeme }
+func (pa *PropertyAssignment) Span() token.Span {
+	return spanTo(pa.Target.Span(), pa.Value)
+}
+func (pa *PropertyAssignment) String() string {
+	return "(" + pa.Target.String() + " = " + pa.Value.String() + ")"
+}
+
+// IndexAssignment sets an element of an array or the value of a key in a
+// hash: target[index] = value. Its value is the value assigned.
+type IndexAssignment struct {
+	Token  *token.Token // '=' token
+	Target *IndexExpression
+	Value  Expression
+}
+
+func (ia *IndexAssignment) expressionNode()      {}
+func (ia *IndexAssignment) TokenLiteral() string { return ia.Token.Lexeme }
+func (ia *IndexAssignment) Span() token.Span {
+	return spanTo(ia.Target.Span(), ia.Value)
+}
+func (ia *IndexAssignment) String() string {
+	return "(" + ia.Target.String() + " = " + ia.Value.String() + ")"
+}
+
+// CompoundAssignment applies a binary operator to its target and value and
+// assigns the result to the target: target op= value. The target is an
+// identifier, an index expression or a property, and is evaluated once.
+type CompoundAssignment struct {
+	Token    *token.Token // the op= token
+	Target   Expression
+	Operator string // the binary operator, without the '='
+	Value    Expression
+}
+
+func (ca *CompoundAssignment) expressionNode()      {}
+func (ca *CompoundAssignment) TokenLiteral() string { return ca.Token.Lexeme }
+func (ca *CompoundAssignment) Span() token.Span {
+	return spanTo(ca.Target.Span(), ca.Value)
+}
+func (ca *CompoundAssignment) String() string {
+	return "(" + ca.Target.String() + " " + ca.Operator + "= " + ca.Value.String() + ")"
+}
+
+// UpdateExpression adds or subtracts one from its target, which is
+// assignable as in CompoundAssignment. A prefix update evaluates to the new
+// value, a postfix one to the old value.
+type UpdateExpression struct {
+	Token    *token.Token // ++ or --
+	Operator string
+	Target   Expression
+	Prefix   bool
+}
+
+func (ue *UpdateExpression) expressionNode()      {}
+func (ue *UpdateExpression) TokenLiteral() string { return ue.Token.Lexeme }
+func (ue *UpdateExpression) Span() token.Span {
+	if ue.Prefix {
+		return spanTo(ue.Token.Span(), ue.Target)
+	}
+	return ue.Target.Span().To(ue.Token.Span())
+}
+func (ue *UpdateExpression) String() string {
+	if ue.Prefix {
+		return "(" + ue.Operator + ue.Target.String() + ")"
+	}
+	return "(" + ue.Target.String() + ue.Operator + ")"
+}
+
+// spanTo returns the span running from start to the end of node, or start
+// alone if node is missing because of a parse error.
+func spanTo(start token.Span, node Node) token.Span {
+	if node == nil {
+		return start
+	}
+	return start.To(node.Span())
+}
+
+// spanEnd returns the span running from start to the end of the closing
+// token end, or start alone if the closing token was never parsed.
+func spanEnd(start token.Span, end *token.Token) token.Span {
+	if end == nil {
+		return start
+	}
+	return start.To(end.Span())
+}
@@ -19,3 +19,34 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestDump(t *testing.T) {
+	at := func(col int) token.Position { return token.Position{Line: 1, Column: col} }
+	ident := func(name string, col int) *Identifier {
+		return &Identifier{Token: &token.Token{Type: token.IDENTIFIER, Lexeme: name, Start: at(col)}, Value: name}
+	}
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: &token.Token{Type: token.LET, Lexeme: "let", Start: at(1)},
+				Name:  ident("x", 5),
+				Value: &InfixExpression{
+					Token:    &token.Token{Type: token.PLUS, Lexeme: "+", Start: at(11)},
+					Left:     ident("a", 9),
+					Operator: "+",
+					Right:    ident("b", 13),
+				},
+			},
+		},
+	}
+
+	expected := `Program
+  LetStatement x (1:1)
+    InfixExpression + (1:9)
+      Identifier a (1:9)
+      Identifier b (1:13)
+`
+	if Dump(program) != expected {
+		t.Errorf("Dump wrong.\nwant=%q\ngot =%q", expected, Dump(program))
+	}
+}
@@ -0,0 +1,201 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Dump renders node and its children as an indented tree, one node per line
+// with the position it starts at, for inspecting what the parser produced.
+func Dump(node Node) string {
+	var out bytes.Buffer
+	dump(&out, node, 0)
+	return out.String()
+}
+
+func dump(out *bytes.Buffer, node Node, depth int) {
+	indent := strings.Repeat("  ", depth)
+	line := func(label string) {
+		start := node.Span().Start
+		fmt.Fprintf(out, "%s%s (%d:%d)\n", indent, label, start.Line, start.Column)
+	}
+	group := func(label string) {
+		fmt.Fprintf(out, "%s  %s\n", indent, label)
+	}
+	doc := func(prefix, text string) {
+		if text != "" {
+			fmt.Fprintf(out, "%s%sDoc %q\n", indent, prefix, text)
+		}
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		fmt.Fprintf(out, "%sProgram\n", indent)
+		for _, s := range node.Statements {
+			dump(out, s, depth+1)
+		}
+	case *LetStatement:
+		line("LetStatement " + node.Name.Value)
+		doc("  ", node.Doc)
+		dump(out, node.Value, depth+1)
+	case *AssignStatement:
+		line("AssignStatement " + node.Name.Value)
+		dump(out, node.Value, depth+1)
+	case *ReturnStatement:
+		line("ReturnStatement")
+		dump(out, node.ReturnValue, depth+1)
+	case *BreakStatement:
+		line("BreakStatement")
+	case *ContinueStatement:
+		line("ContinueStatement")
+	case *ExpressionStatement:
+		line("ExpressionStatement")
+		dump(out, node.Expression, depth+1)
+	case *BlockStatment:
+		line("BlockStatement")
+		for _, s := range node.Statements {
+			dump(out, s, depth+1)
+		}
+	case *Identifier:
+		line("Identifier " + node.Value)
+	case *IntegerLiteral:
+		line("IntegerLiteral " + node.String())
+	case *NumberLiteral:
+		line("NumberLiteral " + node.String())
+	case *StringLiteral:
+		line(fmt.Sprintf("StringLiteral %q", node.Value))
+	case *Boolean:
+		line(fmt.Sprintf("Boolean %t", node.Value))
+	case *PrefixExpression:
+		line("PrefixExpression " + node.Operator)
+		dump(out, node.Right, depth+1)
+	case *InfixExpression:
+		line("InfixExpression " + node.Operator)
+		dump(out, node.Left, depth+1)
+		dump(out, node.Right, depth+1)
+	case *LogicalExpression:
+		line("LogicalExpression " + node.Operator)
+		dump(out, node.Left, depth+1)
+		dump(out, node.Right, depth+1)
+	case *ConditionalExpression:
+		line("ConditionalExpression")
+		dump(out, node.Condition, depth+1)
+		dump(out, node.Then, depth+1)
+		dump(out, node.Else, depth+1)
+	case *IfExpression:
+		line("IfExpression")
+		dump(out, node.Condition, depth+1)
+		dump(out, node.Then, depth+1)
+		if node.Else != nil {
+			group("Else")
+			dump(out, node.Else, depth+2)
+		}
+	case *WhileExpression:
+		line("WhileExpression")
+		dump(out, node.Condition, depth+1)
+		dump(out, node.Body, depth+1)
+	case *ForExpression:
+		line("ForExpression")
+		if node.Init != nil {
+			group("Init")
+			dump(out, node.Init, depth+2)
+		}
+		if node.Condition != nil {
+			group("Condition")
+			dump(out, node.Condition, depth+2)
+		}
+		if node.Update != nil {
+			group("Update")
+			dump(out, node.Update, depth+2)
+		}
+		dump(out, node.Body, depth+1)
+	case *ForInExpression:
+		line("ForInExpression " + node.Variable.Value)
+		dump(out, node.Iterable, depth+1)
+		dump(out, node.Body, depth+1)
+	case *FunctionLiteral:
+		params := []string{}
+		for _, p := range node.Parameters {
+			params = append(params, p.Value)
+		}
+		line("FunctionLiteral (" + strings.Join(params, ", ") + ")")
+		dump(out, node.Body, depth+1)
+	case *CallExpression:
+		line("CallExpression")
+		dump(out, node.Function, depth+1)
+		if len(node.Arguments) > 0 {
+			group("Arguments")
+			for _, arg := range node.Arguments {
+				dump(out, arg, depth+2)
+			}
+		}
+	case *ArrayLiteral:
+		line("ArrayLiteral")
+		for _, el := range node.Elements {
+			dump(out, el, depth+1)
+		}
+	case *IndexExpression:
+		if node.Optional() {
+			line("IndexExpression optional")
+		} else {
+			line("IndexExpression")
+		}
+		dump(out, node.Left, depth+1)
+		dump(out, node.Index, depth+1)
+	case *HashLiteral:
+		line("HashLiteral")
+		for _, key := range node.SortedKeys() {
+			group("Pair")
+			dump(out, key, depth+2)
+			dump(out, node.Pairs[key], depth+2)
+		}
+	case *StructStatement:
+		label := "StructStatement " + node.Name.Value
+		if node.Superclass != nil {
+			label += " < " + node.Superclass.Value
+		}
+		line(label)
+		doc("  ", node.Doc)
+		for _, f := range node.Fields {
+			group("Field " + f.Name.Value)
+			if f.Value != nil {
+				dump(out, f.Value, depth+2)
+			}
+		}
+		for _, m := range node.Methods {
+			group("Method " + m.Name.Value)
+			doc("    ", m.Doc)
+			dump(out, m.Function, depth+2)
+		}
+	case *ThisExpression:
+		line("ThisExpression")
+	case *SuperExpression:
+		line("SuperExpression " + node.Method.Value)
+	case *PropertyExpression:
+		line("PropertyExpression " + node.Name.Value)
+		dump(out, node.Object, depth+1)
+	case *PropertyAssignment:
+		line("PropertyAssignment " + node.Target.Name.Value)
+		dump(out, node.Target.Object, depth+1)
+		dump(out, node.Value, depth+1)
+	case *CompoundAssignment:
+		line("CompoundAssignment " + node.Operator + "=")
+		dump(out, node.Target, depth+1)
+		dump(out, node.Value, depth+1)
+	case *UpdateExpression:
+		if node.Prefix {
+			line("UpdateExpression " + node.Operator + " prefix")
+		} else {
+			line("UpdateExpression " + node.Operator + " postfix")
+		}
+		dump(out, node.Target, depth+1)
+	case *IndexAssignment:
+		line("IndexAssignment")
+		dump(out, node.Target.Left, depth+1)
+		dump(out, node.Target.Index, depth+1)
+		dump(out, node.Value, depth+1)
+	default:
+		fmt.Fprintf(out, "%s%T\n", indent, node)
+	}
+}
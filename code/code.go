@@ -0,0 +1,309 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"go-compiler/main/token"
+	"sort"
+)
+
+// Instructions is a sequence of encoded instructions: an opcode byte
+// followed by its big-endian operands.
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		i += 1 + read
+	}
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), len(def.OperandWidths))
+	}
+
+	switch len(operands) {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+	return fmt.Sprintf("ERROR: unhandled operand count for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	OpDup
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpIntDiv
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpMinus
+	OpBang
+	OpBitNot
+	OpIncrement
+	OpDecrement
+
+	OpJump
+	OpJumpNotTruthy
+	OpJumpFalsy
+	OpJumpTruthy
+	OpJumpNull
+	OpJumpNotNull
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetUpvalue
+	OpSetUpvalue
+
+	OpArray
+	OpHash
+	OpIndex
+	OpSetIndex
+
+	OpClosure
+	OpCall
+	OpReturnValue
+	OpReturn
+
+	OpStruct
+	OpMethod
+	OpInherit
+	OpGetProperty
+	OpSetProperty
+	OpGetSuper
+
+	OpCloseUpvalues
+	OpIterator
+	OpIterNext
+	OpEnterLoop
+	OpLeaveLoop
+	OpLoopJump
+)
+
+// Definition describes an opcode: its name for disassembly and the width in
+// bytes of each of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{1}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	OpNull:     {"OpNull", []int{}},
+
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:         {"OpDiv", []int{}},
+	OpMod:         {"OpMod", []int{}},
+	OpIntDiv:      {"OpIntDiv", []int{}},
+	OpPow:         {"OpPow", []int{}},
+	OpBitAnd:      {"OpBitAnd", []int{}},
+	OpBitOr:       {"OpBitOr", []int{}},
+	OpBitXor:      {"OpBitXor", []int{}},
+	OpShiftLeft:   {"OpShiftLeft", []int{}},
+	OpShiftRight:  {"OpShiftRight", []int{}},
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+	OpMinus:       {"OpMinus", []int{}},
+	OpBang:        {"OpBang", []int{}},
+	OpBitNot:      {"OpBitNot", []int{}},
+	OpIncrement:   {"OpIncrement", []int{}},
+	OpDecrement:   {"OpDecrement", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJumpFalsy:     {"OpJumpFalsy", []int{2}},
+	OpJumpTruthy:    {"OpJumpTruthy", []int{2}},
+	OpJumpNull:      {"OpJumpNull", []int{2}},
+	OpJumpNotNull:   {"OpJumpNotNull", []int{2}},
+
+	OpGetGlobal:  {"OpGetGlobal", []int{2}},
+	OpSetGlobal:  {"OpSetGlobal", []int{2}},
+	OpGetLocal:   {"OpGetLocal", []int{1}},
+	OpSetLocal:   {"OpSetLocal", []int{1}},
+	OpGetUpvalue: {"OpGetUpvalue", []int{1}},
+	OpSetUpvalue: {"OpSetUpvalue", []int{1}},
+
+	OpArray:    {"OpArray", []int{2}},
+	OpHash:     {"OpHash", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{}},
+
+	OpClosure:     {"OpClosure", []int{2}},
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpStruct:      {"OpStruct", []int{2}},
+	OpMethod:      {"OpMethod", []int{2}},
+	OpInherit:     {"OpInherit", []int{}},
+	OpGetProperty: {"OpGetProperty", []int{2}},
+	OpSetProperty: {"OpSetProperty", []int{2}},
+	OpGetSuper:    {"OpGetSuper", []int{2}},
+
+	OpCloseUpvalues: {"OpCloseUpvalues", []int{1}},
+	OpIterator:      {"OpIterator", []int{}},
+	OpIterNext:      {"OpIterNext", []int{2}},
+	OpEnterLoop:     {"OpEnterLoop", []int{}},
+	OpLeaveLoop:     {"OpLeaveLoop", []int{}},
+	OpLoopJump:      {"OpLoopJump", []int{2}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes op and its operands as a single instruction. It returns an
+// empty instruction for an unknown opcode. Operands out of range for their
+// width are truncated; check them with OperandsFit.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+	return instruction
+}
+
+// OperandsFit reports whether each operand of op is in range for its
+// width, so Make can encode it without truncating it.
+func OperandsFit(op Opcode, operands ...int) bool {
+	def, ok := definitions[op]
+	if !ok {
+		return false
+	}
+	for i, o := range operands {
+		if o < 0 || o >= 1<<(8*def.OperandWidths[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadOperands decodes the operands of an instruction described by def from
+// ins, returning them along with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// SpanTable maps instruction offsets back to the source they were compiled
+// from, so runtime errors can point at the failing expression. Each entry
+// covers the instructions from its offset up to the next entry's.
+type SpanTable []SpanEntry
+
+type SpanEntry struct {
+	Offset int
+	Span   token.Span
+}
+
+// Add records that the instructions from offset on came from span.
+func (t SpanTable) Add(offset int, span token.Span) SpanTable {
+	if n := len(t); n > 0 {
+		if t[n-1].Span == span {
+			return t
+		}
+		if t[n-1].Offset == offset {
+			t[n-1].Span = span
+			return t
+		}
+	}
+	return append(t, SpanEntry{Offset: offset, Span: span})
+}
+
+// Lookup returns the span of the instruction at offset.
+func (t SpanTable) Lookup(offset int) token.Span {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 {
+		return token.Span{}
+	}
+	return t[i-1].Span
+}
@@ -0,0 +1,133 @@
+package code
+
+import (
+	"go-compiler/main/token"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534}, []byte{byte(OpClosure), 255, 254}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		if len(instruction) != len(tt.expected) {
+			t.Errorf("instruction has wrong length. want=%d, got=%d",
+				len(tt.expected), len(instruction))
+		}
+		for i, b := range tt.expected {
+			if instruction[i] != tt.expected[i] {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestOperandsFit(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected bool
+	}{
+		{OpConstant, []int{65535}, true},
+		{OpConstant, []int{65536}, false},
+		{OpJump, []int{-1}, false},
+		{OpGetLocal, []int{255}, true},
+		{OpGetLocal, []int{256}, false},
+		{OpAdd, []int{}, true},
+	}
+
+	for _, tt := range tests {
+		if got := OperandsFit(tt.op, tt.operands...); got != tt.expected {
+			t.Errorf("OperandsFit(%d, %v) wrong. want=%t, got=%t", tt.op, tt.operands, tt.expected, got)
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpClosure, 65535),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestSpanTable(t *testing.T) {
+	line := func(l int) token.Span {
+		return token.Span{Start: token.Position{Line: l}, End: token.Position{Line: l}}
+	}
+	var table SpanTable
+	table = table.Add(0, line(1))
+	table = table.Add(3, line(1))
+	table = table.Add(4, line(2))
+	table = table.Add(7, line(3))
+
+	if len(table) != 3 {
+		t.Fatalf("equal spans were not merged. got=%v", table)
+	}
+	tests := []struct {
+		offset int
+		line   int
+	}{
+		{0, 1}, {3, 1}, {4, 2}, {6, 2}, {7, 3}, {100, 3},
+	}
+	for _, tt := range tests {
+		if got := table.Lookup(tt.offset).Start.Line; got != tt.line {
+			t.Errorf("Lookup(%d) wrong line. want=%d, got=%d", tt.offset, tt.line, got)
+		}
+	}
+}
@@ -0,0 +1,954 @@
+package compiler
+
+import (
+	"go-compiler/main/ast"
+	"go-compiler/main/code"
+	"go-compiler/main/errors"
+	"go-compiler/main/object"
+	"go-compiler/main/token"
+)
+
+const (
+	maxConstants = 1<<16 - 1
+	maxGlobals   = 1<<16 - 1
+	maxLocals    = 1<<8 - 1
+	maxElements  = 1<<16 - 1
+)
+
+// Bytecode is a compiled program: the instructions of its top level and the
+// constants they refer to.
+type Bytecode struct {
+	Instructions code.Instructions
+	Spans        code.SpanTable
+	Constants    []object.Object
+	Globals      []string // names of the global slots, for lookups of builtins
+	NumLocals    int      // local slots of the blocks in the program's loops
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions being emitted for one function.
+type CompilationScope struct {
+	instructions        code.Instructions
+	spans               code.SpanTable
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	loops               []*loop // loops being compiled in the function, innermost last
+}
+
+// loop tracks the break and continue statements of a loop being compiled.
+// Their jumps go forward to places not emitted yet, so they are patched
+// once the loop knows where they land.
+type loop struct {
+	continueTarget int // -1 until it is known
+	breaks         []int
+	continues      []int
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+	scopes      []CompilationScope
+	scopeIndex  int
+	span        token.Span // span of the node being compiled
+	// operandError reports the first operand emitted that did not fit in
+	// its instruction, such as a jump over too much code. Compile returns
+	// it once the node being compiled is done.
+	operandError error
+}
+
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// NewWithState returns a compiler that continues from the globals and
+// constants of an earlier compilation, so a REPL can compile each line on its
+// own.
+func NewWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"~/": code.OpIntDiv,
+	"**": code.OpPow,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+}
+
+var prefixOperators = map[string]code.Opcode{
+	"-": code.OpMinus,
+	"!": code.OpBang,
+	"~": code.OpBitNot,
+}
+
+func (c *Compiler) Compile(node ast.Node) (err error) {
+	previous := c.span
+	c.span = node.Span()
+	defer func() {
+		c.span = previous
+		if err == nil {
+			err = c.operandError
+		}
+	}()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for i, s := range node.Statements {
+			if i == len(node.Statements)-1 && producesResult(s) {
+				if err := c.Compile(s.(*ast.ExpressionStatement).Expression); err != nil {
+					return err
+				}
+				c.emit(code.OpReturnValue)
+				return nil
+			}
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpReturn)
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.LetStatement:
+		var symbol Symbol
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			// Declare the name first so the function can call itself.
+			symbol = c.symbolTable.Define(node.Name.Value)
+			if err := c.compileFunction(fn, node.Name.Value, false); err != nil {
+				return err
+			}
+		} else {
+			if err := c.Compile(node.Value); err != nil {
+				return err
+			}
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+		if err := c.checkSymbol(symbol); err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+		c.emit(code.OpPop)
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.BreakStatement:
+		l := c.currentLoop()
+		l.breaks = append(l.breaks, c.emit(code.OpLoopJump, 9999))
+
+	case *ast.ContinueStatement:
+		l := c.currentLoop()
+		if l.continueTarget >= 0 {
+			c.emit(code.OpLoopJump, l.continueTarget)
+		} else {
+			l.continues = append(l.continues, c.emit(code.OpLoopJump, 9999))
+		}
+
+	case *ast.BlockStatment:
+		return c.compileBlock(node)
+
+	case *ast.AssignStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		symbol, err := c.resolve(node.Name.Value)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.Identifier:
+		symbol, err := c.resolve(node.Value)
+		if err != nil {
+			return err
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.IntegerLiteral:
+		return c.emitConstant(&object.Integer{Value: node.Value})
+
+	case *ast.NumberLiteral:
+		return c.emitConstant(&object.Number{Value: node.Value})
+
+	case *ast.StringLiteral:
+		return c.emitConstant(&object.String{Value: node.Value})
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		op, ok := prefixOperators[node.Operator]
+		if !ok {
+			return c.errorf(errors.CodeUnknownOperator, "unknown operator: %s", node.Operator)
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.LogicalExpression:
+		// The left operand stays on the stack as the result if it decides
+		// it; otherwise it is popped and the right operand is the result.
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		jump := code.OpJumpFalsy
+		switch node.Operator {
+		case "or":
+			jump = code.OpJumpTruthy
+		case "??":
+			jump = code.OpJumpNotNull
+		}
+		endPos := c.emit(jump, 9999)
+		c.emit(code.OpPop)
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.changeOperand(endPos, len(c.currentInstructions()))
+
+	case *ast.ConditionalExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		elsePos := c.emit(code.OpJumpNotTruthy, 9999)
+		if err := c.Compile(node.Then); err != nil {
+			return err
+		}
+		endPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(elsePos, len(c.currentInstructions()))
+		if err := c.Compile(node.Else); err != nil {
+			return err
+		}
+		c.changeOperand(endPos, len(c.currentInstructions()))
+
+	case *ast.InfixExpression:
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return c.errorf(errors.CodeUnknownOperator, "unknown operator: %s", node.Operator)
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+		if err := c.compileBlock(node.Then); err != nil {
+			return err
+		}
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if node.Else == nil {
+			c.emit(code.OpNull)
+		} else if err := c.compileBlock(node.Else); err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	case *ast.WhileExpression:
+		l := c.beginLoop()
+		loopStart := len(c.currentInstructions())
+		l.continueTarget = loopStart
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		exitPos := c.emit(code.OpJumpNotTruthy, 9999)
+		if err := c.compileBlock(node.Body); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+		c.emit(code.OpJump, loopStart)
+		c.changeOperand(exitPos, len(c.currentInstructions()))
+		c.endLoop(l)
+		c.emit(code.OpNull)
+
+	case *ast.ForExpression:
+		return c.compileFor(node)
+
+	case *ast.ForInExpression:
+		return c.compileForIn(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "", false)
+
+	case *ast.CallExpression:
+		if len(node.Arguments) > maxLocals {
+			return c.errorf(errors.CodeCompile, "too many arguments in call")
+		}
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, arg := range node.Arguments {
+			if err := c.Compile(arg); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.ArrayLiteral:
+		if len(node.Elements) > maxElements {
+			return c.errorf(errors.CodeCompile, "too many elements in array literal")
+		}
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		if len(node.Pairs)*2 > maxElements {
+			return c.errorf(errors.CodeCompile, "too many pairs in hash literal")
+		}
+		// Compile the pairs in source order so the output is stable.
+		for _, k := range node.SortedKeys() {
+			if err := c.Compile(k); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		// An optional index leaves a null operand on the stack as its
+		// result.
+		nullPos := -1
+		if node.Optional() {
+			nullPos = c.emit(code.OpJumpNull, 9999)
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+		if nullPos >= 0 {
+			c.changeOperand(nullPos, len(c.currentInstructions()))
+		}
+
+	case *ast.StructStatement:
+		return c.compileStruct(node)
+
+	case *ast.ThisExpression:
+		symbol, err := c.resolve("this")
+		if err != nil {
+			return err
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.SuperExpression:
+		for _, name := range []string{"super", "this"} {
+			symbol, err := c.resolve(name)
+			if err != nil {
+				return err
+			}
+			c.loadSymbol(symbol)
+		}
+		return c.emitName(code.OpGetSuper, node.Method.Value)
+
+	case *ast.PropertyExpression:
+		if err := c.Compile(node.Object); err != nil {
+			return err
+		}
+		return c.emitName(code.OpGetProperty, node.Name.Value)
+
+	case *ast.PropertyAssignment:
+		if err := c.Compile(node.Target.Object); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		return c.emitName(code.OpSetProperty, node.Target.Name.Value)
+
+	case *ast.CompoundAssignment:
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return c.errorf(errors.CodeUnknownOperator, "unknown operator: %s", node.Operator)
+		}
+		return c.compileUpdate(node.Target, false, func() error {
+			if err := c.Compile(node.Value); err != nil {
+				return err
+			}
+			c.emit(op)
+			return nil
+		})
+
+	case *ast.UpdateExpression:
+		op := code.OpIncrement
+		if node.Operator == "--" {
+			op = code.OpDecrement
+		}
+		return c.compileUpdate(node.Target, !node.Prefix, func() error {
+			c.emit(op)
+			return nil
+		})
+
+	case *ast.IndexAssignment:
+		for _, n := range []ast.Expression{node.Target.Left, node.Target.Index, node.Value} {
+			if err := c.Compile(n); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSetIndex)
+
+	default:
+		return c.errorf(errors.CodeCompile, "cannot compile %T", node)
+	}
+	return nil
+}
+
+// producesResult reports whether s is an expression statement whose value a
+// program should return when it is the last statement. Like declarations,
+// assignments produce no result.
+func producesResult(s ast.Statement) bool {
+	es, ok := s.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	_, isAssign := es.Expression.(*ast.AssignStatement)
+	return !isAssign
+}
+
+// compileBlock compiles the statements of block so that they leave the value
+// of the block on the stack: the value of its last statement if that is an
+// expression, null otherwise.
+func (c *Compiler) compileBlock(block *ast.BlockStatment) error {
+	for _, s := range block.Statements {
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+	}
+	if n := len(block.Statements); n > 0 && c.lastInstructionIs(code.OpPop) {
+		if _, ok := block.Statements[n-1].(*ast.ExpressionStatement); ok {
+			c.removeLastPop()
+			return nil
+		}
+	}
+	c.emit(code.OpNull)
+	return nil
+}
+
+// compileFor compiles a C-style for loop. Its variables live in a block of
+// the function's locals. Each iteration closes the upvalues over them before
+// the update, so closures created in the body keep the values they saw while
+// the next iteration works on fresh copies.
+func (c *Compiler) compileFor(node *ast.ForExpression) error {
+	firstLocal := c.symbolTable.BeginBlock()
+	if node.Init != nil {
+		if err := c.Compile(node.Init); err != nil {
+			return err
+		}
+	}
+
+	l := c.beginLoop()
+	loopStart := len(c.currentInstructions())
+	exitPos := -1
+	if node.Condition != nil {
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		exitPos = c.emit(code.OpJumpNotTruthy, 9999)
+	}
+	if err := c.compileBlock(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.continueHere(l)
+	c.emit(code.OpCloseUpvalues, firstLocal)
+	if node.Update != nil {
+		if err := c.Compile(node.Update); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	}
+	c.emit(code.OpJump, loopStart)
+	if exitPos != -1 {
+		c.changeOperand(exitPos, len(c.currentInstructions()))
+	}
+	c.endLoop(l)
+	c.emit(code.OpCloseUpvalues, firstLocal)
+	c.emit(code.OpNull)
+	c.symbolTable.EndBlock()
+	return nil
+}
+
+// compileForIn compiles a for-in loop. The iterator stays on the stack while
+// the loop runs, and the loop variable is a block local that gets a fresh
+// upvalue each iteration, as in compileFor.
+func (c *Compiler) compileForIn(node *ast.ForInExpression) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	previous := c.span
+	c.span = node.Iterable.Span()
+	c.emit(code.OpIterator)
+	c.span = previous
+
+	firstLocal := c.symbolTable.BeginBlock()
+	symbol := c.symbolTable.Define(node.Variable.Value)
+	if err := c.checkSymbol(symbol); err != nil {
+		return err
+	}
+
+	l := c.beginLoop()
+	loopStart := len(c.currentInstructions())
+	exitPos := c.emit(code.OpIterNext, 9999)
+	c.storeSymbol(symbol)
+	c.emit(code.OpPop)
+	if err := c.compileBlock(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.continueHere(l)
+	c.emit(code.OpCloseUpvalues, firstLocal)
+	c.emit(code.OpJump, loopStart)
+	c.changeOperand(exitPos, len(c.currentInstructions()))
+	c.endLoop(l)
+	c.emit(code.OpCloseUpvalues, firstLocal)
+	c.emit(code.OpPop)
+	c.emit(code.OpNull)
+	c.symbolTable.EndBlock()
+	return nil
+}
+
+// compileUpdate compiles the replacement of the value of target, an
+// identifier, index expression or property, by the value update computes
+// from the old one, which it finds on top of the stack. The parts of target
+// are evaluated once. The expression evaluates to the new value, or to the
+// old one if keepOld is set, which the compiler keeps in a hidden local.
+func (c *Compiler) compileUpdate(target ast.Expression, keepOld bool, update func() error) error {
+	var temp Symbol
+	if keepOld {
+		c.symbolTable.BeginBlock()
+		defer c.symbolTable.EndBlock()
+		// No variable can be called "", so the hidden local shadows none.
+		temp = c.symbolTable.Define("")
+		if err := c.checkSymbol(temp); err != nil {
+			return err
+		}
+	}
+
+	var store func() error
+	switch target := target.(type) {
+	case *ast.Identifier:
+		symbol, err := c.resolve(target.Value)
+		if err != nil {
+			return err
+		}
+		c.loadSymbol(symbol)
+		store = func() error {
+			c.storeSymbol(symbol)
+			return nil
+		}
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpDup, 2)
+		c.emit(code.OpIndex)
+		store = func() error {
+			c.emit(code.OpSetIndex)
+			return nil
+		}
+	case *ast.PropertyExpression:
+		if err := c.Compile(target.Object); err != nil {
+			return err
+		}
+		c.emit(code.OpDup, 1)
+		if err := c.emitName(code.OpGetProperty, target.Name.Value); err != nil {
+			return err
+		}
+		store = func() error {
+			return c.emitName(code.OpSetProperty, target.Name.Value)
+		}
+	default:
+		return c.errorf(errors.CodeInvalidAssignment, "invalid assignment target: %s", target.String())
+	}
+
+	if keepOld {
+		c.storeSymbol(temp)
+	}
+	if err := update(); err != nil {
+		return err
+	}
+	if err := store(); err != nil {
+		return err
+	}
+	if keepOld {
+		c.emit(code.OpPop)
+		c.loadSymbol(temp)
+	}
+	return nil
+}
+
+// beginLoop starts a loop, recording the height of the stack its break and
+// continue statements unwind to: they may leave an expression half
+// evaluated.
+func (c *Compiler) beginLoop() *loop {
+	c.emit(code.OpEnterLoop)
+	l := &loop{continueTarget: -1}
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, l)
+	return l
+}
+
+// continueHere makes the current position the target of l's continue
+// statements.
+func (c *Compiler) continueHere(l *loop) {
+	l.continueTarget = len(c.currentInstructions())
+	for _, pos := range l.continues {
+		c.changeOperand(pos, l.continueTarget)
+	}
+}
+
+// endLoop makes the current position the target of l's break statements and
+// ends the loop.
+func (c *Compiler) endLoop(l *loop) {
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.emit(code.OpLeaveLoop)
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+}
+
+// currentLoop returns the innermost loop being compiled. The parser only
+// accepts break and continue inside a loop of the function.
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	return loops[len(loops)-1]
+}
+
+// compileStruct compiles a struct declaration: the field defaults and an
+// OpStruct that builds the struct from them, then each method followed by an
+// OpMethod adding it to the struct.
+//
+// A struct with a superclass is built in a function taking the superclass as
+// its parameter super, which is called on the spot. Its methods capture super
+// from that function the way any closure captures a local of the function
+// enclosing it.
+func (c *Compiler) compileStruct(node *ast.StructStatement) error {
+	// Declare the name first so the methods can refer to the struct.
+	symbol := c.symbolTable.Define(node.Name.Value)
+	if err := c.checkSymbol(symbol); err != nil {
+		return err
+	}
+
+	if node.Superclass == nil {
+		if err := c.compileStructBody(node); err != nil {
+			return err
+		}
+	} else {
+		c.enterScope()
+		c.symbolTable.Define("super")
+		if err := c.compileStructBody(node); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+		if err := c.emitClosure(node.Name.Value, 1); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Superclass); err != nil {
+			return err
+		}
+		c.emit(code.OpCall, 1)
+	}
+	c.storeSymbol(symbol)
+	c.emit(code.OpPop)
+	return nil
+}
+
+func (c *Compiler) compileStructBody(node *ast.StructStatement) error {
+	template := &object.Struct{Name: node.Name.Value}
+	for _, f := range node.Fields {
+		if f.Value == nil {
+			c.emit(code.OpNull)
+		} else if err := c.Compile(f.Value); err != nil {
+			return err
+		}
+		template.Fields = append(template.Fields, object.Field{Name: f.Name.Value})
+	}
+	index, err := c.addConstant(template)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpStruct, index)
+
+	if node.Superclass != nil {
+		previous := c.span
+		c.span = node.Superclass.Span()
+		symbol, _ := c.symbolTable.Resolve("super")
+		c.loadSymbol(symbol)
+		c.emit(code.OpInherit)
+		c.span = previous
+	}
+
+	for _, m := range node.Methods {
+		if err := c.compileFunction(m.Function, m.Name.Value, true); err != nil {
+			return err
+		}
+		if err := c.emitName(code.OpMethod, m.Name.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileFunction compiles fn into a closure. A method takes the instance it
+// is called on as a hidden first parameter, this.
+func (c *Compiler) compileFunction(fn *ast.FunctionLiteral, name string, method bool) error {
+	numParameters := len(fn.Parameters)
+	if method {
+		numParameters++
+	}
+	if numParameters > maxLocals {
+		return c.errorf(errors.CodeCompile, "too many parameters in function")
+	}
+	c.enterScope()
+
+	if method {
+		c.symbolTable.Define("this")
+	}
+	for _, p := range fn.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	if err := c.compileBlock(fn.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+	return c.emitClosure(name, numParameters)
+}
+
+// emitClosure leaves the scope of the function just compiled and emits the
+// OpClosure that creates it.
+func (c *Compiler) emitClosure(name string, numParameters int) error {
+	upvalues := c.symbolTable.Upvalues
+	numLocals := c.symbolTable.NumLocals()
+	instructions, spans := c.leaveScope()
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		Spans:         spans,
+		NumLocals:     numLocals,
+		NumParameters: numParameters,
+		Name:          name,
+	}
+	for _, u := range upvalues {
+		compiledFn.Upvalues = append(compiledFn.Upvalues,
+			object.UpvalueRef{IsLocal: u.Scope == LocalScope, Index: u.Index})
+	}
+
+	index, err := c.addConstant(compiledFn)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpClosure, index)
+	return nil
+}
+
+// resolve returns the symbol name refers to. Names that are not declared
+// anywhere are globals: they may be defined later, by the script, by a later
+// REPL line or by the host, or name a builtin.
+func (c *Compiler) resolve(name string) (Symbol, error) {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok {
+		symbol = c.symbolTable.DefineGlobal(name)
+	}
+	return symbol, c.checkSymbol(symbol)
+}
+
+func (c *Compiler) checkSymbol(s Symbol) error {
+	if s.Scope == GlobalScope && s.Index > maxGlobals {
+		return c.errorf(errors.CodeCompile, "too many global variables")
+	}
+	if s.Scope != GlobalScope && s.Index > maxLocals {
+		return c.errorf(errors.CodeCompile, "too many local variables in function")
+	}
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case UpvalueScope:
+		c.emit(code.OpGetUpvalue, s.Index)
+	}
+}
+
+// storeSymbol emits the instruction that stores the value on top of the
+// stack in s, leaving the value on the stack.
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case UpvalueScope:
+		c.emit(code.OpSetUpvalue, s.Index)
+	}
+}
+
+func (c *Compiler) emitConstant(obj object.Object) error {
+	index, err := c.addConstant(obj)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpConstant, index)
+	return nil
+}
+
+// emitName emits op with the constant index of name as its operand.
+func (c *Compiler) emitName(op code.Opcode, name string) error {
+	index, err := c.addConstant(&object.String{Value: name})
+	if err != nil {
+		return err
+	}
+	c.emit(op, index)
+	return nil
+}
+
+func (c *Compiler) addConstant(obj object.Object) (int, error) {
+	if len(c.constants) > maxConstants {
+		return 0, c.errorf(errors.CodeCompile, "too many constants")
+	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1, nil
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+	c.setLastInstruction(op, pos)
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	scope := &c.scopes[c.scopeIndex]
+	pos := len(scope.instructions)
+	scope.spans = scope.spans.Add(pos, c.span)
+	scope.instructions = append(scope.instructions, ins...)
+	return pos
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = EmittedInstruction{Opcode: op, Position: pos}
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.instructions = scope.instructions[:scope.lastInstruction.Position]
+	scope.lastInstruction = scope.previousInstruction
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, operand)
+	newInstruction := code.Make(op, operand)
+	copy(c.currentInstructions()[opPos:], newInstruction)
+}
+
+// checkOperands records an error if an operand of op does not fit in the
+// instruction. The jumps are the operands that can grow out of range, as
+// the code they jump over or back to grows.
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	if c.operandError != nil || code.OperandsFit(op, operands...) {
+		return
+	}
+	switch op {
+	case code.OpJump, code.OpJumpNotTruthy, code.OpJumpNull, code.OpIterNext, code.OpLoopJump:
+		c.operandError = c.errorf(errors.CodeCompile, "too much code to jump over")
+	default:
+		def, _ := code.Lookup(byte(op))
+		c.operandError = c.errorf(errors.CodeCompile, "operand out of range for %s", def.Name)
+	}
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() (code.Instructions, code.SpanTable) {
+	scope := c.scopes[c.scopeIndex]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return scope.instructions, scope.spans
+}
+
+func (c *Compiler) errorf(code string, format string, a ...interface{}) error {
+	return errors.Errorf(code, c.span, format, a...)
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[c.scopeIndex]
+	return &Bytecode{
+		Instructions: scope.instructions,
+		Spans:        scope.spans,
+		Constants:    c.constants,
+		Globals:      c.symbolTable.Globals().Names(),
+		NumLocals:    c.symbolTable.Globals().NumLocals(),
+	}
+}
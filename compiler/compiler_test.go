@@ -0,0 +1,612 @@
+package compiler
+
+import (
+	"fmt"
+	"go-compiler/main/ast"
+	"go-compiler/main/code"
+	"go-compiler/main/errors"
+	"go-compiler/main/object"
+	"go-compiler/main/parser"
+	"go-compiler/main/scanner"
+	"strings"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "1; 2 < -3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpMinus),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "true and false or 1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpFalsy, 6),
+				// 0004
+				code.Make(code.OpPop),
+				// 0005
+				code.Make(code.OpFalse),
+				// 0006
+				code.Make(code.OpJumpTruthy, 13),
+				// 0009
+				code.Make(code.OpPop),
+				// 0010
+				code.Make(code.OpConstant, 0),
+				// 0013
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "for (x in []) { 1 }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpArray, 0),
+				// 0003
+				code.Make(code.OpIterator),
+				// 0004
+				code.Make(code.OpEnterLoop),
+				// 0005
+				code.Make(code.OpIterNext, 20),
+				// 0008
+				code.Make(code.OpSetLocal, 0),
+				// 0010
+				code.Make(code.OpPop),
+				// 0011
+				code.Make(code.OpConstant, 0),
+				// 0014
+				code.Make(code.OpPop),
+				// 0015
+				code.Make(code.OpCloseUpvalues, 0),
+				// 0017
+				code.Make(code.OpJump, 5),
+				// 0020
+				code.Make(code.OpLeaveLoop),
+				// 0021
+				code.Make(code.OpCloseUpvalues, 0),
+				// 0023
+				code.Make(code.OpPop),
+				// 0024
+				code.Make(code.OpNull),
+				// 0025
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "while (false) { 1 }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpEnterLoop),
+				// 0001
+				code.Make(code.OpFalse),
+				// 0002
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0005
+				code.Make(code.OpConstant, 0),
+				// 0008
+				code.Make(code.OpPop),
+				// 0009
+				code.Make(code.OpJump, 1),
+				// 0012
+				code.Make(code.OpLeaveLoop),
+				// 0013
+				code.Make(code.OpNull),
+				// 0014
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "while (true) { if (false) { continue; }; break; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpEnterLoop),
+				// 0001
+				code.Make(code.OpTrue),
+				// 0002
+				code.Make(code.OpJumpNotTruthy, 26),
+				// 0005
+				code.Make(code.OpFalse),
+				// 0006
+				code.Make(code.OpJumpNotTruthy, 16),
+				// 0009
+				code.Make(code.OpLoopJump, 1),
+				// 0012
+				code.Make(code.OpNull),
+				// 0013
+				code.Make(code.OpJump, 17),
+				// 0016
+				code.Make(code.OpNull),
+				// 0017
+				code.Make(code.OpPop),
+				// 0018
+				code.Make(code.OpLoopJump, 26),
+				// 0021
+				code.Make(code.OpNull),
+				// 0022
+				code.Make(code.OpPop),
+				// 0023
+				code.Make(code.OpJump, 1),
+				// 0026
+				code.Make(code.OpLeaveLoop),
+				// 0027
+				code.Make(code.OpNull),
+				// 0028
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; let two = one; two = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpReturn),
+			},
+		},
+		{
+			// Undeclared names are globals, resolved when the program runs.
+			input:             "len(later)",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { let b = a; b }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpNull),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { fn(b) { a = a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetUpvalue, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpSetUpvalue, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpClosure, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "struct P { x = 1; y; fn get() { this.x } }",
+			expectedConstants: []interface{}{
+				1,
+				nil, // the struct template
+				nil, // "x"
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetProperty, 2),
+					code.Make(code.OpReturnValue),
+				},
+				nil, // "get"
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpStruct, 1),
+				code.Make(code.OpClosure, 3),
+				code.Make(code.OpMethod, 4),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpReturn),
+			},
+		},
+		{
+			input: "struct A {} struct B < A { fn f() { super.f() } }",
+			expectedConstants: []interface{}{
+				nil, // the template of A
+				nil, // the template of B
+				nil, // "f"
+				[]code.Instructions{
+					code.Make(code.OpGetUpvalue, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetSuper, 2),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+				nil, // "f"
+				[]code.Instructions{
+					code.Make(code.OpStruct, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpInherit),
+					code.Make(code.OpClosure, 3),
+					code.Make(code.OpMethod, 4),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpStruct, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 5),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpReturn),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+
+	bytecode := compileInput(t, "struct P { x = 1; y; fn get() { this.x } }")
+	template := bytecode.Constants[1].(*object.Struct)
+	if template.Name != "P" || len(template.Fields) != 2 ||
+		template.Fields[0].Name != "x" || template.Fields[1].Name != "y" {
+		t.Errorf("wrong struct template: %+v", template)
+	}
+	if get := bytecode.Constants[3].(*object.CompiledFunction); get.NumParameters != 1 {
+		t.Errorf("method should take this as a parameter. got NumParameters=%d", get.NumParameters)
+	}
+}
+
+func TestUpvalueRefs(t *testing.T) {
+	input := `
+fn(a) {
+  let b = 1;
+  fn() {
+    fn() { a + b }
+  }
+}`
+	bytecode := compileInput(t, input)
+
+	innermost := bytecode.Constants[1].(*object.CompiledFunction)
+	middle := bytecode.Constants[2].(*object.CompiledFunction)
+	outer := bytecode.Constants[3].(*object.CompiledFunction)
+
+	expectUpvalues(t, "innermost", innermost, []object.UpvalueRef{{IsLocal: false, Index: 0}, {IsLocal: false, Index: 1}})
+	expectUpvalues(t, "middle", middle, []object.UpvalueRef{{IsLocal: true, Index: 0}, {IsLocal: true, Index: 1}})
+	expectUpvalues(t, "outer", outer, nil)
+	if outer.NumLocals != 2 || outer.NumParameters != 1 {
+		t.Errorf("outer has wrong locals. got NumLocals=%d NumParameters=%d",
+			outer.NumLocals, outer.NumParameters)
+	}
+}
+
+func TestFunctionNames(t *testing.T) {
+	bytecode := compileInput(t, "let add = fn(a, b) { a + b }; fn() { 1 };")
+	if name := bytecode.Constants[0].(*object.CompiledFunction).Name; name != "add" {
+		t.Errorf("wrong function name. want=%q, got=%q", "add", name)
+	}
+	if name := bytecode.Constants[2].(*object.CompiledFunction).Name; name != "" {
+		t.Errorf("anonymous function has a name. got=%q", name)
+	}
+}
+
+func TestInstructionSpans(t *testing.T) {
+	bytecode := compileInput(t, "let a = 1;\nlet b = a + true;")
+	// The OpAdd follows OpConstant 0, OpSetGlobal 0, OpPop, OpGetGlobal 0 and
+	// OpTrue.
+	span := bytecode.Spans.Lookup(11)
+	if span.Start.Line != 2 || span.Start.Column != 9 || span.End.Column != 17 {
+		t.Errorf("OpAdd has wrong span. got=%v", span)
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("wrong symbol for a. got=%+v", a)
+	}
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefining a did not reuse its slot. got=%+v", again)
+	}
+
+	outer := NewEnclosedSymbolTable(global)
+	b := outer.Define("b")
+	inner := NewEnclosedSymbolTable(outer)
+	c := inner.Define("c")
+
+	expected := []struct {
+		table  *SymbolTable
+		name   string
+		symbol Symbol
+	}{
+		{inner, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{inner, "b", Symbol{Name: "b", Scope: UpvalueScope, Index: 0}},
+		{inner, "c", Symbol{Name: "c", Scope: LocalScope, Index: 0}},
+		{outer, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0}},
+	}
+	for _, tt := range expected {
+		symbol, ok := tt.table.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+		if symbol != tt.symbol {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", tt.name, tt.symbol, symbol)
+		}
+	}
+	if len(inner.Upvalues) != 1 || inner.Upvalues[0] != b {
+		t.Errorf("wrong upvalues. got=%+v", inner.Upvalues)
+	}
+	if _, ok := inner.Resolve("d"); ok {
+		t.Errorf("undefined name d resolved")
+	}
+	if c.Index != 0 {
+		t.Errorf("wrong index for c. got=%d", c.Index)
+	}
+}
+
+func TestSymbolTableBlocks(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("i")
+
+	if first := global.BeginBlock(); first != 0 {
+		t.Errorf("wrong first block local. got=%d", first)
+	}
+	i := global.Define("i")
+	if i != (Symbol{Name: "i", Scope: LocalScope, Index: 0}) {
+		t.Errorf("block did not shadow i. got=%+v", i)
+	}
+	if again := global.Define("i"); again != i {
+		t.Errorf("redefining i in its block did not reuse its slot. got=%+v", again)
+	}
+	if g := global.DefineGlobal("g"); g.Scope != GlobalScope {
+		t.Errorf("DefineGlobal defined a local. got=%+v", g)
+	}
+	global.EndBlock()
+
+	if symbol, _ := global.Resolve("i"); symbol != (Symbol{Name: "i", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("block did not restore i. got=%+v", symbol)
+	}
+	if _, ok := global.Resolve("g"); !ok {
+		t.Errorf("global defined in a block not resolvable")
+	}
+	if global.NumLocals() != 1 {
+		t.Errorf("wrong number of locals. got=%d", global.NumLocals())
+	}
+
+	fn := NewEnclosedSymbolTable(global)
+	fn.Define("a")
+	fn.BeginBlock()
+	if x := fn.Define("x"); x != (Symbol{Name: "x", Scope: LocalScope, Index: 1}) {
+		t.Errorf("wrong symbol for block local x. got=%+v", x)
+	}
+	fn.EndBlock()
+	if _, ok := fn.Resolve("x"); ok {
+		t.Errorf("block local x resolvable after its block")
+	}
+	if fn.NumLocals() != 2 {
+		t.Errorf("wrong number of locals. got=%d", fn.NumLocals())
+	}
+}
+
+func expectUpvalues(t *testing.T, name string, fn *object.CompiledFunction, want []object.UpvalueRef) {
+	t.Helper()
+	if len(fn.Upvalues) != len(want) {
+		t.Fatalf("%s has wrong number of upvalues. want=%v, got=%v", name, want, fn.Upvalues)
+	}
+	for i, ref := range want {
+		if fn.Upvalues[i] != ref {
+			t.Errorf("%s upvalue %d wrong. want=%+v, got=%+v", name, i, ref, fn.Upvalues[i])
+		}
+	}
+}
+
+func TestOperandLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 0; if (true) {\n" + strings.Repeat("x = x + 1;\n", 15000) + "}", "too much code to jump over"},
+		{"let x = 0; while (x < 1) {\n" + strings.Repeat("x = x + 1;\n", 15000) + "}", "too much code to jump over"},
+		{"[" + strings.Repeat("0,\n", 1<<16) + "0]", "too many elements in array literal"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		d, ok := err.(*errors.Diagnostic)
+		if !ok {
+			t.Errorf("no compile error for %d bytes of input. got=%v", len(tt.input), err)
+			continue
+		}
+		if d.Code != errors.CodeCompile || d.Message != tt.expected {
+			t.Errorf("wrong compile error. want=%q, got=%s %q", tt.expected, d.Code, d.Message)
+		}
+	}
+
+	// Just under the limit still compiles.
+	compileInput(t, "let x = 0; if (true) {\n"+strings.Repeat("x = x + 1;\n", 5000)+"}")
+}
+
+func compileInput(t *testing.T, input string) *Bytecode {
+	t.Helper()
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return compiler.Bytecode()
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		bytecode := compileInput(t, tt.input)
+
+		if err := testInstructions(tt.expectedInstructions, bytecode.Instructions); err != nil {
+			t.Fatalf("%s: testInstructions failed: %s", tt.input, err)
+		}
+		if err := testConstants(tt.expectedConstants, bytecode.Constants); err != nil {
+			t.Fatalf("%s: testConstants failed: %s", tt.input, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	tokens := scanner.NewScanner(input).ScanTokens()
+	return parser.NewParser(tokens).Parse()
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+	if len(actual) != len(concatted) {
+		return fmt.Errorf("wrong instructions length.\nwant=%q\ngot =%q", concatted, actual)
+	}
+	for i, ins := range concatted {
+		if actual[i] != ins {
+			return fmt.Errorf("wrong instruction at %d.\nwant=%q\ngot =%q", i, concatted, actual)
+		}
+	}
+	return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d", len(actual), len(expected))
+	}
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				return fmt.Errorf("constant %d - wrong value. want=%d, got=%+v", i, constant, actual[i])
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+			if err := testInstructions(constant, fn.Instructions); err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	UpvalueScope SymbolScope = "UPVALUE"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable resolves the names used in one function to where their values
+// live at run time. Variables are scoped to the function that declares them,
+// as in the evaluator, so there is one table per function literal, enclosed
+// by the table of the function around it; the outermost table holds the
+// globals. Loops open blocks in the table for the variables scoped to them.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	// Upvalues are the symbols of enclosing functions this function
+	// captures, in upvalue index order.
+	Upvalues []Symbol
+
+	store          map[string]Symbol
+	names          []string
+	numDefinitions int
+	blocks         []block
+
+	// The global table hands out the slots of its block locals in the
+	// frame of the program's main function, and reuses them once their
+	// block ends.
+	numBlockLocals int
+	maxBlockLocals int
+}
+
+// block is a block scope open in a table. It records the symbols its
+// definitions shadow, nil for names that were not defined, to restore them
+// when the block ends.
+type block struct {
+	shadowed       map[string]*Symbol
+	numBlockLocals int
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define declares name in this table. Declaring a name the table already
+// holds reuses its slot, so redeclaring a variable rebinds it the way the
+// evaluator does. Inside a block, name is declared as a new local of the
+// block instead, unless the block already declares it.
+func (s *SymbolTable) Define(name string) Symbol {
+	if len(s.blocks) > 0 {
+		return s.defineInBlock(name)
+	}
+	if symbol, ok := s.store[name]; ok && symbol.Scope != UpvalueScope {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.names = append(s.names, name)
+	s.numDefinitions++
+	return symbol
+}
+
+// DefineGlobal declares name as a global, even while a block is open in the
+// global table.
+func (s *SymbolTable) DefineGlobal(name string) Symbol {
+	globals := s.Globals()
+	blocks := globals.blocks
+	globals.blocks = nil
+	defer func() { globals.blocks = blocks }()
+	return globals.Define(name)
+}
+
+func (s *SymbolTable) defineInBlock(name string) Symbol {
+	b := s.blocks[len(s.blocks)-1]
+	if _, ok := b.shadowed[name]; ok {
+		return s.store[name]
+	}
+	if previous, ok := s.store[name]; ok {
+		b.shadowed[name] = &previous
+	} else {
+		b.shadowed[name] = nil
+	}
+
+	symbol := Symbol{Name: name, Scope: LocalScope}
+	if s.Outer == nil {
+		symbol.Index = s.numBlockLocals
+		s.numBlockLocals++
+		s.maxBlockLocals = max(s.maxBlockLocals, s.numBlockLocals)
+	} else {
+		symbol.Index = s.numDefinitions
+		s.names = append(s.names, name)
+		s.numDefinitions++
+	}
+	s.store[name] = symbol
+	return symbol
+}
+
+// BeginBlock opens a block scope and returns the slot its first local will
+// take.
+func (s *SymbolTable) BeginBlock() int {
+	s.blocks = append(s.blocks, block{shadowed: make(map[string]*Symbol), numBlockLocals: s.numBlockLocals})
+	if s.Outer == nil {
+		return s.numBlockLocals
+	}
+	return s.numDefinitions
+}
+
+// EndBlock closes the innermost block scope, restoring the symbols its
+// locals shadowed.
+func (s *SymbolTable) EndBlock() {
+	b := s.blocks[len(s.blocks)-1]
+	s.blocks = s.blocks[:len(s.blocks)-1]
+	s.numBlockLocals = b.numBlockLocals
+	for name, previous := range b.shadowed {
+		if previous == nil {
+			delete(s.store, name)
+		} else {
+			s.store[name] = *previous
+		}
+	}
+}
+
+// Resolve looks name up in this table and the ones enclosing it. A local of
+// an enclosing function is captured as an upvalue of this one, and of every
+// function in between.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || symbol.Scope == GlobalScope {
+		return symbol, ok
+	}
+	return s.defineUpvalue(symbol), true
+}
+
+func (s *SymbolTable) defineUpvalue(original Symbol) Symbol {
+	s.Upvalues = append(s.Upvalues, original)
+
+	symbol := Symbol{Name: original.Name, Scope: UpvalueScope, Index: len(s.Upvalues) - 1}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Globals returns the table holding the global names.
+func (s *SymbolTable) Globals() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// Names returns the names defined in the table, indexed by slot.
+func (s *SymbolTable) Names() []string {
+	return s.names
+}
+
+// NumDefinitions returns the number of slots the table's names occupy.
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
+
+// NumLocals returns the number of local slots the function of the table
+// needs: all of its definitions, or for the global table the most block
+// locals the program's main function has in use at once.
+func (s *SymbolTable) NumLocals() int {
+	if s.Outer == nil {
+		return s.maxBlockLocals
+	}
+	return s.numDefinitions
+}
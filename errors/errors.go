@@ -1,21 +1,137 @@
 package errors
 
 import (
-	"errors"
 	"fmt"
+	"sort"
+	"strings"
+
+	"go-compiler/main/token"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityNote
 )
 
-var HadError bool
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+// Diagnostic codes. Scanner errors are numbered E00xx, parser errors E01xx,
+// runtime errors E02xx and bytecode compiler errors E03xx. Warnings are
+// numbered W00xx.
+const (
+	CodeUnexpectedCharacter = "E0001"
+	CodeUnterminatedString  = "E0002"
+	CodeInvalidNumber       = "E0003"
+	CodeInvalidEscape       = "E0004"
+	CodeInvalidEncoding     = "E0005"
+	CodeUnterminatedComment = "E0006"
+
+	CodeUnexpectedToken    = "E0100"
+	CodeExpectedExpression = "E0101"
+	CodeInvalidThis        = "E0102"
+	CodeInvalidSuper       = "E0103"
+	CodeInheritsItself     = "E0104"
+	CodeOutsideLoop        = "E0105"
+	CodeInvalidAssignment  = "E0106"
+
+	CodeRuntime           = "E0200"
+	CodeTypeMismatch      = "E0201"
+	CodeUnknownOperator   = "E0202"
+	CodeUndefined         = "E0203"
+	CodeUnhashable        = "E0204"
+	CodeNotCallable       = "E0205"
+	CodeIndexNotSupported = "E0206"
+	CodeBuiltin           = "E0207"
+	CodeStackOverflow     = "E0208"
+	CodeNoProperties      = "E0209"
+	CodeInvalidSuperclass = "E0210"
+	CodeNotIterable       = "E0211"
+	CodeIndexOutOfRange   = "E0212"
+	CodeInvalidOperand    = "E0213"
+	CodeIntegerOverflow   = "E0214"
+	CodeDivisionByZero    = "E0215"
+
+	CodeCompile = "E0300"
+
+	CodeCommentedDivision = "W0001"
+)
+
+// Diagnostic is a single problem found in a script, located by the span of
+// source text that caused it.
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Message  string
+	Span     token.Span
+	Notes    []string
+}
+
+func NewDiagnostic(severity Severity, code string, span token.Span, message string) *Diagnostic {
+	return &Diagnostic{Severity: severity, Code: code, Message: message, Span: span}
+}
+
+// Errorf returns an error diagnostic with a formatted message.
+func Errorf(code string, span token.Span, format string, a ...interface{}) *Diagnostic {
+	return NewDiagnostic(SeverityError, code, span, fmt.Sprintf(format, a...))
+}
+
+// TokenError returns an error diagnostic pointing at t.
+func TokenError(code string, t *token.Token, message string) *Diagnostic {
+	if t.Type == token.EOF {
+		return Errorf(code, t.Span(), "%s at end", message)
+	}
+	return Errorf(code, t.Span(), "%s at '%s'", message, t.Lexeme)
+}
+
+// WithNote appends a note to the diagnostic and returns it.
+func (d *Diagnostic) WithNote(format string, a ...interface{}) *Diagnostic {
+	d.Notes = append(d.Notes, fmt.Sprintf(format, a...))
+	return d
+}
+
+// Error formats the diagnostic on a single line, without a source excerpt.
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("[line %d:%d] %s: %s", d.Span.Start.Line, d.Span.Start.Column, d.Severity, d.Message)
+}
+
+// List is the set of diagnostics collected while processing one script. It
+// can be returned as an error.
+type List []*Diagnostic
+
+func (l List) Error() string {
+	messages := make([]string, len(l))
+	for i, d := range l {
+		messages[i] = d.Error()
+	}
+	return strings.Join(messages, "\n")
+}
 
-func Error(line int, message string) {
-	Report(line, "", message)
+// HasErrors reports whether any diagnostic in the list is an error rather
+// than a warning or note.
+func (l List) HasErrors() bool {
+	for _, d := range l {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
 }
 
-// TODO: add row and column number and where in the line the error is
-func Report(line int, where string, message string) string {
-	errorMessage := fmt.Sprintf("[line %d] Error %s: %s\n", line, where, message)
-	err := errors.New(errorMessage)
-	fmt.Println(err)
-	HadError = true
-	return errorMessage
+// Sort orders the diagnostics by where they start in the source.
+func (l List) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].Span.Start.Offset < l[j].Span.Start.Offset
+	})
 }
@@ -0,0 +1,60 @@
+package errors
+
+import (
+	"go-compiler/main/token"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	source := "let x = 1;\n\tx + true;\nlet é = \"ü\" - 1;\n"
+	tests := []struct {
+		diagnostic *Diagnostic
+		expected   string
+	}{
+		{
+			Errorf(CodeTypeMismatch, token.Span{
+				Start: token.Position{Offset: 12, Line: 2, Column: 2},
+				End:   token.Position{Offset: 20, Line: 2, Column: 10},
+			}, "type mismatch: %s + %s", "NUMBER", "BOOLEAN"),
+			"error[E0201]: type mismatch: NUMBER + BOOLEAN\n" +
+				" --> test.lox:2:2\n" +
+				"  |\n" +
+				"2 | \tx + true;\n" +
+				"  | \t^~~~~~~~\n",
+		},
+		{
+			Errorf(CodeUnexpectedToken, token.Span{
+				Start: token.Position{Offset: 10, Line: 1, Column: 11},
+				End:   token.Position{Offset: 10, Line: 1, Column: 11},
+			}, "expected expression").WithNote("statements end with ';'"),
+			"error[E0100]: expected expression\n" +
+				" --> test.lox:1:11\n" +
+				"  |\n" +
+				"1 | let x = 1;\n" +
+				"  |           ^\n" +
+				"  = note: statements end with ';'\n",
+		},
+		{
+			Errorf(CodeTypeMismatch, token.Span{
+				Start: token.Position{Offset: 31, Line: 3, Column: 9},
+				End:   token.Position{Offset: 40, Line: 3, Column: 16},
+			}, "unknown operator: %s - %s", "STRING", "INTEGER"),
+			"error[E0201]: unknown operator: STRING - INTEGER\n" +
+				" --> test.lox:3:9\n" +
+				"  |\n" +
+				"3 | let é = \"ü\" - 1;\n" +
+				"  |         ^~~~~~~\n",
+		},
+		{
+			NewDiagnostic(SeverityWarning, "", token.Span{}, "no location"),
+			"warning: no location\n",
+		},
+	}
+
+	renderer := NewRenderer("test.lox", source)
+	for _, tt := range tests {
+		if got := renderer.Render(tt.diagnostic); got != tt.expected {
+			t.Errorf("wrong rendering. expected=\n%s\ngot=\n%s", tt.expected, got)
+		}
+	}
+}
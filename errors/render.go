@@ -0,0 +1,101 @@
+package errors
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Renderer formats diagnostics against the source they were reported for,
+// printing the offending line with the span underlined:
+//
+//	error[E0201]: type mismatch: NUMBER + BOOLEAN
+//	 --> script.lox:1:1
+//	  |
+//	1 | 5 + true;
+//	  | ^~~~~~~~
+type Renderer struct {
+	Filename string
+	lines    []string
+}
+
+// NewRenderer returns a renderer for diagnostics about source. Without
+// source, diagnostics are rendered with their positions only.
+func NewRenderer(filename string, source string) *Renderer {
+	if source == "" {
+		return &Renderer{Filename: filename}
+	}
+	return &Renderer{Filename: filename, lines: strings.Split(source, "\n")}
+}
+
+func (r *Renderer) Render(d *Diagnostic) string {
+	var out bytes.Buffer
+	out.WriteString(d.Severity.String())
+	if d.Code != "" {
+		out.WriteString("[" + d.Code + "]")
+	}
+	out.WriteString(": " + d.Message + "\n")
+
+	start, end := d.Span.Start, d.Span.End
+	if start.Line == 0 {
+		r.writeNotes(&out, "", d.Notes)
+		return out.String()
+	}
+
+	gutter := strings.Repeat(" ", len(strconv.Itoa(start.Line)))
+	out.WriteString(fmt.Sprintf("%s--> %s:%d:%d\n", gutter, r.Filename, start.Line, start.Column))
+	if start.Line > len(r.lines) {
+		r.writeNotes(&out, gutter, d.Notes)
+		return out.String()
+	}
+
+	line := strings.TrimRight(r.lines[start.Line-1], "\r")
+	out.WriteString(gutter + " |\n")
+	out.WriteString(fmt.Sprintf("%d | %s\n", start.Line, line))
+
+	// Spans running past the first line are underlined up to its end.
+	width := end.Column - start.Column
+	if end.Line != start.Line {
+		width = utf8.RuneCountInString(line) - start.Column + 1
+	}
+	underline := "^"
+	if width > 1 {
+		underline += strings.Repeat("~", width-1)
+	}
+	out.WriteString(gutter + " | " + indentFor(line, start.Column) + underline + "\n")
+
+	r.writeNotes(&out, gutter, d.Notes)
+	return out.String()
+}
+
+// RenderAll renders each diagnostic in turn.
+func (r *Renderer) RenderAll(diagnostics []*Diagnostic) string {
+	var out bytes.Buffer
+	for _, d := range diagnostics {
+		out.WriteString(r.Render(d))
+	}
+	return out.String()
+}
+
+func (r *Renderer) writeNotes(out *bytes.Buffer, gutter string, notes []string) {
+	for _, note := range notes {
+		out.WriteString(gutter + " = note: " + note + "\n")
+	}
+}
+
+// indentFor returns the padding that lines a caret up under column, keeping
+// any tabs from the source line so the caret stays aligned.
+func indentFor(line string, column int) string {
+	var out strings.Builder
+	chars := []rune(line)
+	for i := 0; i < column-1; i++ {
+		if i < len(chars) && chars[i] == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+	return out.String()
+}
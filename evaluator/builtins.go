@@ -1,27 +1,82 @@
 package evaluator
 
 import (
+	"bufio"
 	"fmt"
 	"go-compiler/main/object"
+	"io"
+	"os"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
-var builtins = map[string]*object.Builtin{
+// builtins are the standard builtins bound to the process's own streams,
+// used when a script's environment does not provide its own.
+var builtins = NewBuiltins(os.Stdout, bufio.NewReader(os.Stdin))
+
+// NewBuiltins returns the standard builtin functions, with output written to
+// stdout and input read from stdin.
+func NewBuiltins(stdout io.Writer, stdin *bufio.Reader) map[string]*object.Builtin {
+	all := map[string]*object.Builtin{
+		"print": {
+			Fn: func(args ...object.Object) object.Object {
+				for _, arg := range args {
+					fmt.Fprintf(stdout, "%v ", arg.Inspect())
+				}
+				fmt.Fprintln(stdout)
+				return NULL
+			},
+		},
+		"input": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+				}
+				if len(args) == 1 {
+					fmt.Fprint(stdout, args[0].Inspect())
+				}
+				return readLine(stdin)
+			},
+		},
+		"readLine": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				return readLine(stdin)
+			},
+		},
+	}
+	for name, builtin := range pureBuiltins {
+		all[name] = builtin
+	}
+	return all
+}
+
+// readLine reads the next line from r without its line ending, returning
+// null once the input is exhausted.
+func readLine(r *bufio.Reader) object.Object {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return NULL
+	}
+	if err != nil && err != io.EOF {
+		return newError("could not read input: %s", err)
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return &object.String{Value: line}
+}
+
+// pureBuiltins are the builtins that do no I/O.
+var pureBuiltins = map[string]*object.Builtin{
 	"clock": {
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 0 {
 				return newError("wrong number of arguments. got=%d, want=0", len(args))
 			}
-			return &object.Number{Value: float64(time.Now().UnixMilli())}
-		},
-	},
-	"print": {
-		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Printf("%v ", arg.Inspect())
-			}
-			fmt.Println()
-			return NULL
+			return &object.Integer{Value: time.Now().UnixMilli()}
 		},
 	},
 	"len": {
@@ -31,9 +86,9 @@ var builtins = map[string]*object.Builtin{
 			}
 			switch arg := args[0].(type) {
 			case *object.Array:
-				return &object.Number{Value: float64(len(arg.Elements))}
+				return &object.Integer{Value: int64(len(arg.Elements))}
 			case *object.String:
-				return &object.Number{Value: float64(len(arg.Value))}
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 			default:
 				return newError("argument to `len` not supported, got %s", args[0].Type())
 			}
@@ -52,7 +107,8 @@ var builtins = map[string]*object.Builtin{
 				return NULL
 			case *object.String:
 				if len(arg.Value) > 0 {
-					return &object.String{Value: string(arg.Value[0])}
+					r, _ := utf8.DecodeRuneInString(arg.Value)
+					return &object.String{Value: string(r)}
 				}
 				return NULL
 			default:
@@ -73,7 +129,8 @@ var builtins = map[string]*object.Builtin{
 				return NULL
 			case *object.String:
 				if len(arg.Value) > 0 {
-					return &object.String{Value: string(arg.Value[len(arg.Value)-1])}
+					r, _ := utf8.DecodeLastRuneInString(arg.Value)
+					return &object.String{Value: string(r)}
 				}
 				return NULL
 			default:
@@ -3,13 +3,18 @@ package evaluator
 import (
 	"fmt"
 	"go-compiler/main/ast"
+	"go-compiler/main/errors"
 	"go-compiler/main/object"
+	"go-compiler/main/token"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+	NULL  = object.NULL
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
@@ -19,13 +24,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalProgramStatements(node, env)
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
 	case *ast.AssignStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		env.Reset(node.Name.Value, val)
@@ -33,36 +38,49 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalIdentifier(node, env)
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
 	case *ast.NumberLiteral:
 		return &object.Number{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.Boolean:
-		return nativeBoolToBooleanObject(node.Value)
+		return object.NativeBool(node.Value)
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right, node.Token.Line)
+		return evalPrefixExpression(node.Operator, right, node.Span())
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right, node.Token.Line)
+		return evalInfixExpression(node.Operator, left, right, node.Span())
+	case *ast.LogicalExpression:
+		return evalLogicalExpression(node, env)
+	case *ast.ConditionalExpression:
+		condition := Eval(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if object.IsTruthy(condition) {
+			return Eval(node.Then, env)
+		}
+		return Eval(node.Else, env)
 	case *ast.BlockStatment:
 		return evalBlockStatements(node.Statements, env)
 	case *ast.IfExpression:
 		condition := Eval(node.Condition, env)
-		if isError(condition) {
+		if isAbrupt(condition) {
 			return condition
 		}
-		if condition != FALSE && condition != NULL {
+		if object.IsTruthy(condition) {
 			return Eval(node.Then, env)
 		} else if node.Else != nil {
 			return Eval(node.Else, env)
@@ -70,44 +88,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return NULL
 		}
 	case *ast.WhileExpression:
-		for {
-			condition := Eval(node.Condition, env)
-			if isError(condition) {
-				return condition
-			}
-			if !isTruthy(condition) {
-				return NULL
-			}
-			eval := Eval(node.Body, env)
-			if isError(eval) {
-				return eval
-			}
-			if v, ok := eval.(*object.ReturnValue); ok {
-				if v.Value != nil {
-					/*
-						BUG: DO NOT RETURN 'v.Value', instead we should return 'v'.
-
-						If we return 'v.Value' then below code will print '5', not '6'(which is expected)
-						let add = fn(x,y){
-							let i = 0
-							while (i++ < 10) {
-								return x * y
-							}
-							return x + y
-						}
-						println(add(2,3))
-					*/
-
-					//return v.Value
-					return v
-				}
-				break
-			}
-		}
-		return NULL
+		return evalWhileExpression(node, env)
+	case *ast.ForExpression:
+		return evalForExpression(node, env)
+	case *ast.ForInExpression:
+		return evalForInExpression(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.ReturnStatement:
 		ret := Eval(node.ReturnValue, env)
-		if isError(ret) {
+		if isAbrupt(ret) {
 			return ret
 		}
 		return &object.ReturnValue{Value: ret}
@@ -119,35 +111,97 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if isAbrupt(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env, node.Token.Line)
-		if len(args) == 1 && isError(args[0]) {
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 
-		return evalCall(function, args, node.Token.Line)
+		return evalCall(function, args, node.Span())
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env, node.Token.Line)
-		if len(elements) == 1 && isError(elements[0]) {
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) || node.Optional() && left == NULL {
 			return left
 		}
 		index := Eval(node.Index, env)
-		if isError(index) {
+		if isAbrupt(index) {
 			return index
 		}
 
-		return evalIndexExpression(left, index, node.Token.Line)
+		return evalIndexExpression(left, index, node.Span())
 	case *ast.HashLiteral:
 
 		return evalHashLiteral(node, env)
+	case *ast.StructStatement:
+		s := evalStructStatement(node, env)
+		if isAbrupt(s) {
+			return s
+		}
+		env.Set(node.Name.Value, s)
+	case *ast.ThisExpression:
+		if this, ok := env.Get("this"); ok {
+			return this
+		}
+		return newErrorAt(node.Span(), errors.CodeUndefined, "'this' used outside of a method")
+	case *ast.SuperExpression:
+		superclass, _ := env.Get("super")
+		this, _ := env.Get("this")
+		return withSpan(object.SuperMethod(superclass.(*object.Struct), this, node.Method.Value), node.Span())
+	case *ast.PropertyExpression:
+		obj := Eval(node.Object, env)
+		if isAbrupt(obj) {
+			return obj
+		}
+		return withSpan(object.GetProperty(obj, node.Name.Value), node.Span())
+	case *ast.PropertyAssignment:
+		target := Eval(node.Target.Object, env)
+		if isAbrupt(target) {
+			return target
+		}
+		value := Eval(node.Value, env)
+		if isAbrupt(value) {
+			return value
+		}
+		return withSpan(object.SetProperty(target, node.Target.Name.Value, value), node.Span())
+	case *ast.CompoundAssignment:
+		_, updated := evalUpdate(node.Target, env, node.Span(), func(old object.Object) object.Object {
+			value := Eval(node.Value, env)
+			if isAbrupt(value) {
+				return value
+			}
+			return evalInfixExpression(node.Operator, old, value, node.Span())
+		})
+		return updated
+	case *ast.UpdateExpression:
+		old, updated := evalUpdate(node.Target, env, node.Span(), func(old object.Object) object.Object {
+			return withSpan(object.Unary(node.Operator, old), node.Span())
+		})
+		if node.Prefix || isAbrupt(updated) {
+			return updated
+		}
+		return old
+	case *ast.IndexAssignment:
+		left := Eval(node.Target.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := Eval(node.Target.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+		value := Eval(node.Value, env)
+		if isAbrupt(value) {
+			return value
+		}
+		return withSpan(object.SetIndex(left, index, value), node.Span())
 	}
 
 	return nil
@@ -161,7 +215,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	if builtin, ok := builtins[node.Value]; ok {
 		return builtin
 	}
-	return newError("[line %v] identifier not found: %v", node.Token.Line, node.Value)
+	return newErrorAt(node.Span(), errors.CodeUndefined, "identifier not found: %v", node.Value)
 }
 
 func evalProgramStatements(program *ast.Program, env *object.Environment) object.Object {
@@ -187,7 +241,8 @@ func evalBlockStatements(statements []ast.Statement, env *object.Environment) ob
 	for _, stmt := range statements {
 		result = Eval(stmt, env)
 		if result != nil {
-			if result.Type() == object.RETURN_OBJ || result.Type() == object.ERROR_OBJ {
+			switch result.Type() {
+			case object.RETURN_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
 				return result
 			}
 		}
@@ -195,13 +250,166 @@ func evalBlockStatements(statements []ast.Statement, env *object.Environment) ob
 	return result
 }
 
-// func evalWhileExpression(condition, body object.Object, env *object.Environment)
+// evalUpdate replaces the value of target, an identifier, index expression or
+// property, with update applied to it. The parts of target are evaluated
+// once. It returns the old and the new value, or the same error twice.
+func evalUpdate(target ast.Expression, env *object.Environment, span token.Span,
+	update func(old object.Object) object.Object) (object.Object, object.Object) {
+	var old object.Object
+	var store func(value object.Object) object.Object
+	switch target := target.(type) {
+	case *ast.Identifier:
+		old = evalIdentifier(target, env)
+		store = func(value object.Object) object.Object {
+			env.Reset(target.Value, value)
+			return value
+		}
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isAbrupt(left) {
+			return left, left
+		}
+		index := Eval(target.Index, env)
+		if isAbrupt(index) {
+			return index, index
+		}
+		old = evalIndexExpression(left, index, target.Span())
+		store = func(value object.Object) object.Object {
+			return withSpan(object.SetIndex(left, index, value), span)
+		}
+	case *ast.PropertyExpression:
+		obj := Eval(target.Object, env)
+		if isAbrupt(obj) {
+			return obj, obj
+		}
+		old = withSpan(object.GetProperty(obj, target.Name.Value), target.Span())
+		store = func(value object.Object) object.Object {
+			return withSpan(object.SetProperty(obj, target.Name.Value, value), span)
+		}
+	default:
+		err := newErrorAt(span, errors.CodeInvalidAssignment, "invalid assignment target: %s", target.String())
+		return err, err
+	}
+	if isAbrupt(old) {
+		return old, old
+	}
+	updated := update(old)
+	if isAbrupt(updated) {
+		return updated, updated
+	}
+	if updated = store(updated); isAbrupt(updated) {
+		return updated, updated
+	}
+	return old, updated
+}
+
+// evalLogicalExpression evaluates and and or, returning the left operand
+// without evaluating the right one if it decides the result.
+func evalLogicalExpression(node *ast.LogicalExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+	switch node.Operator {
+	case "??":
+		if left != NULL {
+			return left
+		}
+	default:
+		if object.IsTruthy(left) == (node.Operator == "or") {
+			return left
+		}
+	}
+	return Eval(node.Right, env)
+}
+
+// exitLoop reports whether the result of an iteration of a loop's body ends
+// the loop, and what the loop then evaluates to: the result itself for a
+// return or an error, which propagate further, or null for a break.
+func exitLoop(result object.Object) (object.Object, bool) {
+	if result == nil {
+		return nil, false
+	}
+	switch result.Type() {
+	case object.RETURN_OBJ, object.ERROR_OBJ:
+		return result, true
+	case object.BREAK_OBJ:
+		return NULL, true
+	}
+	return nil, false
+}
+
+func evalWhileExpression(node *ast.WhileExpression, env *object.Environment) object.Object {
+	for {
+		condition := Eval(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !object.IsTruthy(condition) {
+			return NULL
+		}
+		if result, exit := exitLoop(Eval(node.Body, env)); exit {
+			return result
+		}
+	}
+}
+
+func evalForExpression(node *ast.ForExpression, env *object.Environment) object.Object {
+	loopEnv := object.NewEnvironment(env)
+	if node.Init != nil {
+		if init := Eval(node.Init, loopEnv); isAbrupt(init) {
+			return init
+		}
+	}
+	for {
+		if node.Condition != nil {
+			condition := Eval(node.Condition, loopEnv)
+			if isAbrupt(condition) {
+				return condition
+			}
+			if !object.IsTruthy(condition) {
+				return NULL
+			}
+		}
+		if result, exit := exitLoop(Eval(node.Body, loopEnv)); exit {
+			return result
+		}
+		// The next iteration gets its own copy of the loop's variables, so
+		// closures created in this one keep seeing theirs.
+		loopEnv = loopEnv.Copy()
+		if node.Update != nil {
+			if update := Eval(node.Update, loopEnv); isAbrupt(update) {
+				return update
+			}
+		}
+	}
+}
+
+func evalForInExpression(node *ast.ForInExpression, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+	iterator := withSpan(object.Iterate(iterable), node.Iterable.Span())
+	if isAbrupt(iterator) {
+		return iterator
+	}
+	it := iterator.(*object.Iterator)
+	for value, ok := it.Next(); ok; value, ok = it.Next() {
+		loopEnv := object.NewEnvironment(env)
+		loopEnv.Set(node.Variable.Value, value)
+		if result, exit := exitLoop(Eval(node.Body, loopEnv)); exit {
+			return result
+		}
+	}
+	return NULL
+}
 
-func evalExpressions(expressions []ast.Expression, env *object.Environment, line int) []object.Object {
+func evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 	for _, expr := range expressions {
 		evaluated := Eval(expr, env)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -209,21 +417,44 @@ func evalExpressions(expressions []ast.Expression, env *object.Environment, line
 	return result
 }
 
-func evalCall(fn object.Object, args []object.Object, line int) object.Object {
+// Apply calls fn with args the way a call expression in a script would.
+func Apply(fn object.Object, args []object.Object) object.Object {
+	return evalCall(fn, args, token.Span{})
+}
+
+func evalCall(fn object.Object, args []object.Object, span token.Span) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-
+		if len(args) != len(fn.Parameters) {
+			return newErrorAt(span, errors.CodeRuntime, "wrong number of arguments. got=%d, want=%d",
+				len(args), len(fn.Parameters))
+		}
 		extendedEnv := extendFunctionEnv(fn, args)
 		eval := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(eval)
+	case *object.BoundMethod:
+		return evalCall(bindThis(fn.Method.(*object.Function), fn.Receiver), args, span)
+	case *object.Struct:
+		instance := object.NewInstance(fn)
+		if init, ok := fn.Method("init"); ok {
+			// The instance is the value of the call, whatever init returns.
+			result := evalCall(bindThis(init.(*object.Function), instance), args, span)
+			if isAbrupt(result) {
+				return result
+			}
+		} else if err := instance.SetFields(args); err != nil {
+			return withSpan(err, span)
+		}
+		return instance
 	case *object.Builtin:
 		evaluated := fn.Fn(args...)
-		if evaluated, ok := evaluated.(*object.Error); ok {
-			evaluated.Message = fmt.Sprintf("[line %v] %v", line, evaluated.Message)
+		if evaluated, ok := evaluated.(*object.Error); ok && evaluated.Code == "" {
+			evaluated.Code = errors.CodeBuiltin
+			evaluated.Span = span
 		}
 		return evaluated
 	default:
-		return newError("[line %v] not a function: %s", line, fn.Type())
+		return newErrorAt(span, errors.CodeNotCallable, "not a function: %s", fn.Type())
 	}
 
 }
@@ -241,224 +472,116 @@ func extendFunctionEnv(
 	return env
 }
 
-func unwrapReturnValue(obj object.Object) object.Object {
-	if returnValue, ok := obj.(*object.ReturnValue); ok {
-		return returnValue.Value
-	}
-
-	return obj
+// bindThis returns method with this bound to receiver.
+func bindThis(method *object.Function, receiver *object.Instance) *object.Function {
+	env := object.NewEnvironment(method.Env)
+	env.Set("this", receiver)
+	return &object.Function{Parameters: method.Parameters, Body: method.Body, Env: env}
 }
 
-func evalIndexExpression(left, index object.Object, line int) object.Object {
-	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.NUMBER_OBJ:
-		return evalArrayIndexExpression(left, index)
-	case left.Type() == object.HASH_OBJ:
+func evalStructStatement(node *ast.StructStatement, env *object.Environment) object.Object {
+	var superclass object.Object
+	if node.Superclass != nil {
+		superclass = evalIdentifier(node.Superclass, env)
+		if isAbrupt(superclass) {
+			return superclass
+		}
+	}
 
-		return evalHashIndexExpression(left, index, line)
-	default:
-		return newError("[line %v] index operator not supported: %s", line, left.Type())
+	s := &object.Struct{Name: node.Name.Value, Methods: make(map[string]object.Object)}
+	for _, f := range node.Fields {
+		field := object.Field{Name: f.Name.Value}
+		if f.Value != nil {
+			field.Default = Eval(f.Value, env)
+			if isAbrupt(field.Default) {
+				return field.Default
+			}
+		}
+		s.Fields = append(s.Fields, field)
 	}
 
+	methodEnv := env
+	if superclass != nil {
+		if err := s.Inherit(superclass); err != nil {
+			return withSpan(err, node.Superclass.Span())
+		}
+		// The methods see the superclass as super.
+		methodEnv = object.NewEnvironment(env)
+		methodEnv.Set("super", superclass)
+	}
+	for _, m := range node.Methods {
+		s.Methods[m.Name.Value] = &object.Function{
+			Parameters: m.Function.Parameters,
+			Body:       m.Function.Body,
+			Env:        methodEnv,
+		}
+	}
+	return s
 }
 
-func evalArrayIndexExpression(left, index object.Object) object.Object {
-	arr := left.(*object.Array).Elements
-	idx := index.(*object.Number).Value
-	max := float64(len(arr) - 1)
-	if idx < 0 || idx > max {
-		return NULL
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
 	}
-	return arr[int(idx)]
+
+	return obj
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
 	for keyNode, valueNode := range node.Pairs {
 		key := Eval(keyNode, env)
-		if isError(key) {
+		if isAbrupt(key) {
 			return key
 		}
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return newError("[line %v] unusable as hash key: %s", node.Token.Line, key.Type())
+		if _, ok := key.(object.Hashable); !ok {
+			return newErrorAt(keyNode.Span(), errors.CodeUnhashable, "unusable as hash key: %s", key.Type())
 		}
 		value := Eval(valueNode, env)
-		if isError(value) {
+		if isAbrupt(value) {
 			return value
 		}
-		hash.Pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+		hash.SetPair(key, value)
 	}
 	return hash
 }
-func evalHashIndexExpression(left, index object.Object, line int) object.Object {
-	hash := left.(*object.Hash)
-	hashKey, ok := index.(object.Hashable)
-	if !ok {
-		return newError("[line %v] unusable as hash key: %s", line, index.Type())
-	}
-
-	val, ok := hash.Pairs[hashKey.HashKey()]
-	if !ok {
-		return NULL
-	}
-	return val.Value
-}
 
-func evalPrefixExpression(op string, right object.Object, line int) object.Object {
-	switch op {
-	case "!":
-		return evalBangOperatorExpression(right)
-	case "-":
-		return evalMinusOperatorExpression(right, line)
-	default:
-		return newError("[line %v] Unknown operator: %s%s", line, op, right.Type())
-	}
-}
-
-func evalInfixExpression(op string, left, right object.Object, line int) object.Object {
-	// case left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
-	// 	return evalBooleanInfixExpression(op, left, right)
-	switch {
-	case left.Type() == object.NUMBER_OBJ && right.Type() == object.NUMBER_OBJ:
-		return evalNumberInfixExpression(op, left, right, line)
-	case (left.Type() == object.STRING_OBJ || left.Type() == object.NUMBER_OBJ) &&
-		(right.Type() == object.NUMBER_OBJ || right.Type() == object.STRING_OBJ):
-		return evalStringInfixExpression(op, left, right, line)
-	case left.Type() != right.Type():
-		return newError("[line %v] type mismatch: %s %s %s",
-			line, left.Type(), op, right.Type())
-	case op == "==":
-		return nativeBoolToBooleanObject(left == right)
-	case op == "!=":
-		return nativeBoolToBooleanObject(left != right)
-	case op == "and":
-		return nativeBoolToBooleanObject(left.(*object.Boolean).Value && right.(*object.Boolean).Value)
-	case op == "or":
-		return nativeBoolToBooleanObject(left.(*object.Boolean).Value || right.(*object.Boolean).Value)
-	default:
-		return newError("[line %v] unknown operator: %s %s %s", line, left.Type(), op, right.Type())
-	}
-}
-
-func evalNumberInfixExpression(op string, left, right object.Object, line int) object.Object {
-	leftVal := left.(*object.Number).Value
-	rightVal := right.(*object.Number).Value
-	switch op {
-	case "+":
-		return &object.Number{Value: leftVal + rightVal}
-	case "-":
-		return &object.Number{Value: leftVal - rightVal}
-	case "*":
-		return &object.Number{Value: leftVal * rightVal}
-	case "/":
-		return &object.Number{Value: leftVal / rightVal}
-	case ">":
-		return nativeBoolToBooleanObject(leftVal > rightVal)
-	case "<":
-		return nativeBoolToBooleanObject(leftVal < rightVal)
-	case ">=":
-		return nativeBoolToBooleanObject(leftVal >= rightVal)
-	case "<=":
-		return nativeBoolToBooleanObject(leftVal <= rightVal)
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
-	default:
-		return newError("[line %v] unknown operator: %s %s %s",
-			line, left.Type(), op, right.Type())
-	}
+func evalPrefixExpression(op string, right object.Object, span token.Span) object.Object {
+	return withSpan(object.Unary(op, right), span)
 }
 
-func evalStringInfixExpression(op string, left, right object.Object, line int) object.Object {
-	if op == "+" {
-		str := fmt.Sprintf("%v%v", left.Inspect(), right.Inspect())
-		return &object.String{Value: str}
-	}
-	leftVal := left.Inspect()
-	rightVal := right.Inspect()
-	switch op {
-	case ">":
-		return nativeBoolToBooleanObject(leftVal > rightVal)
-	case "<":
-		return nativeBoolToBooleanObject(leftVal < rightVal)
-	case ">=":
-		return nativeBoolToBooleanObject(leftVal >= rightVal)
-	case "<=":
-		return nativeBoolToBooleanObject(leftVal <= rightVal)
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
-	}
-	return newError("[line %v] unknown operator: %s %s %s",
-		line, left.Type(), op, right.Type())
+func evalInfixExpression(op string, left, right object.Object, span token.Span) object.Object {
+	return withSpan(object.Binary(op, left, right), span)
 }
 
-// func evalBooleanInfixExpression(op string, left, right object.Object) object.Object {
-// 	leftVal := left.(*object.Boolean).Value
-// 	rightVal := right.(*object.Boolean).Value
-// 	switch op {
-// 	case "==":
-// 		return &object.Boolean{Value: leftVal == rightVal}
-// 	case "!=":
-// 		return &object.Boolean{Value: leftVal != rightVal}
-// 	default:
-// 		return NULL
-// 	}
-// }
-
-func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return NULL
-	default:
-		return FALSE
-	}
+func evalIndexExpression(left, index object.Object, span token.Span) object.Object {
+	return withSpan(object.Index(left, index), span)
 }
 
-func evalMinusOperatorExpression(right object.Object, line int) object.Object {
-	switch right.Type() {
-	case object.NUMBER_OBJ:
-		return &object.Number{Value: -right.(*object.Number).Value}
-	default:
-		return newError("[line %v] unknown operator: -%s", line, right.Type())
-	}
-
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
-func nativeBoolToBooleanObject(input bool) *object.Boolean {
-	if input {
-		return TRUE
+// withSpan attaches span to obj if it is an error that lacks one.
+func withSpan(obj object.Object, span token.Span) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Span == (token.Span{}) {
+		err.Span = span
 	}
-	return FALSE
+	return obj
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newErrorAt(span token.Span, code string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Code: code, Span: span}
 }
 
-func isError(obj object.Object) bool {
+// isAbrupt reports whether obj cuts short the evaluation of the expressions
+// around it: it is an error, or a break or continue on its way to its loop.
+func isAbrupt(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+		switch obj.Type() {
+		case object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+			return true
+		}
 	}
 	return false
 }
-
-func isTruthy(val object.Object) bool {
-	switch val {
-	case NULL:
-		return false
-	case TRUE:
-		return true
-	case FALSE:
-		return false
-	default:
-		return true
-	}
-}
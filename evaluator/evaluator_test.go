@@ -1,270 +1,353 @@
 package evaluator
 
 import (
+	"fmt"
+	"go-compiler/main/compiler"
+	"go-compiler/main/errors"
 	"go-compiler/main/object"
 	"go-compiler/main/parser"
 	"go-compiler/main/scanner"
+	"go-compiler/main/vm"
+	"strings"
 	"testing"
 )
 
 func TestEvalNumberExpression(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected float64
-	}{
-		{"5", 5},
-		{"10", 10},
-		{"1.01", 1.01},
-		{"-5", -5},
-		{"-10", -10},
-		{"5 + 5 + 5 + 5 - 10", 10},
-		{"2 * 2 * 2 * 2 * 2", 32},
-		{"-50 + 100 + -50", 0},
-		{"5 * 2 + 10", 20},
-		{"5 + 2 * 10", 25},
-		{"20 + 2 * -10", 0},
-		{"50 / 2 * 2 + 10", 60},
-		{"2 * (5 + 10)", 30},
-		{"3 * 3 * 3 + 10", 37},
-		{"3 * (3 * 3) + 10", 37},
-		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
-	}
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testNumberObject(t, evaluated, tt.expected)
-	}
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected float64
+		}{
+			{"5", 5},
+			{"10", 10},
+			{"1.01", 1.01},
+			{"-5", -5},
+			{"-10", -10},
+			{"5 + 5 + 5 + 5 - 10", 10},
+			{"2 * 2 * 2 * 2 * 2", 32},
+			{"-50 + 100 + -50", 0},
+			{"5 * 2 + 10", 20},
+			{"5 + 2 * 10", 25},
+			{"20 + 2 * -10", 0},
+			{"50 / 2 * 2 + 10", 60},
+			{"2 * (5 + 10)", 30},
+			{"3 * 3 * 3 + 10", 37},
+			{"3 * (3 * 3) + 10", 37},
+			{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testNumberObject(t, evaluated, tt.expected)
+		}
+	})
 }
 func TestEvalBooleanExpression(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected bool
-	}{
-		{"true", true},
-		{"false", false},
-		{"true", true},
-		{"false", false},
-		{"1 < 2", true},
-		{"1 > 2", false},
-		{"1 < 1", false},
-		{"1 > 1", false},
-		{"1 == 1", true},
-		{"1 != 1", false},
-		{"1 == 2", false},
-		{"1 != 2", true},
-		{"true == true", true},
-		{"false == false", true},
-		{"true == false", false},
-		{"true != false", true},
-		{"false != true", true},
-		{"(1 < 2) == true", true},
-		{"(1 < 2) == false", false},
-		{"(1 > 2) == true", false},
-		{"(1 > 2) == false", true},
-	}
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testBooleanObject(t, evaluated, tt.expected, tt.input)
-	}
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected bool
+		}{
+			{"true", true},
+			{"false", false},
+			{"true", true},
+			{"false", false},
+			{"1 < 2", true},
+			{"1 > 2", false},
+			{"1 < 1", false},
+			{"1 > 1", false},
+			{"1 == 1", true},
+			{"1 != 1", false},
+			{"1 == 2", false},
+			{"1 != 2", true},
+			{"true == true", true},
+			{"false == false", true},
+			{"true == false", false},
+			{"true != false", true},
+			{"false != true", true},
+			{"(1 < 2) == true", true},
+			{"(1 < 2) == false", false},
+			{"(1 > 2) == true", false},
+			{"(1 > 2) == false", true},
+		}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testBooleanObject(t, evaluated, tt.expected, tt.input)
+		}
+	})
 }
 
 func TestStringLiteral(t *testing.T) {
-	input := `"Hello World!"`
-	evaluated := testEval(input)
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
-	}
-	if str.Value != "Hello World!" {
-		t.Errorf("String has wrong value. got=%q", str.Value)
-	}
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		input := `"Hello World!"`
+		evaluated := testEval(input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+		if str.Value != "Hello World!" {
+			t.Errorf("String has wrong value. got=%q", str.Value)
+		}
+	})
 }
 
 func TestStringConcatenation(t *testing.T) {
-	input := `"Hello" + " " + "World!"`
-	evaluated := testEval(input)
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
-	}
-	if str.Value != "Hello World!" {
-		t.Errorf("String has wrong value. got=%q", str.Value)
-	}
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		input := `"Hello" + " " + "World!"`
+		evaluated := testEval(input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+		if str.Value != "Hello World!" {
+			t.Errorf("String has wrong value. got=%q", str.Value)
+		}
+	})
 }
 func TestStringConcatenation2(t *testing.T) {
-	input := `"Hello" + " " + "World! " + 2`
-	evaluated := testEval(input)
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
-	}
-	if str.Value != "Hello World! 2" {
-		t.Errorf("String has wrong value. got=%q", str.Value)
-	}
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		input := `"Hello" + " " + "World! " + 2`
+		evaluated := testEval(input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+		if str.Value != "Hello World! 2" {
+			t.Errorf("String has wrong value. got=%q", str.Value)
+		}
+	})
+}
+
+func TestStringEscapesAndInterpolation(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{`"tab\there"`, "tab\there"},
+			{`"\"quoted\" \\ \$"`, `"quoted" \ $`},
+			{`"\x41\u00e9\u{1F600}"`, "Aé😀"},
+			{"`raw\\n ${x}`", `raw\n ${x}`},
+			{`let name = "x"; "Hello ${name}!"`, "Hello x!"},
+			{`"${1 + 2}"`, "3"},
+			{`"${1} ${true} ${[1, "a"]}"`, "1 true [1, a]"},
+			{`let a = 2; "outer ${"inner ${a * 3}"} ${ {"k": a}["k"] }"`, "outer inner 6 2"},
+			{`"a" + true`, "atrue"},
+			{"let s = `multi\nline`;\n\"${s}\" - 1", "[line 3] unknown operator: STRING - INTEGER"},
+		}
+		for _, tt := range tests {
+			testValue(t, tt.input, testEval(tt.input), tt.expected)
+		}
+	})
+}
+
+func TestLogicalExpressions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"true and false", false},
+			{"false or true", true},
+			{`1 and "x"`, "x"},
+			{`if (false) { 1 } or "default"`, "default"},
+			{"0 or 2", 0.0},
+			{"false and 1", false},
+			{"false or if (false) { 1 }", nil},
+			{"let n = 0; let bump = fn() { n = n + 1; true }; false and bump(); true or bump(); n;", 0.0},
+			{"let n = 0; let bump = fn() { n = n + 1; true }; true and bump(); false or bump(); n;", 2.0},
+			{"false or true and false", false},
+		}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case bool:
+				testBooleanObject(t, evaluated, expected, tt.input)
+			case float64:
+				testNumberObject(t, evaluated, expected)
+			case string:
+				if s, ok := evaluated.(*object.String); !ok || s.Value != expected {
+					t.Errorf("%q: expected %q, got=%T (%+v)", tt.input, expected, evaluated, evaluated)
+				}
+			case nil:
+				testNullObject(t, evaluated)
+			}
+		}
+	})
 }
 
 func TestBangOperator(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected bool
-	}{
-		{"!true", false},
-		{"!false", true},
-		{"!5", false},
-		{"!!true", true},
-		{"!!false", false},
-		{"!!5", true},
-	}
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testBooleanObject(t, evaluated, tt.expected, tt.input)
-	}
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected bool
+		}{
+			{"!true", false},
+			{"!false", true},
+			{"!5", false},
+			{"!!true", true},
+			{"!!false", false},
+			{"!!5", true},
+		}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testBooleanObject(t, evaluated, tt.expected, tt.input)
+		}
+	})
 }
 
 func TestIfElseExpression(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{"if (true) { 10 }", 10},
-		{"if (false) { 10 }", nil},
-		{"if (1) { 10 }", 10},
-		{"if (1 < 2) { 10 }", 10},
-		{"if (1 > 2) { 10 }", nil},
-		{"if (1 > 2) { 10 } else { 20 }", 20},
-		{"if (1 < 2) { 10 } else { 20 }", 10},
-	}
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"if (true) { 10 }", 10},
+			{"if (false) { 10 }", nil},
+			{"if (1) { 10 }", 10},
+			{"if (1 < 2) { 10 }", 10},
+			{"if (1 > 2) { 10 }", nil},
+			{"if (1 > 2) { 10 } else { 20 }", 20},
+			{"if (1 < 2) { 10 } else { 20 }", 10},
+		}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
 
-		if number, ok := tt.expected.(float64); ok {
-			testNumberObject(t, evaluated, number)
-		} else if number, ok := tt.expected.(int); ok {
-			testNumberObject(t, evaluated, float64(number))
-		} else {
-			testNullObject(t, evaluated)
+			if number, ok := tt.expected.(float64); ok {
+				testNumberObject(t, evaluated, number)
+			} else if number, ok := tt.expected.(int); ok {
+				testNumberObject(t, evaluated, float64(number))
+			} else {
+				testNullObject(t, evaluated)
+			}
 		}
-	}
+	})
 }
 
 func TestReturnStatements(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected float64
-	}{
-		{"return 10;", 10},
-		{"return 10; 9;", 10},
-		{"return 2 * 5; 9;", 10},
-		{"9; return 2 * 5; 9;", 10},
-		{`if (10 > 1) {
-			if (10 > 1) {
-				return 10;
-			}
-			return 1
-		}`, 10},
-		// 		{
-		// 			`
-		// let f = fn(x) {
-		//   return x;
-		//   x + 10;
-		// };
-		// f(10);`,
-		// 			10,
-		// 		},
-		// 		{
-		// 			`
-		// let f = fn(x) {
-		//    let result = x + 10;
-		//    return result;
-		//    return 10;
-		// };
-		// f(10);`,
-		// 			20,
-		// 		},
-	}
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testNumberObject(t, evaluated, tt.expected)
-	}
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected float64
+		}{
+			{"return 10;", 10},
+			{"return 10; 9;", 10},
+			{"return 2 * 5; 9;", 10},
+			{"9; return 2 * 5; 9;", 10},
+			{`if (10 > 1) {
+				if (10 > 1) {
+					return 10;
+				}
+				return 1
+			}`, 10},
+			// 		{
+			// 			`
+			// let f = fn(x) {
+			//   return x;
+			//   x + 10;
+			// };
+			// f(10);`,
+			// 			10,
+			// 		},
+			// 		{
+			// 			`
+			// let f = fn(x) {
+			//    let result = x + 10;
+			//    return result;
+			//    return 10;
+			// };
+			// f(10);`,
+			// 			20,
+			// 		},
+		}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			testNumberObject(t, evaluated, tt.expected)
+		}
+	})
 }
 
 func TestErrorHandling(t *testing.T) {
-	tests := []struct {
-		input           string
-		expectedMessage string
-	}{
-		{
-			"5 + true;",
-			"[line 1] type mismatch: NUMBER + BOOLEAN",
-		},
-		{
-			"5 + true; 5;",
-			"[line 1] type mismatch: NUMBER + BOOLEAN",
-		},
-		{
-			"-true",
-			"[line 1] unknown operator: -BOOLEAN",
-		},
-		{
-			"true + false;",
-			"[line 1] unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"5; true + false; 5",
-			"[line 1] unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"if (10 > 1) { true + false; }",
-			"[line 1] unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			`"Hello" - "World"`,
-			"[line 1] unknown operator: STRING - STRING",
-		},
-		{
-			`if (10 > 1) {
-		if (10 > 1) {
-		return true + false;
-		}
-		return 1;
-		}
-		`,
-			"[line 3] unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{"foobar", "[line 1] identifier not found: foobar"},
-		{
-			`{"name": "Monkey"}[fn(x) { x }];`,
-			"[line 1] unusable as hash key: FUNCTION",
-		},
-	}
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		errObj, ok := evaluated.(*object.Error)
-		if !ok {
-			t.Errorf("no error object returned. got=%T(%+v)",
-				evaluated, evaluated)
-			continue
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input           string
+			expectedMessage string
+		}{
+			{
+				"5 + true;",
+				"[line 1] type mismatch: INTEGER + BOOLEAN",
+			},
+			{
+				"5 + true; 5;",
+				"[line 1] type mismatch: INTEGER + BOOLEAN",
+			},
+			{
+				"-true",
+				"[line 1] unknown operator: -BOOLEAN",
+			},
+			{
+				"true + false;",
+				"[line 1] unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				"5; true + false; 5",
+				"[line 1] unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				"if (10 > 1) { true + false; }",
+				"[line 1] unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{
+				`"Hello" - "World"`,
+				"[line 1] unknown operator: STRING - STRING",
+			},
+			{
+				`if (10 > 1) {
+			if (10 > 1) {
+			return true + false;
+			}
+			return 1;
+			}
+			`,
+				"[line 3] unknown operator: BOOLEAN + BOOLEAN",
+			},
+			{"foobar", "[line 1] identifier not found: foobar"},
+			{
+				`{"name": "Monkey"}[fn(x) { x }];`,
+				"[line 1] unusable as hash key: FUNCTION",
+			},
 		}
-		if errObj.Message != tt.expectedMessage {
-			t.Errorf("wrong error message. expected=%q, got=%q",
-				tt.expectedMessage, errObj.Message)
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)",
+					evaluated, evaluated)
+				continue
+			}
+			if errorMessage(errObj) != tt.expectedMessage {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					tt.expectedMessage, errorMessage(errObj))
+			}
 		}
-	}
+	})
 }
 
 func TestLetStatements(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected float64
-	}{
-		{"let a = 5; a;", 5},
-		{"let a = 5 * 5; a;", 25},
-		{"let a = 5; let b = a; b;", 5},
-		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
-	}
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected float64
+		}{
+			{"let a = 5; a;", 5},
+			{"let a = 5 * 5; a;", 25},
+			{"let a = 5; let b = a; b;", 5},
+			{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		}
 
-	for _, tt := range tests {
-		testNumberObject(t, testEval(tt.input), tt.expected)
-	}
+		for _, tt := range tests {
+			testNumberObject(t, testEval(tt.input), tt.expected)
+		}
+	})
 }
 
 func TestFunctionObject(t *testing.T) {
@@ -293,225 +376,885 @@ func TestFunctionObject(t *testing.T) {
 }
 
 func TestFunctionApplication(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected float64
-	}{
-		{"let identity = fn(x) { x; }; identity(5);", 5},
-		{"let identity = fn(x) { return x; }; identity(5);", 5},
-		{"let double = fn(x) { x * 2; }; double(5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
-		{"fn(x) { x; }(5)", 5},
-	}
-	for _, tt := range tests {
-		testNumberObject(t, testEval(tt.input), tt.expected)
-	}
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected float64
+		}{
+			{"let identity = fn(x) { x; }; identity(5);", 5},
+			{"let identity = fn(x) { return x; }; identity(5);", 5},
+			{"let double = fn(x) { x * 2; }; double(5);", 10},
+			{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+			{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+			{"fn(x) { x; }(5)", 5},
+		}
+		for _, tt := range tests {
+			testNumberObject(t, testEval(tt.input), tt.expected)
+		}
+	})
 }
 
 func TestClosures(t *testing.T) {
-	input := `
-   let newAdder = fn(x) {
-     fn(y) { x + y };
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		input := `
+	   let newAdder = fn(x) {
+	     fn(y) { x + y };
+	};
+	   let addTwo = newAdder(2);
+	   addTwo(2);`
+		testNumberObject(t, testEval(input), 4)
+	})
+}
+
+func TestClosuresShareVariables(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected float64
+		}{
+			{`
+let newCounter = fn() {
+  let count = 0;
+  fn() { count = count + 1; count };
+};
+let counter = newCounter();
+counter();
+counter();`, 2},
+			{`
+let pair = fn() {
+  let value = 1;
+  let get = fn() { value };
+  let set = fn(v) { value = v };
+  set(5);
+  get();
 };
-   let addTwo = newAdder(2);
-   addTwo(2);`
-	testNumberObject(t, testEval(input), 4)
+pair();`, 5},
+			{`
+let outer = fn(x) {
+  let middle = fn() { fn() { x * 2 } };
+  middle();
+};
+outer(21)();`, 42},
+		}
+		for _, tt := range tests {
+			testNumberObject(t, testEval(tt.input), tt.expected)
+		}
+	})
 }
 
-func TestBuiltinFunctions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{`len("")`, 0},
-		{`len("four")`, 4},
-		{`len("hello world")`, 11},
-		{`len(1)`, "[line 1] argument to `len` not supported, got NUMBER"},
-		{`len("one", "two")`, "[line 1] wrong number of arguments. got=2, want=1"},
-		{`len([1, 2, 3])`, 3},
-		{`len([])`, 0},
-		{`puts("hello", "world!")`, nil},
-		{`first([1, 2, 3])`, 1},
-		{`first([])`, nil},
-		{`first(1)`, "[line 1] argument to `first` not supported, got NUMBER"},
-		{`last([1, 2, 3])`, 3},
-		{`last([])`, nil},
-		{`last(1)`, "[line 1] argument to `last` not supported, got NUMBER"},
-		{`rest([1, 2, 3])`, []int{2, 3}},
-		{`rest([])`, nil},
-		{`rest(1)`, "[line 1] argument to `rest` must be ARRAY, got NUMBER"},
-		{`push([], 1)`, []int{1}},
-		{`push(1, 1)`, "[line 1] argument to `push` must be ARRAY, got NUMBER"},
-	}
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		switch expected := tt.expected.(type) {
-		case int:
-			testNumberObject(t, evaluated, float64(expected))
-		case string:
-			errObj, ok := evaluated.(*object.Error)
+func TestRecursiveFunctions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected float64
+		}{
+			{`
+let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+fib(15);`, 610},
+			{`
+let wrapper = fn() {
+  let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1) };
+  countDown(3);
+};
+wrapper();`, 0},
+		}
+		for _, tt := range tests {
+			testNumberObject(t, testEval(tt.input), tt.expected)
+		}
+	})
+}
+
+func TestWhileExpression(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected float64
+		}{
+			{"let i = 0; while (i < 10) { i = i + 1; }; i;", 10},
+			{"let sum = fn(n) { let i = 0; let s = 0; while (i < n) { i = i + 1; s = s + i; }; s }; sum(4);", 10},
+			{"let f = fn() { let i = 0; while (true) { i = i + 1; if (i > 2) { return i; } } }; f();", 3},
+		}
+		for _, tt := range tests {
+			testNumberObject(t, testEval(tt.input), tt.expected)
+		}
+		testNullObject(t, testEval("while (false) { 1 }"))
+	})
+}
+
+func TestForExpression(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected float64
+		}{
+			{"let s = 0; for (let i = 0; i < 5; i = i + 1) { s = s + i; }; s;", 10},
+			{"let i = 0; for (; i < 3;) { i = i + 1; }; i;", 3},
+			{"let i = 7; for (let i = 0; i < 3; i = i + 1) { }; i;", 7},
+			{"let f = fn() { for (let i = 0; ; i = i + 1) { if (i > 4) { return i; } } }; f();", 5},
+			{"let fs = []; for (let i = 0; i < 3; i = i + 1) { fs = push(fs, fn() { i }); }; fs[0]() + 10 * fs[2]();", 20},
+			{"let fs = []; for (let i = 0; i < 2; i = i + 1) { let j = i * 3; fs = push(fs, fn() { j }); }; fs[1]();", 3},
+		}
+		for _, tt := range tests {
+			testNumberObject(t, testEval(tt.input), tt.expected)
+		}
+		testNullObject(t, testEval("for (let i = 0; i < 2; i = i + 1) { i }"))
+	})
+}
+
+func TestForInExpression(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`let s = ""; for (x in ["1", "2", "3"]) { s = s + x; }; s;`, "123"},
+			{`let s = ""; for (c in "abc") { s = c + s; }; s;`, "cba"},
+			{`let s = ""; for (k in {"b": 1, "a": 2}) { s = s + k; }; s;`, "ab"},
+			{`let fs = []; for (x in ["a", "b"]) { fs = push(fs, fn() { x }); }; fs[0]() + fs[1]();`, "ab"},
+			{`let x = "out"; for (x in [1]) { }; x;`, "out"},
+			{`let f = fn(xs) { for (x in xs) { if (x == "b") { return x; } }; "none" }; f(["a", "b", "c"]);`, "b"},
+		}
+		for _, tt := range tests {
+			result := testEval(tt.input)
+			s, ok := result.(*object.String)
 			if !ok {
-				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				t.Errorf("%q: object is not String. got=%T (%+v)", tt.input, result, result)
 				continue
 			}
-			if errObj.Message != expected {
-				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			if s.Value != tt.expected {
+				t.Errorf("%q: wrong value. expected=%q, got=%q", tt.input, tt.expected, s.Value)
 			}
-		case []int:
-			array, ok := evaluated.(*object.Array)
+		}
+
+		errObj, ok := testEval("let n = 5;\nfor (x in n) { }").(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for iterating over a number")
+		}
+		if msg := errorMessage(errObj); msg != "[line 2] cannot iterate over INTEGER" {
+			t.Errorf("wrong error message. got=%q", msg)
+		}
+	})
+}
+
+func TestBreakAndContinue(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected float64
+		}{
+			{"let i = 0; while (true) { i = i + 1; if (i == 3) { break; } }; i;", 3},
+			{"let s = 0; let i = 0; while (i < 5) { i = i + 1; if (i == 2) { continue } s = s + i; }; s;", 13},
+			{"let s = 0; for (let i = 0; i < 10; i = i + 1) { if (i == 1) { continue; } if (i == 4) { break; } s = s + i; }; s;", 5},
+			{"let s = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } s = s + x; }; s;", 8},
+			{"let n = 0; for (x in [1, 2, 3]) { for (y in [1, 2, 3]) { if (y == 2) { break; } n = n + 1; } }; n;", 3},
+			{"let n = 0; for (x in [1, 2]) { n = n + 10; while (true) { break; }; n = n + 1; }; n;", 22},
+			{"let a = []; for (x in [1, 2, 3]) { a = push(a, if (x == 2) { continue; } else { x }); }; len(a);", 2},
+			{"let f = fn() { for (x in [1, 2]) { let g = fn() { x }; if (x == 1) { continue; } return g(); } }; f();", 2},
+		}
+		for _, tt := range tests {
+			testNumberObject(t, testEval(tt.input), tt.expected)
+		}
+		testNullObject(t, testEval("while (true) { break; }"))
+	})
+}
+
+func TestCallErrors(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input           string
+			expectedMessage string
+		}{
+			{"fn(x) { x }(1, 2)", "[line 1] wrong number of arguments. got=2, want=1"},
+			{"let a = 1;\na(2)", "[line 2] not a function: INTEGER"},
+		}
+		for _, tt := range tests {
+			errObj, ok := testEval(tt.input).(*object.Error)
 			if !ok {
-				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				t.Errorf("no error object returned for %q", tt.input)
 				continue
 			}
+			if errorMessage(errObj) != tt.expectedMessage {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					tt.expectedMessage, errorMessage(errObj))
+			}
+		}
+	})
+}
+
+func TestStructs(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected float64
+		}{
+			{"struct P { x; y; }; let p = P(1, 2); p.x + p.y", 3},
+			{"struct P { x = 5; y; }; P().x", 5},
+			{"struct P { x = 5; y; }; P(1).x", 1},
+			{"struct P { x; }; let p = P(1); p.x = p.x + 41; p.x", 42},
+			{"struct P { x; fn get() { this.x } }; P(7).get()", 7},
+			{"struct P { x; fn add(n) { this.x = this.x + n; this } }; P(1).add(2).add(3).x", 6},
+			{"struct P { x; fn get() { this.x } }; let get = P(8).get; get()", 8},
+			{"struct P { x; fn adder() { fn(n) { this.x + n } } }; P(1).adder()(2)", 3},
+			{"struct C { n; fn init(a, b) { this.n = a * b; return 0; } }; C(6, 7).n", 42},
+			{"struct P { x; fn double() { P(this.x * 2) } }; P(4).double().x", 8},
+			{`
+let make = fn(start) {
+  struct Counter { n = 0; fn inc() { this.n = this.n + start; } }
+  Counter();
+};
+let c = make(5);
+c.inc();
+c.inc();
+c.n`, 10},
+		}
+		for _, tt := range tests {
+			testNumberObject(t, testEval(tt.input), tt.expected)
+		}
+
+		inspects := []struct {
+			input    string
+			expected string
+		}{
+			{"struct P { x; y; }; P", "<struct P>"},
+			{"struct P { x; y; }; P(1, \"a\")", "P{x: 1, y: a}"},
+			{"struct P { fn f() { 1 } }; P().f", "<method P.f>"},
+		}
+		for _, tt := range inspects {
+			if got := testEval(tt.input).Inspect(); got != tt.expected {
+				t.Errorf("%q: wrong Inspect. want=%q, got=%q", tt.input, tt.expected, got)
+			}
+		}
+	})
+}
+
+func TestStructInheritance(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		animals := `
+struct Animal {
+  legs = 4;
+  name;
+  fn describe() { this.name + " has " + this.legs + " legs" }
+  fn kind() { "animal" }
+}
+struct Bird < Animal {
+  legs = 2;
+  wings = 2;
+  fn kind() { "bird, an " + super.kind() }
+}
+struct Penguin < Bird {
+  fn init(name) { this.name = name; this.wings = 0; }
+  fn kind() { "penguin, a " + super.kind() }
+  fn later() { fn() { super.describe() } }
+}
+`
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"Animal(4, \"cat\").describe()", "cat has 4 legs"},
+			{"Bird(2, \"owl\").describe()", "owl has 2 legs"},
+			{"Bird(2, \"owl\")", "Bird{legs: 2, name: owl, wings: 2}"},
+			{"Bird(2, \"owl\").kind()", "bird, an animal"},
+			{"Penguin(\"pingu\").kind()", "penguin, a bird, an animal"},
+			{"Penguin(\"pingu\")", "Penguin{legs: 2, name: pingu, wings: 0}"},
+			{"Penguin(\"pingu\").later()()", "pingu has 2 legs"},
+			{"let f = fn() { struct Local < Bird { fn kind() { \"local \" + super.kind() } }; Local() }; f().kind()",
+				"local bird, an animal"},
+		}
+		for _, tt := range tests {
+			if got := testEval(animals + tt.input).Inspect(); got != tt.expected {
+				t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, got)
+			}
+		}
+	})
+}
 
-			if len(array.Elements) != len(expected) {
-				t.Errorf("wrong num of elements. want=%d, got=%d",
-					len(expected), len(array.Elements))
+func TestStructErrors(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input           string
+			expectedMessage string
+		}{
+			{"struct P { x; }; P(1).y", "[line 1] undefined property y on P"},
+			{"struct P { x; }; let p = P(1);\np.y = 2", "[line 2] undefined field y on P"},
+			{"let a = 1;\na.b", "[line 2] only instances have properties, got INTEGER"},
+			{"let a = 1;\na.b = 2", "[line 2] only instances have fields, got INTEGER"},
+			{"struct P { x; }; P(1, 2)", "[line 1] wrong number of arguments. got=2, want at most 1"},
+			{"struct P { fn init(a) { 1 } }; P()", "[line 1] wrong number of arguments. got=0, want=1"},
+			{"struct P { fn f(a) { a } }; P().f(1, 2)", "[line 1] wrong number of arguments. got=2, want=1"},
+			{"let A = 1;\nstruct B < A {}", "[line 2] superclass must be a struct, got INTEGER"},
+			{"struct A {}\nstruct B < A { fn f() { super.g() } }; B().f()", "[line 2] undefined method g on A"},
+		}
+		for _, tt := range tests {
+			errObj, ok := testEval(tt.input).(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q", tt.input)
 				continue
 			}
+			if errorMessage(errObj) != tt.expectedMessage {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					tt.expectedMessage, errorMessage(errObj))
+			}
+		}
+	})
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{`len("")`, 0},
+			{`len("four")`, 4},
+			{`len("hello world")`, 11},
+			{`len("héllo 😀")`, 7},
+			{`len(1)`, "[line 1] argument to `len` not supported, got INTEGER"},
+			{`len("one", "two")`, "[line 1] wrong number of arguments. got=2, want=1"},
+			{`len([1, 2, 3])`, 3},
+			{`len([])`, 0},
+			{`puts("hello", "world!")`, nil},
+			{`first([1, 2, 3])`, 1},
+			{`first([])`, nil},
+			{`first(1)`, "[line 1] argument to `first` not supported, got INTEGER"},
+			{`first("")`, nil},
+			{`last([1, 2, 3])`, 3},
+			{`last([])`, nil},
+			{`last(1)`, "[line 1] argument to `last` not supported, got INTEGER"},
+			{`rest([1, 2, 3])`, []int{2, 3}},
+			{`rest([])`, nil},
+			{`rest(1)`, "[line 1] argument to `rest` must be ARRAY, got INTEGER"},
+			{`push([], 1)`, []int{1}},
+			{`push(1, 1)`, "[line 1] argument to `push` must be ARRAY, got INTEGER"},
+		}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case int:
+				testNumberObject(t, evaluated, float64(expected))
+			case string:
+				errObj, ok := evaluated.(*object.Error)
+				if !ok {
+					t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+					continue
+				}
+				if errorMessage(errObj) != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, errorMessage(errObj))
+				}
+			case []int:
+				array, ok := evaluated.(*object.Array)
+				if !ok {
+					t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+					continue
+				}
 
-			for i, expectedElem := range expected {
-				testNumberObject(t, array.Elements[i], float64(expectedElem))
+				if len(array.Elements) != len(expected) {
+					t.Errorf("wrong num of elements. want=%d, got=%d",
+						len(expected), len(array.Elements))
+					continue
+				}
+
+				for i, expectedElem := range expected {
+					testNumberObject(t, array.Elements[i], float64(expectedElem))
+				}
 			}
+
 		}
+	})
+}
 
-	}
+func TestUnicodeStrings(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{`first("été")`, "é"},
+			{`last("été")`, "é"},
+			{`"naïve"[2]`, "ï"},
+			{`"😀!"[1]`, "!"},
+			{`"abc"[3]`, nil},
+			{`"abc"[-1]`, nil},
+			{`"abc"[0.5]`, nil},
+			{`let café = "ü"; café + café`, "üü"},
+			{`let n = 0; for (c in "日本語") { n += 1; } n == len("日本語")`, true},
+			{"let s = \"é\"; s[0] = \"e\"", "[line 1] index assignment not supported: STRING"},
+		}
+		for _, tt := range tests {
+			testValue(t, tt.input, testEval(tt.input), tt.expected)
+		}
+	})
 }
 
 func TestArrayLiterals(t *testing.T) {
-	input := "[1, 2 * 2, 3 + 3]"
-	evaluated := testEval(input)
-	result, ok := evaluated.(*object.Array)
-	if !ok {
-		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
-	}
-	if len(result.Elements) != 3 {
-		t.Fatalf("array has wrong num of elements. got=%d",
-			len(result.Elements))
-	}
-	testNumberObject(t, result.Elements[0], 1)
-	testNumberObject(t, result.Elements[1], 4)
-	testNumberObject(t, result.Elements[2], 6)
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		input := "[1, 2 * 2, 3 + 3]"
+		evaluated := testEval(input)
+		result, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+		}
+		if len(result.Elements) != 3 {
+			t.Fatalf("array has wrong num of elements. got=%d",
+				len(result.Elements))
+		}
+		testNumberObject(t, result.Elements[0], 1)
+		testNumberObject(t, result.Elements[1], 4)
+		testNumberObject(t, result.Elements[2], 6)
+	})
 }
 
 func TestArrayIndexExpressions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{
-			"[1, 2, 3][0]",
-			1},
-		{
-			"[1, 2, 3][1]",
-			2},
-		{
-			"[1, 2, 3][2]",
-			3},
-		{
-			"let i = 0; [1][i];",
-			1},
-		{
-			"[1, 2, 3][1 + 1];",
-			3,
-		}, {
-			"let myArray = [1, 2, 3]; myArray[2];",
-			3},
-		{
-			"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
-			6,
-		}, {
-			"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
-			2},
-		{
-			"[1, 2, 3][3]",
-			nil},
-		{
-			"[1, 2, 3][-1]",
-			nil,
-		}}
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		number, ok := tt.expected.(int)
-		if ok {
-			testNumberObject(t, evaluated, float64(number))
-		} else {
-			testNullObject(t, evaluated)
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{
+				"[1, 2, 3][0]",
+				1},
+			{
+				"[1, 2, 3][1]",
+				2},
+			{
+				"[1, 2, 3][2]",
+				3},
+			{
+				"let i = 0; [1][i];",
+				1},
+			{
+				"[1, 2, 3][1 + 1];",
+				3,
+			}, {
+				"let myArray = [1, 2, 3]; myArray[2];",
+				3},
+			{
+				"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+				6,
+			}, {
+				"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+				2},
+			{
+				"[1, 2, 3][3]",
+				nil},
+			{
+				"[1, 2, 3][-1]",
+				nil,
+			}}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			number, ok := tt.expected.(int)
+			if ok {
+				testNumberObject(t, evaluated, float64(number))
+			} else {
+				testNullObject(t, evaluated)
+			}
 		}
-	}
+	})
 }
 
 func TestHashLiterals(t *testing.T) {
-	input := `let two = "two";
-{
-           "one": 10 - 9,
-           two: 1 + 1,
-           "thr" + "ee": 6 / 2,
-           4: 4,
-           true: 5,
-           false: 6
-}`
-	evaluated := testEval(input)
-	result, ok := evaluated.(*object.Hash)
-	if !ok {
-		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
-	}
-	expected := map[object.HashKey]float64{(&object.String{Value: "one"}).HashKey(): 1, (&object.String{Value: "two"}).HashKey(): 2, (&object.String{Value: "three"}).HashKey(): 3, (&object.Number{Value: 4}).HashKey(): 4, TRUE.HashKey(): 5, FALSE.HashKey(): 6}
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
-	}
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		input := `let two = "two";
+	{
+	           "one": 10 - 9,
+	           two: 1 + 1,
+	           "thr" + "ee": 6 / 2,
+	           4: 4,
+	           true: 5,
+	           false: 6
+	}`
+		evaluated := testEval(input)
+		result, ok := evaluated.(*object.Hash)
 		if !ok {
-			t.Errorf("no pair for given key in Pairs")
+			t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+		}
+		expected := map[object.HashKey]float64{(&object.String{Value: "one"}).HashKey(): 1, (&object.String{Value: "two"}).HashKey(): 2, (&object.String{Value: "three"}).HashKey(): 3, (&object.Number{Value: 4}).HashKey(): 4, TRUE.HashKey(): 5, FALSE.HashKey(): 6}
+		if len(result.Pairs) != len(expected) {
+			t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+		}
+		for expectedKey, expectedValue := range expected {
+			pair, ok := result.Pairs[expectedKey]
+			if !ok {
+				t.Errorf("no pair for given key in Pairs")
+			}
+			testNumberObject(t, pair.Value, expectedValue)
+		}
+	})
+}
+
+func TestIndexAssignment(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"let a = [1, 2, 3]; a[0] = 10; a[0] + a[1];", 12},
+			{"let a = [1, 2, 3]; let b = a; b[2] = 30; a[2];", 30},
+			{"let a = [1]; a[0] = 5", 5},
+			{"let m = [[1, 2], [3, 4]]; m[1][0] = 30; m[1][0];", 30},
+			{"let a = [0, 0]; let i = 0; while (i < 2) { a[i] = i + 1; i = i + 1; }; a[0] + a[1];", 3},
+			{`let h = {"a": 1}; h["a"] = 2; h["a"];`, 2},
+			{`let h = {}; h["b"] = 3; h[true] = 4; h["b"] + h[true];`, 7},
+			{`let h = {}; let a = [0]; h["x"] = a[0] = 8; h["x"] + a[0];`, 16},
+			{"let a = [1, 2];\na[2] = 3", "[line 2] index out of range: 2 (length 2)"},
+			{"let a = [1, 2];\na[-1] = 3", "[line 2] index out of range: -1 (length 2)"},
+			{`let a = [1]; a["x"] = 1`, "[line 1] array index must be INTEGER, got STRING"},
+			{`let h = {}; h[[]] = 1`, "[line 1] unusable as hash key: ARRAY"},
+			{`let s = "abc"; s[0] = "x"`, "[line 1] index assignment not supported: STRING"},
+		}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case int:
+				testNumberObject(t, evaluated, float64(expected))
+			case string:
+				errObj, ok := evaluated.(*object.Error)
+				if !ok {
+					t.Errorf("no error object returned for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+					continue
+				}
+				if errorMessage(errObj) != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, errorMessage(errObj))
+				}
+			}
+		}
+	})
+}
+
+func TestArithmeticAndBitwiseOperators(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"7 % 3", 1},
+			{"-7 % 3", 2},
+			{"7 % -3", -2},
+			{"-7 % -3", -1},
+			{"7.5 % 2", 1.5},
+			{"-7.5 % 2", 0.5},
+			{"7.5 % -2", -0.5},
+			{"-6.0 % 3", 0.0},
+			{"7 ~/ 2", 3},
+			{"-7 ~/ 2", -4},
+			{"2 ** 10", 1024},
+			{"2 ** 3 ** 2", 512},
+			{"-2 ** 2", -4},
+			{"2 ** -1", 0.5},
+			{"6 & 3", 2},
+			{"6 | 3", 7},
+			{"6 ^ 3", 5},
+			{"~5", -6},
+			{"1 << 10", 1024},
+			{"-16 >> 2", -4},
+			{"1 + 2 << 1", 6},
+			{"6 & 3 | 8 ^ 1", 11},
+			{"let i = 7; i %= 4; i", 3},
+			{"1.5 | 1", "[line 1] bitwise operand must be an integer, got 1.5"},
+			{"~0.5", "[line 1] bitwise operand must be an integer, got 0.5"},
+			{"1 << -1", "[line 1] negative shift count: -1"},
+			{`"a" ** 2`, "[line 1] unknown operator: STRING ** INTEGER"},
+			{"~true", "[line 1] unknown operator: ~BOOLEAN"},
+		}
+		for _, tt := range tests {
+			testValue(t, tt.input, testEval(tt.input), tt.expected)
+		}
+	})
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"7 + 2", 9},
+			{"7 / 2", 3.5},
+			{"6 / 3", 2.0},
+			{"7 ~/ 2", 3},
+			{"-7 ~/ 2", -4},
+			{"7 % -3", -2},
+			{"-7 % 3", 2},
+			{"let m = -9223372036854775807 - 1; m % -1", 0},
+			{"let a = -7; let b = 2; a == (a ~/ b) * b + a % b", true},
+			{"let a = 7; let b = -2; a == (a ~/ b) * b + a % b", true},
+			{"let a = -7.5; let b = 2; a == (a ~/ b) * b + a % b", true},
+			{"1 + 0.5", 1.5},
+			{"2 * 1.5", 3.0},
+			{"7.0 ~/ 2", 3.0},
+			{"2 ** 62", 4611686018427387904},
+			{"2 ** -2", 0.25},
+			{"(-2) ** 63", -9223372036854775808},
+			{"9007199254740993 - 1", 9007199254740992},
+			{"1 == 1.0", true},
+			{"2 > 1.5", true},
+			{"let i = 1; i++; i", 2},
+			{"let x = 1.5; x++; x", 2.5},
+			{"len([1, 2])", 2},
+			{"[1, 2, 3][1.0]", 2},
+			{"[1, 2, 3][0.5]", nil},
+			{`{1: "a", 1.5: "b"}[1]`, "a"},
+			{`{1: "a", 1.5: "b"}[1.5]`, "b"},
+			{`{1: "a"}[1.0]`, "a"},
+			{"let s = 0; for (k in {2: 0, 1.5: 0, 1: 0}) { s = s * 10 + k; }; s", 117.0},
+			{"9223372036854775807 + 1", "[line 1] integer overflow: 9223372036854775807 + 1"},
+			{"-9223372036854775807 - 2", "[line 1] integer overflow: -9223372036854775807 - 2"},
+			{"4294967296 * 4294967296", "[line 1] integer overflow: 4294967296 * 4294967296"},
+			{"2 ** 63", "[line 1] integer overflow: 2 ** 63"},
+			{"let m = -9223372036854775807 - 1;\n-m", "[line 2] integer overflow: -(-9223372036854775808)"},
+			{"let m = 9223372036854775807;\nm++", "[line 2] integer overflow: 9223372036854775807 + 1"},
+			{"1 << 62", 4611686018427387904},
+			{"-1 << 63", -9223372036854775808},
+			{"1 << 63", "[line 1] integer overflow: 1 << 63"},
+			{"1 << 64", "[line 1] integer overflow: 1 << 64"},
+			{"3 << 62", "[line 1] integer overflow: 3 << 62"},
+			{"-3 << 62", "[line 1] integer overflow: -3 << 62"},
+			{"1.0 << 70", "[line 1] integer overflow: 1 << 70"},
+			{"1 ~/ 0", "[line 1] integer division by zero"},
+			{"1 % 0", "[line 1] integer modulo by zero"},
+		}
+		for _, tt := range tests {
+			testValue(t, tt.input, testEval(tt.input), tt.expected)
+		}
+	})
+}
+
+func TestNumberLiteralSyntax(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"0xFF + 0o10 + 0b11", 266},
+			{"1_000_000 ~/ 1_000", 1000},
+			{"0xff & 0x0F", 15},
+			{"6.02e23 == 602_000_000_000_000_000_000_000.0", true},
+			{"1e3", 1000.0},
+			{"2.5E-1 * 4", 1.0},
+		}
+		for _, tt := range tests {
+			testValue(t, tt.input, testEval(tt.input), tt.expected)
+		}
+	})
+}
+
+func TestConditionalAndNullOperators(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		lazy := "let n = {}[0]; let calls = 0; let f = fn(x) { calls += 1; x }; "
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"true ? 1 : 2", 1},
+			{"false ? 1 : 2", 2},
+			{"0 ? 1 : 2", 1},
+			{"false ? 1 : true ? 2 : 3", 2},
+			{"false ? 1 : false ? 2 : 3", 3},
+			{"let x = 5; x = x > 3 ? x * 2 : 0; x", 10},
+			{lazy + "let r = true ? f(1) : f(2); r * 10 + calls", 11},
+			{lazy + "let r = false ? f(1) : f(2); r * 10 + calls", 21},
+			{lazy + "n ?? 4", 4},
+			{lazy + "false ?? 4", false},
+			{lazy + "let r = 3 ?? f(4); r * 10 + calls", 30},
+			{lazy + "n ?? n ?? 5", 5},
+			{lazy + "[1, 2]?[1]", 2},
+			{lazy + `{"k": 3}?["k"]`, 3},
+			{lazy + "n?[f(0)]; calls", 0},
+			{lazy + "n?[0] ?? 6", 6},
+			{lazy + "n?[0]?[1] ?? 7", 7},
+			{lazy + "true ? n?[0] : 1", nil},
+			{"let n = {}[0];\nn[0]", "[line 2] index operator not supported: NULL"},
+			{"let s = 1;\ns?[0]", "[line 2] index operator not supported: INTEGER"},
+		}
+		for _, tt := range tests {
+			testValue(t, tt.input, testEval(tt.input), tt.expected)
+		}
+	})
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"let i = 1; i += 4; i", 5},
+			{"let i = 1; i -= 4; i", -3},
+			{"let i = 3; i *= 4; i", 12},
+			{"let i = 3; i /= 4; i", 0.75},
+			{"let i = 7; i %= 4; i", 3},
+			{"let i = 1; i += i += 2", 4},
+			{`let s = "a"; s += "b"; s`, "ab"},
+			{"let a = [1, 2]; a[1] *= 5; a[1]", 10},
+			{`let h = {"n": 1}; h["n"] += 1; h["n"]`, 2},
+			{"let n = 0; let a = [0, 0]; let f = fn() { n += 1; 1 }; a[f()] += 3; a[1] + 10 * n", 13},
+			{"struct P { x = 1 }; let p = P(); p.x -= 3; p.x", -2},
+			{"let f = fn() { let c = 0; let g = fn() { c += 1 }; g(); g() }; f()", 2},
+			{"let i = 0;\ni += true", "[line 2] type mismatch: INTEGER + BOOLEAN"},
+			{"let h = {};\nh[\"x\"] += 1", "[line 2] type mismatch: NULL + INTEGER"},
+			{"j += 1", "[line 1] identifier not found: j"},
+		}
+		for _, tt := range tests {
+			testValue(t, tt.input, testEval(tt.input), tt.expected)
+		}
+	})
+}
+
+func TestUpdateExpressions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"let i = 0; i++", 0},
+			{"let i = 0; i++; i", 1},
+			{"let i = 0; ++i", 1},
+			{"let i = 0; i--", 0},
+			{"let i = 0; --i", -1},
+			{"let s = 0; for (let i = 0; i < 4; i++) { s += i; }; s", 6},
+			{"let a = [5]; a[0]++ + a[0]", 11},
+			{"let a = [5]; ++a[0] + a[0]", 12},
+			{"let n = 0; let a = [0, 0]; let f = fn() { n++; 1 }; a[f()]++; a[1] + 10 * n", 11},
+			{`let h = {"k": 1}; h["k"]--; h["k"]`, 0},
+			{"struct P { x = 1 }; let p = P(); p.x++ + p.x", 3},
+			{"let f = fn() { let j = 0; let k = j++; j * 10 + k }; f()", 10},
+			{"let f = fn(a) { a[0]++ }; f([7])", 7},
+			{"let s = \"a\";\ns++", "[line 2] unknown operator: ++STRING"},
+		}
+		for _, tt := range tests {
+			testValue(t, tt.input, testEval(tt.input), tt.expected)
+		}
+	})
+}
+
+// testValue checks obj against expected: null, a boolean, an Integer for an
+// int, a Number for a float64, a string,
+// or the message of the error obj must be if expected starts with "[line".
+func testValue(t *testing.T, input string, obj object.Object, expected interface{}) {
+	t.Helper()
+	switch expected := expected.(type) {
+	case nil:
+		testNullObject(t, obj)
+	case bool:
+		testBooleanObject(t, obj, expected, input)
+	case int:
+		testIntegerObject(t, obj, int64(expected))
+	case float64:
+		if _, ok := obj.(*object.Number); !ok {
+			t.Errorf("%q: object is not Number. got=%T (%+v)", input, obj, obj)
+			return
+		}
+		testNumberObject(t, obj, expected)
+	case string:
+		if strings.HasPrefix(expected, "[line") {
+			errObj, ok := obj.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T (%+v)", input, obj, obj)
+			} else if errorMessage(errObj) != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", input, expected, errorMessage(errObj))
+			}
+			return
+		}
+		if s, ok := obj.(*object.String); !ok || s.Value != expected {
+			t.Errorf("%q: expected %q, got=%T (%+v)", input, expected, obj, obj)
 		}
-		testNumberObject(t, pair.Value, expectedValue)
 	}
 }
 
 func TestHashIndexExpressions(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected interface{}
-	}{
-		{
-			`{"foo": 5}["foo"]`,
-			5,
-		}, {
-			`{"foo": 5}["bar"]`,
-			nil},
-		{
-			`let key = "foo"; {"foo": 5}[key]`,
-			5,
-		}, {
-			`{}["foo"]`,
-			nil},
-		{
-			`{5: 5}[5]`,
-			5,
-		}, {
-			`{true: 5}[true]`,
-			5},
-		{
-			`{false: 5}[false]`,
-			5,
-		},
-		{
-			`let obj = {"high": 5};
-obj["high"];`,
-			5,
-		},
-	}
-	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		integer, ok := tt.expected.(int)
-		if ok {
-			testNumberObject(t, evaluated, float64(integer))
-		} else {
-			testNullObject(t, evaluated)
+	forEachEngine(t, func(t *testing.T, testEval evalFunc) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{
+				`{"foo": 5}["foo"]`,
+				5,
+			}, {
+				`{"foo": 5}["bar"]`,
+				nil},
+			{
+				`let key = "foo"; {"foo": 5}[key]`,
+				5,
+			}, {
+				`{}["foo"]`,
+				nil},
+			{
+				`{5: 5}[5]`,
+				5,
+			}, {
+				`{true: 5}[true]`,
+				5},
+			{
+				`{false: 5}[false]`,
+				5,
+			},
+			{
+				`let obj = {"high": 5};
+	obj["high"];`,
+				5,
+			},
 		}
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			integer, ok := tt.expected.(int)
+			if ok {
+				testNumberObject(t, evaluated, float64(integer))
+			} else {
+				testNullObject(t, evaluated)
+			}
+		}
+	})
+}
+
+// evalFunc runs a program and returns its result, with runtime failures
+// returned as an *object.Error.
+type evalFunc func(input string) object.Object
+
+// The tests in this file form a conformance suite for the language: apart
+// from those inspecting the evaluator's own objects, each runs its programs
+// on every engine, which must all give the same results.
+var engines = []struct {
+	name string
+	eval evalFunc
+}{
+	{"evaluator", testEval},
+	{"vm", testVM},
+}
+
+func forEachEngine(t *testing.T, test func(t *testing.T, testEval evalFunc)) {
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			test(t, engine.eval)
+		})
+	}
+}
+
+func testVM(input string) object.Object {
+	tokens := scanner.NewScanner(input).ScanTokens()
+	program := parser.NewParser(tokens).Parse()
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return diagnosticError(err)
+	}
+	env := object.NewEnvironment(nil)
+	for name, builtin := range builtins {
+		env.Set(name, builtin)
+	}
+	result, err := vm.New(comp.Bytecode(), env).Run()
+	if err != nil {
+		return diagnosticError(err)
 	}
+	return result
+}
+
+// diagnosticError converts a compile or VM failure back into the error value
+// the evaluator would have returned.
+func diagnosticError(err error) *object.Error {
+	d := err.(*errors.Diagnostic)
+	return &object.Error{Message: d.Message, Code: d.Code, Span: d.Span}
 }
 
 func testEval(input string) object.Object {
@@ -522,6 +1265,11 @@ func testEval(input string) object.Object {
 	return Eval(program, env)
 }
 
+// errorMessage prefixes the error's message with the line its span starts on.
+func errorMessage(err *object.Error) string {
+	return fmt.Sprintf("[line %d] %s", err.Span.Start.Line, err.Message)
+}
+
 func testNullObject(t *testing.T, obj object.Object) bool {
 	if obj != NULL {
 		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
@@ -530,14 +1278,35 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	return true
 }
 
+// testNumberObject checks that obj is an Integer or a Number equal to
+// expected.
 func testNumberObject(t *testing.T, obj object.Object, expected float64) bool {
-	result, ok := obj.(*object.Number)
+	var value float64
+	switch obj := obj.(type) {
+	case *object.Integer:
+		value = float64(obj.Value)
+	case *object.Number:
+		value = obj.Value
+	default:
+		t.Errorf("object is not Integer or Number. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if value != expected {
+		t.Errorf("object has wrong value. got=%v, want=%v",
+			value, expected)
+		return false
+	}
+	return true
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
 	if !ok {
-		t.Errorf("object is not Number. got=%T (%+v)", obj, obj)
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
 		return false
 	}
 	if result.Value != expected {
-		t.Errorf("object has wrong value. got=%v, want=%v",
+		t.Errorf("object has wrong value. got=%d, want=%d",
 			result.Value, expected)
 		return false
 	}
@@ -0,0 +1,473 @@
+// Package format prints scripts in a canonical layout: one statement per
+// line, blocks indented by four spaces, single spaces around binary
+// operators and a semicolon after every statement that does not end in a
+// block. Comments are kept, before the statement they precede or after the
+// one whose line they end; a comment inside an expression moves after its
+// statement.
+package format
+
+import (
+	"go-compiler/main/ast"
+	"go-compiler/main/errors"
+	"go-compiler/main/parser"
+	"go-compiler/main/scanner"
+	"go-compiler/main/token"
+	"sort"
+	"strings"
+)
+
+const indentation = "    "
+
+// primary is the precedence of expressions that are not operations, such
+// as literals, and so never need parentheses.
+const primary = parser.INDEX + 1
+
+// Source formats the script source. If it does not scan or parse, the
+// diagnostics are returned instead.
+func Source(source string) (string, errors.List) {
+	s := scanner.NewScannerWithTrivia(source)
+	tokens := s.ScanTokens()
+	p := parser.NewParser(tokens)
+	program := p.Parse()
+
+	diagnostics := append(errors.List{}, s.Errors()...)
+	diagnostics = append(diagnostics, p.Errors()...)
+	if diagnostics.HasErrors() {
+		diagnostics.Sort()
+		return "", diagnostics
+	}
+
+	pr := &printer{source: source}
+	for _, t := range tokens {
+		if t.Type == token.COMMENT || t.Type == token.DOC_COMMENT {
+			pr.comments = append(pr.comments, t)
+		}
+	}
+	pr.statements(program.Statements, len(source))
+	return string(pr.out), nil
+}
+
+type printer struct {
+	source   string
+	out      []byte
+	indent   int
+	comments []*token.Token // the comments not printed yet, in source order
+	line     int            // the source line the last line printed ended on, 0 at the start of a block
+}
+
+func (p *printer) write(s string) {
+	p.out = append(p.out, s...)
+}
+
+// statements prints list one statement per line, followed by the comments
+// before end, the offset the list ends at.
+func (p *printer) statements(list []ast.Statement, end int) {
+	semicolon := -1 // where the last statement could take a semicolon
+	for _, s := range list {
+		p.item(s.Span(), func() {
+			start := len(p.out)
+			needsSemicolon := p.statement(s)
+			if semicolon >= 0 && strings.ContainsRune("([-+", rune(p.out[start])) {
+				// Without a semicolon this statement would continue the
+				// block ending the one before it: if (a) { } -1.
+				p.out = append(p.out[:semicolon], append([]byte{';'}, p.out[semicolon:]...)...)
+			}
+			semicolon = -1
+			if needsSemicolon {
+				p.write(";")
+			} else {
+				semicolon = len(p.out)
+			}
+		})
+	}
+	p.commentsBefore(end)
+}
+
+// item prints an element of a block on its own line: the comments before
+// it, a blank line if the source had one there, the element itself, using
+// print, and the comments on the line it ends.
+func (p *printer) item(span token.Span, print func()) {
+	p.commentsBefore(span.Start.Offset)
+	p.separate(span.Start.Line)
+	p.write(strings.Repeat(indentation, p.indent))
+	print()
+	p.trailingComments(span.End)
+	p.write("\n")
+	if span.End.Line > p.line {
+		p.line = span.End.Line
+	}
+}
+
+// separate keeps one blank line before an element starting on line if the
+// source had at least one, except at the start of a block.
+func (p *printer) separate(line int) {
+	if p.line > 0 && line > p.line+1 {
+		p.write("\n")
+	}
+}
+
+// commentsBefore prints the comments before offset, each on its own line.
+func (p *printer) commentsBefore(offset int) {
+	for len(p.comments) > 0 && p.comments[0].Start.Offset < offset {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		p.separate(c.Start.Line)
+		p.write(strings.Repeat(indentation, p.indent) + commentText(c) + "\n")
+		p.line = c.End.Line
+	}
+}
+
+// trailingComments prints after an element the comments inside it and
+// those starting on the line it ends, end. Once a line comment is printed
+// the rest wait for their own lines, as do doc comments, which belong to
+// the element after them.
+func (p *printer) trailingComments(end token.Position) {
+	for len(p.comments) > 0 {
+		c := p.comments[0]
+		if c.Type == token.DOC_COMMENT || c.Start.Offset >= end.Offset && c.Start.Line != end.Line {
+			return
+		}
+		p.comments = p.comments[1:]
+		p.write(" " + commentText(c))
+		p.line = c.End.Line
+		if strings.HasPrefix(c.Lexeme, "//") {
+			return
+		}
+	}
+}
+
+func commentText(c *token.Token) string {
+	return strings.TrimRight(c.Lexeme, " \t\r")
+}
+
+// statement prints s without its indentation and reports whether it needs
+// a semicolon after it.
+func (p *printer) statement(s ast.Statement) bool {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.write("let " + s.Name.Value + " = ")
+		p.expression(s.Value, parser.LOWEST)
+	case *ast.ReturnStatement:
+		p.write("return")
+		if s.ReturnValue != nil {
+			p.write(" ")
+			p.expression(s.ReturnValue, parser.LOWEST)
+		}
+	case *ast.BreakStatement:
+		p.write("break")
+	case *ast.ContinueStatement:
+		p.write("continue")
+	case *ast.StructStatement:
+		p.structStatement(s)
+		return false
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression, parser.LOWEST)
+		switch s.Expression.(type) {
+		case *ast.IfExpression, *ast.WhileExpression, *ast.ForExpression, *ast.ForInExpression:
+			return false
+		}
+	case *ast.BlockStatment:
+		p.block(s)
+		return false
+	}
+	return true
+}
+
+// block prints b, with its statements on their own lines, indented.
+func (p *printer) block(b *ast.BlockStatment) {
+	end := b.EndToken.Start.Offset
+	if len(b.Statements) == 0 && (len(p.comments) == 0 || p.comments[0].Start.Offset >= end) {
+		p.write("{}")
+		return
+	}
+	p.write("{\n")
+	p.indent++
+	p.line = 0
+	p.statements(b.Statements, end)
+	p.indent--
+	p.write(strings.Repeat(indentation, p.indent) + "}")
+	p.line = b.EndToken.End.Line
+}
+
+// structStatement prints s with its fields and methods in source order.
+func (p *printer) structStatement(s *ast.StructStatement) {
+	p.write("struct " + s.Name.Value)
+	if s.Superclass != nil {
+		p.write(" < " + s.Superclass.Value)
+	}
+	end := s.EndToken.Start.Offset
+	type member struct {
+		span  token.Span
+		print func()
+	}
+	members := []member{}
+	for _, f := range s.Fields {
+		f := f
+		span := f.Name.Span()
+		if f.Value != nil {
+			span = span.To(f.Value.Span())
+		}
+		members = append(members, member{span, func() {
+			p.write(f.Name.Value)
+			if f.Value != nil {
+				p.write(" = ")
+				p.expression(f.Value, parser.LOWEST)
+			}
+			p.write(";")
+		}})
+	}
+	for _, m := range s.Methods {
+		m := m
+		members = append(members, member{m.Function.Span(), func() {
+			p.write("fn " + m.Name.Value)
+			p.function(m.Function)
+		}})
+	}
+	if len(members) == 0 && (len(p.comments) == 0 || p.comments[0].Start.Offset >= end) {
+		p.write(" {}")
+		return
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].span.Start.Offset < members[j].span.Start.Offset
+	})
+
+	p.write(" {\n")
+	p.indent++
+	p.line = 0
+	for _, m := range members {
+		p.item(m.span, m.print)
+	}
+	p.commentsBefore(end)
+	p.indent--
+	p.write(strings.Repeat(indentation, p.indent) + "}")
+	p.line = s.EndToken.End.Line
+}
+
+// function prints the parameters and body of fn.
+func (p *printer) function(fn *ast.FunctionLiteral) {
+	params := []string{}
+	for _, param := range fn.Parameters {
+		params = append(params, param.Value)
+	}
+	p.write("(" + strings.Join(params, ", ") + ") ")
+	p.block(fn.Body)
+}
+
+// expression prints e, in parentheses if it binds less tightly than min.
+func (p *printer) expression(e ast.Expression, min int) {
+	if precedence(e) < min {
+		p.write("(")
+		defer p.write(")")
+	}
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.write(e.Value)
+	case *ast.IntegerLiteral, *ast.NumberLiteral, *ast.Boolean, *ast.ThisExpression:
+		p.write(e.TokenLiteral())
+	case *ast.StringLiteral:
+		p.write(p.source[e.Token.Start.Offset:e.Token.End.Offset])
+	case *ast.PrefixExpression:
+		p.write(e.Operator)
+		operand := parser.PREFIX
+		if e.Operator == "-" && startsWithMinus(e.Right) {
+			// Keep - -x from reading as --x.
+			operand = primary
+		}
+		p.expression(e.Right, operand)
+	case *ast.InfixExpression:
+		if e.Token.Type == token.INTERPOLATION {
+			p.interpolation(e)
+			return
+		}
+		p.binary(e.Left, e.Operator, e.Right, e.Token.Type)
+	case *ast.LogicalExpression:
+		p.binary(e.Left, e.Operator, e.Right, e.Token.Type)
+	case *ast.ConditionalExpression:
+		p.expression(e.Condition, parser.CONDITIONAL+1)
+		p.write(" ? ")
+		p.expression(e.Then, parser.LOWEST)
+		p.write(" : ")
+		p.expression(e.Else, parser.CONDITIONAL)
+	case *ast.AssignStatement:
+		p.write(e.Name.Value + " = ")
+		p.expression(e.Value, parser.LOWEST)
+	case *ast.PropertyAssignment:
+		p.expression(e.Target, parser.CALL)
+		p.write(" = ")
+		p.expression(e.Value, parser.LOWEST)
+	case *ast.IndexAssignment:
+		p.expression(e.Target, parser.CALL)
+		p.write(" = ")
+		p.expression(e.Value, parser.LOWEST)
+	case *ast.CompoundAssignment:
+		p.expression(e.Target, parser.CALL)
+		p.write(" " + e.Operator + "= ")
+		p.expression(e.Value, parser.LOWEST)
+	case *ast.UpdateExpression:
+		if e.Prefix {
+			p.write(e.Operator)
+			p.expression(e.Target, parser.PREFIX+1)
+		} else {
+			p.expression(e.Target, parser.CALL)
+			p.write(e.Operator)
+		}
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(e.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(e.Then)
+		if e.Else != nil {
+			p.write(" else ")
+			p.block(e.Else)
+		}
+	case *ast.WhileExpression:
+		p.write("while (")
+		p.expression(e.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(e.Body)
+	case *ast.ForExpression:
+		p.write("for (")
+		if e.Init != nil {
+			p.statement(e.Init)
+		}
+		p.write(";")
+		if e.Condition != nil {
+			p.write(" ")
+			p.expression(e.Condition, parser.LOWEST)
+		}
+		p.write(";")
+		if e.Update != nil {
+			p.write(" ")
+			p.expression(e.Update, parser.LOWEST)
+		}
+		p.write(") ")
+		p.block(e.Body)
+	case *ast.ForInExpression:
+		p.write("for (" + e.Variable.Value + " in ")
+		p.expression(e.Iterable, parser.LOWEST)
+		p.write(") ")
+		p.block(e.Body)
+	case *ast.FunctionLiteral:
+		p.write("fn")
+		p.function(e)
+	case *ast.CallExpression:
+		p.expression(e.Function, parser.CALL)
+		p.write("(")
+		p.list(e.Arguments)
+		p.write(")")
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.list(e.Elements)
+		p.write("]")
+	case *ast.IndexExpression:
+		p.expression(e.Left, parser.CALL)
+		p.write(e.Token.Lexeme)
+		p.expression(e.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.HashLiteral:
+		p.write("{")
+		for i, key := range e.SortedKeys() {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(key, parser.LOWEST)
+			p.write(": ")
+			p.expression(e.Pairs[key], parser.LOWEST)
+		}
+		p.write("}")
+	case *ast.SuperExpression:
+		p.write("super." + e.Method.Value)
+	case *ast.PropertyExpression:
+		p.expression(e.Object, parser.CALL)
+		p.write("." + e.Name.Value)
+	}
+}
+
+// binary prints a binary operation. Operators of the same precedence group
+// to the left, except ** which groups to the right.
+func (p *printer) binary(left ast.Expression, operator string, right ast.Expression, t token.TokenType) {
+	prec := parser.Precedence(t)
+	leftMin, rightMin := prec, prec+1
+	if t == token.STAR_STAR {
+		leftMin, rightMin = prec+1, prec
+	}
+	p.expression(left, leftMin)
+	p.write(" " + operator + " ")
+	p.expression(right, rightMin)
+}
+
+// interpolation prints a string with embedded expressions from the
+// concatenations the parser lowered it to. The concatenation adding an
+// embedded expression and the one adding the text after it share the
+// INTERPOLATION token before the expression.
+func (p *printer) interpolation(e *ast.InfixExpression) {
+	parts := []*ast.InfixExpression{}
+	var first ast.Expression = e
+	for {
+		part, ok := first.(*ast.InfixExpression)
+		if !ok || part.Token.Type != token.INTERPOLATION {
+			break
+		}
+		parts = append([]*ast.InfixExpression{part}, parts...)
+		first = part.Left
+	}
+
+	p.write(`"` + first.TokenLiteral())
+	for i, part := range parts {
+		if i > 0 && part.Token == parts[i-1].Token {
+			p.write(part.Right.TokenLiteral())
+			continue
+		}
+		p.write("${")
+		p.expression(part.Right, parser.LOWEST)
+		p.write("}")
+	}
+	p.write(`"`)
+}
+
+func (p *printer) list(elements []ast.Expression) {
+	for i, e := range elements {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(e, parser.LOWEST)
+	}
+}
+
+// precedence returns how tightly e binds to the operators around it.
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.AssignStatement, *ast.PropertyAssignment, *ast.IndexAssignment, *ast.CompoundAssignment:
+		return parser.ASSIGN
+	case *ast.ConditionalExpression:
+		return parser.CONDITIONAL
+	case *ast.InfixExpression:
+		if e.Token.Type == token.INTERPOLATION {
+			return primary
+		}
+		return parser.Precedence(e.Token.Type)
+	case *ast.LogicalExpression:
+		return parser.Precedence(e.Token.Type)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.UpdateExpression:
+		if e.Prefix {
+			return parser.PREFIX
+		}
+		return parser.CALL
+	case *ast.CallExpression, *ast.IndexExpression, *ast.PropertyExpression:
+		return parser.CALL
+	}
+	return primary
+}
+
+func startsWithMinus(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.PrefixExpression:
+		return e.Operator == "-"
+	case *ast.UpdateExpression:
+		return e.Prefix && e.Operator == "--"
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package format
+
+import (
+	"go-compiler/main/errors"
+	"go-compiler/main/parser"
+	"go-compiler/main/scanner"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1+2*3", "let x = 1 + 2 * 3;\n"},
+		{"let   add = fn(a,b){return a+b}", "let add = fn(a, b) {\n    return a + b;\n};\n"},
+		{"let f = fn() {};", "let f = fn() {};\n"},
+		{"if(a){b}else{c;d}", "if (a) {\n    b;\n} else {\n    c;\n    d;\n}\n"},
+		{"while(i<3){i+=1}", "while (i < 3) {\n    i += 1;\n}\n"},
+		{"for(let i=0;i<3;i++){continue}", "for (let i = 0; i < 3; i++) {\n    continue;\n}\n"},
+		{"for(;;){break}", "for (;;) {\n    break;\n}\n"},
+		{"for(x in [1,2]){print(x)}", "for (x in [1, 2]) {\n    print(x);\n}\n"},
+		{"struct P<Q{x;y=2;fn m(a){return this.x*a}}", "struct P < Q {\n    x;\n    y = 2;\n    fn m(a) {\n        return this.x * a;\n    }\n}\n"},
+		{"struct E {}", "struct E {}\n"},
+		{`{"a":1,"b":[true,null]}`, "{\"a\": 1, \"b\": [true, null]};\n"},
+		{"a.b.c = h?[0] ?? m(--x, y++)", "a.b.c = h?[0] ?? m(--x, y++);\n"},
+		{"struct B<A{fn m(){return super.m()}}", "struct B < A {\n    fn m() {\n        return super.m();\n    }\n}\n"},
+		{"let n = 0xFF + 1_000 + 2.5e3;", "let n = 0xFF + 1_000 + 2.5e3;\n"},
+		{`let s = "a ${ x+1 } b ${"q"}";`, "let s = \"a ${x + 1} b ${\"q\"}\";\n"},
+		{"let r = `raw ${x}`;", "let r = `raw ${x}`;\n"},
+		{`let e = "tab\t";`, "let e = \"tab\\t\";\n"},
+		// Parentheses are kept only where they are needed.
+		{"((a+b))*c", "(a + b) * c;\n"},
+		{"a+(b*c)", "a + b * c;\n"},
+		{"a-(b-c)", "a - (b - c);\n"},
+		{"(a-b)-c", "a - b - c;\n"},
+		{"(2**3)**2", "(2 ** 3) ** 2;\n"},
+		{"2**(3**2)", "2 ** 3 ** 2;\n"},
+		{"(-2)**2", "(-2) ** 2;\n"},
+		{"-(-x)", "-(-x);\n"},
+		{"-(--x)", "-(--x);\n"},
+		{"!(a == b)", "!(a == b);\n"},
+		{"(x = 1) + 2", "(x = 1) + 2;\n"},
+		{"a ? b : (c ? d : e)", "a ? b : c ? d : e;\n"},
+		{"(a ? b : c) ? d : e", "(a ? b : c) ? d : e;\n"},
+		{"a ? b : (c = d)", "a ? b : (c = d);\n"},
+		{"(fn(x){x})(1)", "fn(x) {\n    x;\n}(1);\n"},
+		{"(a + b).c", "(a + b).c;\n"},
+		{"a~/b~/c ~/ d", "a ~/ b ~/ c ~/ d;\n"},
+		{"a ~/ (b ~/ c)", "a ~/ (b ~/ c);\n"},
+		{"(a and b) or c", "a and b or c;\n"},
+		{"a and (b or c)", "a and (b or c);\n"},
+		// A block ending a statement needs a semicolon if the next one
+		// could otherwise continue it.
+		{"if (a) { b };\n-1;", "if (a) {\n    b;\n};\n-1;\n"},
+		{"while (a) { b };\n[c];", "while (a) {\n    b;\n};\n[c];\n"},
+		{"while (a) { b };\n(c);", "while (a) {\n    b;\n}\nc;\n"},
+		{"if (a) { b }\nc;", "if (a) {\n    b;\n}\nc;\n"},
+	}
+
+	for _, tt := range tests {
+		got, diagnostics := Source(tt.input)
+		if diagnostics.HasErrors() {
+			t.Errorf("%q: unexpected errors: %v", tt.input, diagnostics)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot =%q", tt.input, tt.expected, got)
+		}
+		checkFormatted(t, tt.input, got)
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// leading\nlet x = 1; // trailing\n", "// leading\nlet x = 1; // trailing\n"},
+		{"/// The answer.\nlet x=42;", "/// The answer.\nlet x = 42;\n"},
+		{"let a = 1;   \n\n\n\nlet b = 2;\nlet c = 3;", "let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+		{"let f = fn() {\n  // nothing yet\n};", "let f = fn() {\n    // nothing yet\n};\n"},
+		{"let f = fn() {\n  a;\n  // done\n};", "let f = fn() {\n    a;\n    // done\n};\n"},
+		{"let y = 1 /* one */ + 2;", "let y = 1 + 2; /* one */\n"},
+		{"/* a /* nested */ comment */\nx;", "/* a /* nested */ comment */\nx;\n"},
+		{"struct S {\n  x; /// Doubles.\n  fn m() {}\n}", "struct S {\n    x;\n    /// Doubles.\n    fn m() {}\n}\n"},
+		{"let a = 1;\n// end\n", "let a = 1;\n// end\n"},
+		{"let q = 7 ~/ 2; // halved", "let q = 7 ~/ 2; // halved\n"},
+		{"print(x) // show x\nlet y = [1] // arr\n", "print(x); // show x\nlet y = [1]; // arr\n"},
+	}
+
+	for _, tt := range tests {
+		got, diagnostics := Source(tt.input)
+		if diagnostics.HasErrors() {
+			t.Errorf("%q: unexpected errors: %v", tt.input, diagnostics)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot =%q", tt.input, tt.expected, got)
+		}
+		checkFormatted(t, tt.input, got)
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	got, diagnostics := Source("let = 1;\nlet s = \"open")
+	if got != "" {
+		t.Errorf("output for invalid source. got=%q", got)
+	}
+	if len(diagnostics) < 2 {
+		t.Fatalf("wrong number of diagnostics. got=%v", diagnostics)
+	}
+	if diagnostics[0].Code != errors.CodeUnexpectedToken || diagnostics[0].Span.Start.Line != 1 {
+		t.Errorf("wrong first diagnostic. got=%v", diagnostics[0])
+	}
+}
+
+// checkFormatted checks that formatting output again changes nothing and
+// that output means the same as the input it was formatted from.
+func checkFormatted(t *testing.T, input, output string) {
+	t.Helper()
+	again, diagnostics := Source(output)
+	if diagnostics.HasErrors() {
+		t.Errorf("%q: output does not parse: %v", input, diagnostics)
+		return
+	}
+	if again != output {
+		t.Errorf("%q: formatting is not idempotent.\nonce =%q\ntwice=%q", input, output, again)
+	}
+	if want, got := parse(input), parse(output); want != got {
+		t.Errorf("%q: output parses differently.\nwant=%q\ngot =%q", input, want, got)
+	}
+}
+
+func parse(source string) string {
+	return parser.NewParser(scanner.NewScanner(source).ScanTokens()).Parse().String()
+}
@@ -0,0 +1,62 @@
+package lox
+
+import (
+	"fmt"
+	"go-compiler/main/ast"
+	"go-compiler/main/errors"
+	"go-compiler/main/scanner"
+	"go-compiler/main/token"
+)
+
+// PrintTokens prints the tokens the scanner produces for the script at path,
+// one per line with the position each starts at.
+func (l *Lox) PrintTokens(path string) {
+	source := l.readFile(path)
+	s := scanner.NewScanner(source)
+	for _, tok := range s.ScanTokens() {
+		fmt.Fprintln(l.interpreter.stdout, formatToken(tok))
+	}
+	l.report(path, source, s.Errors())
+	l.ExitOnError()
+}
+
+// PrintAST prints the syntax tree of the script at path as an indented tree.
+func (l *Lox) PrintAST(path string) {
+	source := l.readFile(path)
+	program, diagnostics := Parse(source)
+	if !l.report(path, source, diagnostics) {
+		fmt.Fprint(l.interpreter.stdout, ast.Dump(program))
+	}
+	l.ExitOnError()
+}
+
+// PrintGlobals prints the bindings of the global scope, with the type of each
+// value, so the effect of the scripts run so far can be inspected.
+func (l *Lox) PrintGlobals() {
+	for _, name := range l.interpreter.GlobalNames() {
+		value, _ := l.interpreter.Global(name)
+		fmt.Fprintf(l.interpreter.stdout, "%s: %s = %s\n", name, value.Type(), value.Inspect())
+	}
+}
+
+// report renders diagnostics to stderr and reports whether any of them were
+// errors, recording it if so. Warnings alone do not stop a script.
+func (l *Lox) report(path, source string, diagnostics errors.List) bool {
+	if len(diagnostics) == 0 {
+		return false
+	}
+	fmt.Fprint(l.interpreter.stderr, errors.NewRenderer(path, source).RenderAll(diagnostics))
+	if !diagnostics.HasErrors() {
+		return false
+	}
+	l.hadError = true
+	return true
+}
+
+func formatToken(tok *token.Token) string {
+	out := fmt.Sprintf("%d:%d\t%s\t%q", tok.Start.Line, tok.Start.Column, tok.Type, tok.Lexeme)
+	if tok.Literal != nil {
+		out += fmt.Sprintf("\t%v", tok.Literal)
+	}
+	return out
+}
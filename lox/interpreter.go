@@ -0,0 +1,231 @@
+package lox
+
+import (
+	"bufio"
+	"go-compiler/main/ast"
+	"go-compiler/main/compiler"
+	"go-compiler/main/errors"
+	"go-compiler/main/evaluator"
+	"go-compiler/main/object"
+	"go-compiler/main/token"
+	"go-compiler/main/vm"
+	"io"
+	"os"
+	"sort"
+)
+
+// Engine selects how an Interpreter runs scripts.
+type Engine int
+
+const (
+	// EngineEvaluator walks the syntax tree of a script directly.
+	EngineEvaluator Engine = iota
+	// EngineVM compiles scripts to bytecode and runs them on a virtual
+	// machine.
+	EngineVM
+)
+
+// Config holds the engine an Interpreter runs scripts with, and the streams
+// its builtins, and the REPL built on it, read from and write to. Nil streams
+// default to the process's own.
+type Config struct {
+	Engine Engine
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+}
+
+// Interpreter is an embeddable instance of the language. Host programs use it
+// to expose Go functions and values to scripts, evaluate source and call the
+// functions scripts define. Each Interpreter has its own globals, so separate
+// instances can be used concurrently.
+type Interpreter struct {
+	engine   Engine
+	builtins *object.Environment // standard and host-registered functions
+	globals  *object.Environment // bindings made by scripts and SetGlobal
+	stdout   io.Writer
+	stderr   io.Writer
+	stdin    *bufio.Reader
+
+	// The VM keeps globals in slots named by the symbol table instead, and
+	// the constants of everything compiled so far.
+	symbols     *compiler.SymbolTable
+	constants   []object.Object
+	globalSlots []object.Object
+}
+
+func NewInterpreter() *Interpreter {
+	return NewInterpreterWithConfig(Config{})
+}
+
+func NewInterpreterWithConfig(config Config) *Interpreter {
+	if config.Stdout == nil {
+		config.Stdout = os.Stdout
+	}
+	if config.Stderr == nil {
+		config.Stderr = os.Stderr
+	}
+	if config.Stdin == nil {
+		config.Stdin = os.Stdin
+	}
+
+	i := &Interpreter{
+		engine:   config.Engine,
+		builtins: object.NewEnvironment(nil),
+		stdout:   config.Stdout,
+		stderr:   config.Stderr,
+		stdin:    bufio.NewReader(config.Stdin),
+	}
+	i.globals = object.NewEnvironment(i.builtins)
+	if i.engine == EngineVM {
+		i.symbols = compiler.NewSymbolTable()
+		i.constants = []object.Object{}
+		i.globalSlots = make([]object.Object, vm.GlobalsSize)
+	}
+	for name, builtin := range evaluator.NewBuiltins(i.stdout, i.stdin) {
+		i.builtins.Set(name, builtin)
+	}
+	return i
+}
+
+// Register exposes fn to scripts under name. Registered functions replace any
+// standard builtin of the same name, and are shadowed by globals.
+func (i *Interpreter) Register(name string, fn object.BuiltinFunction) {
+	i.builtins.Set(name, &object.Builtin{Fn: fn})
+}
+
+// RegisterFunc exposes the Go function fn to scripts under name, converting
+// arguments and results as described by object.WrapFunc.
+func (i *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	builtin, err := object.WrapFunc(fn)
+	if err != nil {
+		return err
+	}
+	i.builtins.Set(name, builtin)
+	return nil
+}
+
+// SetGlobal binds name to value in the global scope.
+func (i *Interpreter) SetGlobal(name string, value object.Object) {
+	if i.engine == EngineVM {
+		i.globalSlots[i.symbols.Define(name).Index] = value
+		return
+	}
+	i.globals.Set(name, value)
+}
+
+// SetGlobalValue binds name to the script value converted from the Go value v
+// by object.FromGo.
+func (i *Interpreter) SetGlobalValue(name string, v interface{}) error {
+	value, err := object.FromGo(v)
+	if err != nil {
+		return err
+	}
+	i.SetGlobal(name, value)
+	return nil
+}
+
+// Global returns the value bound to name in the global scope.
+func (i *Interpreter) Global(name string) (object.Object, bool) {
+	if i.engine == EngineVM {
+		if symbol, ok := i.symbols.Resolve(name); ok && i.globalSlots[symbol.Index] != nil {
+			return i.globalSlots[symbol.Index], true
+		}
+		return i.builtins.Get(name)
+	}
+	return i.globals.Get(name)
+}
+
+// GlobalNames returns the names bound in the global scope, by scripts or
+// SetGlobal, in sorted order. Builtins are not included.
+func (i *Interpreter) GlobalNames() []string {
+	if i.engine != EngineVM {
+		return i.globals.Names()
+	}
+	names := []string{}
+	for index, name := range i.symbols.Names() {
+		if i.globalSlots[index] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Eval runs source against the interpreter's globals and returns the value of
+// its last statement. Scan, parse and compile failures are returned as an
+// errors.List; a runtime failure is returned as an *errors.Diagnostic.
+func (i *Interpreter) Eval(source string) (object.Object, error) {
+	obj, err := i.eval(source)
+	if obj == nil && err == nil {
+		return evaluator.NULL, nil
+	}
+	return obj, err
+}
+
+// EvalProgram runs an already parsed program, such as one loaded from a
+// precompiled file, the way Eval runs source.
+func (i *Interpreter) EvalProgram(program *ast.Program) (object.Object, error) {
+	obj, err := i.run(program)
+	if obj == nil && err == nil {
+		return evaluator.NULL, nil
+	}
+	return obj, err
+}
+
+// eval is Eval without the conversion of a missing result to null, so the
+// REPL can tell declarations, which print nothing, from expressions.
+func (i *Interpreter) eval(source string) (object.Object, error) {
+	program, diagnostics := Parse(source)
+	if diagnostics.HasErrors() {
+		return nil, diagnostics
+	}
+	return i.run(program)
+}
+
+func (i *Interpreter) run(program *ast.Program) (object.Object, error) {
+	if i.engine == EngineVM {
+		comp := compiler.NewWithState(i.symbols, i.constants)
+		// A program that does not compile never ran, so its errors are
+		// returned like parse errors rather than as a runtime failure.
+		if err := comp.Compile(program); err != nil {
+			if d, ok := err.(*errors.Diagnostic); ok {
+				return nil, errors.List{d}
+			}
+			return nil, err
+		}
+		bytecode := comp.Bytecode()
+		i.constants = bytecode.Constants
+		return vm.NewWithGlobals(bytecode, i.builtins, i.globalSlots).Run()
+	}
+	result := evaluator.Eval(program, i.globals)
+	if err, ok := result.(*object.Error); ok {
+		return nil, err.Diagnostic()
+	}
+	return result, nil
+}
+
+// Call calls the function bound to fnName with args, as if a script had
+// called it.
+func (i *Interpreter) Call(fnName string, args ...object.Object) (object.Object, error) {
+	fn, ok := i.Global(fnName)
+	if !ok {
+		return nil, errors.Errorf(errors.CodeUndefined, token.Span{}, "identifier not found: %s", fnName)
+	}
+	if i.engine == EngineVM {
+		bytecode := &compiler.Bytecode{Globals: i.symbols.Names()}
+		result, err := vm.NewWithGlobals(bytecode, i.builtins, i.globalSlots).Call(fn, args...)
+		if result == nil && err == nil {
+			result = evaluator.NULL
+		}
+		return result, err
+	}
+	switch result := evaluator.Apply(fn, args).(type) {
+	case nil:
+		return evaluator.NULL, nil
+	case *object.Error:
+		return nil, result.Diagnostic()
+	default:
+		return result, nil
+	}
+}
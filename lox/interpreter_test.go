@@ -0,0 +1,210 @@
+package lox
+
+import (
+	"bytes"
+	"go-compiler/main/errors"
+	"go-compiler/main/object"
+	"strings"
+	"testing"
+)
+
+func TestInterpreterRegister(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		interp := NewInterpreterWithConfig(Config{Engine: engine})
+		interp.Register("upper", func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return object.NewError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return object.NewError("argument to `upper` must be STRING, got %s", args[0].Type())
+			}
+			return &object.String{Value: strings.ToUpper(str.Value)}
+		})
+
+		result, err := interp.Eval(`upper("monkey")`)
+		if err != nil {
+			t.Fatalf("Eval returned error: %v", err)
+		}
+		if result.Inspect() != "MONKEY" {
+			t.Errorf("wrong result. want=%q, got=%q", "MONKEY", result.Inspect())
+		}
+
+		_, err = interp.Eval(`upper(1)`)
+		diagnostic, ok := err.(*errors.Diagnostic)
+		if !ok {
+			t.Fatalf("err is not *errors.Diagnostic. got=%T (%v)", err, err)
+		}
+		if diagnostic.Message != "argument to `upper` must be STRING, got INTEGER" {
+			t.Errorf("wrong error message. got=%q", diagnostic.Message)
+		}
+		if diagnostic.Span.Start.Column != 1 || diagnostic.Span.End.Column != 9 {
+			t.Errorf("wrong error span. got=%v", diagnostic.Span)
+		}
+	})
+}
+
+func TestInterpreterGlobals(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		interp := NewInterpreterWithConfig(Config{Engine: engine})
+		interp.SetGlobal("limit", &object.Number{Value: 10})
+
+		if _, err := interp.Eval("let double = limit * 2;"); err != nil {
+			t.Fatalf("Eval returned error: %v", err)
+		}
+		double, ok := interp.Global("double")
+		if !ok {
+			t.Fatalf("global double not defined")
+		}
+		if double.Inspect() != "20" {
+			t.Errorf("wrong value for double. want=%q, got=%q", "20", double.Inspect())
+		}
+
+		result, err := interp.Eval("let x = 1;")
+		if err != nil {
+			t.Fatalf("Eval returned error: %v", err)
+		}
+		if result.Type() != object.NULL_OBJ {
+			t.Errorf("declaration did not evaluate to null. got=%T", result)
+		}
+	})
+}
+
+func TestInterpreterCall(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		interp := NewInterpreterWithConfig(Config{Engine: engine})
+		if _, err := interp.Eval("let add = fn(x, y) { x + y };"); err != nil {
+			t.Fatalf("Eval returned error: %v", err)
+		}
+
+		result, err := interp.Call("add", &object.Number{Value: 2}, &object.Number{Value: 3})
+		if err != nil {
+			t.Fatalf("Call returned error: %v", err)
+		}
+		if result.Inspect() != "5" {
+			t.Errorf("wrong result. want=%q, got=%q", "5", result.Inspect())
+		}
+
+		result, err = interp.Call("len", &object.String{Value: "four"})
+		if err != nil {
+			t.Fatalf("Call returned error: %v", err)
+		}
+		if result.Inspect() != "4" {
+			t.Errorf("wrong result. want=%q, got=%q", "4", result.Inspect())
+		}
+
+		tests := []struct {
+			fnName          string
+			args            []object.Object
+			expectedMessage string
+		}{
+			{"missing", nil, "identifier not found: missing"},
+			{"add", []object.Object{&object.Number{Value: 1}}, "wrong number of arguments. got=1, want=2"},
+		}
+		for _, tt := range tests {
+			_, err := interp.Call(tt.fnName, tt.args...)
+			diagnostic, ok := err.(*errors.Diagnostic)
+			if !ok {
+				t.Errorf("err is not *errors.Diagnostic. got=%T (%v)", err, err)
+				continue
+			}
+			if diagnostic.Message != tt.expectedMessage {
+				t.Errorf("wrong error message. want=%q, got=%q", tt.expectedMessage, diagnostic.Message)
+			}
+		}
+	})
+}
+
+func TestInterpreterParseErrors(t *testing.T) {
+	_, err := NewInterpreter().Eval("let = 1;")
+	list, ok := err.(errors.List)
+	if !ok {
+		t.Fatalf("err is not errors.List. got=%T (%v)", err, err)
+	}
+	if len(list) != 1 {
+		t.Errorf("wrong number of diagnostics. want=1, got=%d", len(list))
+	}
+}
+
+func TestInterpreterRegisterFunc(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		interp := NewInterpreterWithConfig(Config{Engine: engine})
+		err := interp.RegisterFunc("greet", func(name string, times int) (string, error) {
+			return strings.Repeat("hi "+name+"! ", times), nil
+		})
+		if err != nil {
+			t.Fatalf("RegisterFunc returned error: %v", err)
+		}
+		err = interp.SetGlobalValue("config", map[string]interface{}{"name": "monkey", "times": 2})
+		if err != nil {
+			t.Fatalf("SetGlobalValue returned error: %v", err)
+		}
+
+		result, err := interp.Eval(`greet(config["name"], config["times"])`)
+		if err != nil {
+			t.Fatalf("Eval returned error: %v", err)
+		}
+		var greeting string
+		if err := object.Decode(result, &greeting); err != nil {
+			t.Fatalf("Decode returned error: %v", err)
+		}
+		if greeting != "hi monkey! hi monkey! " {
+			t.Errorf("wrong result. got=%q", greeting)
+		}
+
+		_, err = interp.Eval(`greet("monkey", 1.5)`)
+		if err == nil || err.(*errors.Diagnostic).Message != "argument 2: cannot use 1.5 as int" {
+			t.Errorf("wrong error for bad argument. got=%v", err)
+		}
+	})
+}
+
+func TestInterpreterConfigStreams(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		var stdout bytes.Buffer
+		interp := NewInterpreterWithConfig(Config{
+			Engine: engine,
+			Stdout: &stdout,
+			Stdin:  strings.NewReader("Ada\r\nsecond line\nlast"),
+		})
+
+		input := `
+	let name = input("name? ");
+	print("hello", name);
+	let lines = [readLine(), readLine(), readLine()];
+	lines;
+	`
+		result, err := interp.Eval(input)
+		if err != nil {
+			t.Fatalf("Eval returned error: %v", err)
+		}
+		if result.Inspect() != "[second line, last, null]" {
+			t.Errorf("wrong lines read. got=%q", result.Inspect())
+		}
+		if stdout.String() != "name? hello Ada \n" {
+			t.Errorf("wrong output. got=%q", stdout.String())
+		}
+
+		_, err = interp.Eval(`readLine(1)`)
+		if err == nil || !strings.Contains(err.Error(), "wrong number of arguments. got=1, want=0") {
+			t.Errorf("expected arity error, got=%v", err)
+		}
+	})
+}
+
+// forEachEngine runs test against an interpreter for each engine, since the
+// host API must behave the same whichever one runs the scripts.
+func forEachEngine(t *testing.T, test func(t *testing.T, engine Engine)) {
+	engines := []struct {
+		name   string
+		engine Engine
+	}{
+		{"evaluator", EngineEvaluator},
+		{"vm", EngineVM},
+	}
+	for _, e := range engines {
+		t.Run(e.name, func(t *testing.T) {
+			test(t, e.engine)
+		})
+	}
+}
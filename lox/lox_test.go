@@ -1,5 +1,14 @@
 package lox
 
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
 // import (
 // 	"go-compiler/main/token"
 // 	"testing"
@@ -123,3 +132,218 @@ package lox
 // 		}
 // 	}
 // }
+
+func TestParseDiagnostics(t *testing.T) {
+	input := "let a = @;\nlet b = ;"
+	_, diagnostics := Parse(input)
+
+	expected := []string{
+		"[line 1:9] error: Unexpected character.",
+		"[line 1:10] error: expected expression, got ; at ';'",
+		"[line 2:9] error: expected expression, got ; at ';'",
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. want=%d, got=%d: %v",
+			len(expected), len(diagnostics), diagnostics)
+	}
+	for i, want := range expected {
+		if diagnostics[i].Error() != want {
+			t.Errorf("diagnostic %d wrong. want=%q, got=%q", i, want, diagnostics[i].Error())
+		}
+	}
+}
+
+func TestErrorStateIsPerInstance(t *testing.T) {
+	inputs := []string{"let a = ;", "let b = 1;", "1 + true;", "let c = ;", "let d = 2;"}
+	loxes := make([]*Lox, len(inputs))
+
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		loxes[i] = NewLox()
+		wg.Add(1)
+		go func(l *Lox, input string) {
+			defer wg.Done()
+			l.Run(input)
+		}(loxes[i], input)
+	}
+	wg.Wait()
+
+	expected := []struct{ hadError, hadRuntimeError bool }{
+		{true, false}, {false, false}, {false, true}, {true, false}, {false, false},
+	}
+	for i, want := range expected {
+		if loxes[i].HadError() != want.hadError {
+			t.Errorf("%q: HadError wrong. want=%t, got=%t", inputs[i], want.hadError, loxes[i].HadError())
+		}
+		if loxes[i].HadRuntimeError() != want.hadRuntimeError {
+			t.Errorf("%q: HadRuntimeError wrong. want=%t, got=%t", inputs[i],
+				want.hadRuntimeError, loxes[i].HadRuntimeError())
+		}
+	}
+}
+
+func TestCompileErrorsAreStatic(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	l := NewLoxWithConfig(Config{Engine: EngineVM, Stdout: &stdout, Stderr: &stderr})
+
+	l.Run("print(1);\n[" + strings.Repeat("0,\n", 1<<16) + "0];")
+
+	if !l.HadError() || l.HadRuntimeError() {
+		t.Errorf("wrong error state. HadError=%t, HadRuntimeError=%t", l.HadError(), l.HadRuntimeError())
+	}
+	if stdout.Len() != 0 || !strings.Contains(stderr.String(), "error[E0300]: too many elements in array literal") {
+		t.Errorf("wrong output. stdout=%q, stderr=%q", stdout.String(), stderr.String())
+	}
+}
+
+func TestLoxConfigStreams(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	l := NewLoxWithConfig(Config{Stdout: &stdout, Stderr: &stderr})
+
+	l.Run(`print("out"); 1 + 2;`)
+	l.Run(`1 + true;`)
+
+	if stdout.String() != "out \n3\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "error[E0201]") {
+		t.Errorf("expected diagnostic on stderr. got=%q", stderr.String())
+	}
+}
+
+func TestWarningsDoNotStopScripts(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	l := NewLoxWithConfig(Config{Stdout: &stdout, Stderr: &stderr})
+
+	l.Run("let q = 7 // 2\nprint(q, 7 ~/ 2) // show q")
+
+	if l.HadError() || stdout.String() != "7 3 \nnull\n" {
+		t.Errorf("script did not run. stdout=%q, stderr=%q", stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "warning[W0001]") || strings.Count(stderr.String(), "warning") != 1 {
+		t.Errorf("wrong warnings. got=%q", stderr.String())
+	}
+}
+
+func TestInspectionModes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.lox")
+	if err := os.WriteFile(path, []byte("let a = [1];\nlet b = a[0] + 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	l := NewLoxWithConfig(Config{Stdout: &stdout})
+	l.PrintTokens(path)
+	tokens := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(tokens) != 18 || tokens[0] != "1:1\tLET\t\"let\"" || tokens[17] != "2:18\tEOF\t\"\"" {
+		t.Errorf("wrong tokens. got=%q", tokens)
+	}
+
+	stdout.Reset()
+	l.PrintAST(path)
+	if !strings.Contains(stdout.String(), "  LetStatement b (2:1)\n    InfixExpression + (2:9)\n      IndexExpression (2:9)\n") {
+		t.Errorf("wrong AST. got=%s", stdout.String())
+	}
+
+	for _, engine := range []Engine{EngineEvaluator, EngineVM} {
+		stdout.Reset()
+		l := NewLoxWithConfig(Config{Engine: engine, Stdout: &stdout})
+		l.RunFile(path)
+		l.PrintGlobals()
+		if stdout.String() != "a: ARRAY = [1]\nb: INTEGER = 2\n" {
+			t.Errorf("engine %d: wrong globals. got=%q", engine, stdout.String())
+		}
+	}
+
+	// The globals a failing script defined are still there to inspect.
+	if err := os.WriteFile(path, []byte(`let a = 1; let b = "x"; print(c);`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, engine := range []Engine{EngineEvaluator, EngineVM} {
+		var stdout, stderr bytes.Buffer
+		l := NewLoxWithConfig(Config{Engine: engine, Stdout: &stdout, Stderr: &stderr})
+		l.RunFile(path)
+		l.PrintGlobals()
+		if !l.HadRuntimeError() || stdout.String() != "a: INTEGER = 1\nb: STRING = x\n" {
+			t.Errorf("engine %d: wrong globals after error. got=%q, stderr=%q", engine, stdout.String(), stderr.String())
+		}
+	}
+}
+
+func TestBuildAndRunPrecompiled(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.lox")
+	built := filepath.Join(dir, "script.loxc")
+	if err := os.WriteFile(script, []byte("let double = fn(x) { x * 2 };\nprint(double(21));"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	NewLox().BuildFile(script, built)
+
+	for _, engine := range []Engine{EngineEvaluator, EngineVM} {
+		var fromSource, fromBuilt bytes.Buffer
+		NewLoxWithConfig(Config{Engine: engine, Stdout: &fromSource}).RunFile(script)
+		NewLoxWithConfig(Config{Engine: engine, Stdout: &fromBuilt}).RunFile(built)
+		if !strings.HasPrefix(fromBuilt.String(), "42 \n") || fromBuilt.String() != fromSource.String() {
+			t.Errorf("engine %d: wrong output. want=%q, got=%q", engine, fromSource.String(), fromBuilt.String())
+		}
+	}
+
+	data, err := os.ReadFile(built)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(built, data[:len(data)-1], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	l := NewLoxWithConfig(Config{Stderr: &stderr})
+	l.runPrecompiled(built, data[:len(data)-1])
+	if !l.HadError() || !strings.Contains(stderr.String(), "unexpected end of data") {
+		t.Errorf("truncated program was not rejected. stderr=%q", stderr.String())
+	}
+}
+
+func TestFormatFile(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.lox")
+	if err := os.WriteFile(script, []byte("let x=1 // one\nprint( x )"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := "let x = 1; // one\nprint(x);\n"
+
+	var stdout bytes.Buffer
+	l := NewLoxWithConfig(Config{Stdout: &stdout})
+	if l.FormatFile(script, false, false) || stdout.String() != want {
+		t.Errorf("wrong formatted output. want=%q, got=%q", want, stdout.String())
+	}
+
+	stdout.Reset()
+	if l.FormatFile(script, false, true) || stdout.String() != script+"\n" {
+		t.Errorf("unformatted file not listed. got=%q", stdout.String())
+	}
+
+	stdout.Reset()
+	l.FormatFile(script, true, false)
+	data, err := os.ReadFile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want || stdout.Len() != 0 {
+		t.Errorf("wrong file written. want=%q, got=%q, stdout=%q", want, data, stdout.String())
+	}
+	if !l.FormatFile(script, false, true) || stdout.Len() != 0 {
+		t.Errorf("formatted file listed. got=%q", stdout.String())
+	}
+
+	var stderr bytes.Buffer
+	l = NewLoxWithConfig(Config{Stderr: &stderr})
+	if err := os.WriteFile(script, []byte("let = 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if l.FormatFile(script, true, false) || !l.HadError() || !strings.Contains(stderr.String(), "script.lox:1:5") {
+		t.Errorf("invalid script was not reported. stderr=%q", stderr.String())
+	}
+	if data, _ := os.ReadFile(script); string(data) != "let = 1;" {
+		t.Errorf("invalid script was rewritten. got=%q", data)
+	}
+}
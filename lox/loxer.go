@@ -1,35 +1,149 @@
 package lox
 
 import (
-	"bufio"
 	"fmt"
+	"go-compiler/main/ast"
 	"go-compiler/main/errors"
-	"go-compiler/main/evaluator"
+	"go-compiler/main/format"
+	"go-compiler/main/loxc"
 	"go-compiler/main/object"
 	"go-compiler/main/parser"
 	"go-compiler/main/scanner"
+	"io"
 	"os"
 	"os/user"
+	"strings"
 )
 
+// Lox runs scripts from the command line and tracks whether any of them
+// failed. Each Lox keeps its own interpreter and error state, so separate
+// instances can run scripts concurrently.
 type Lox struct {
+	interpreter     *Interpreter
+	hadError        bool
+	hadRuntimeError bool
 }
 
 func NewLox() *Lox {
-	return &Lox{}
+	return &Lox{interpreter: NewInterpreter()}
 }
 
+// NewLoxWithConfig returns a Lox whose scripts, results and diagnostics use
+// the streams in config.
+func NewLoxWithConfig(config Config) *Lox {
+	return &Lox{interpreter: NewInterpreterWithConfig(config)}
+}
+
+// HadError reports whether a script failed to scan, parse or compile.
+func (l *Lox) HadError() bool {
+	return l.hadError
+}
+
+// HadRuntimeError reports whether a script failed while being evaluated.
+func (l *Lox) HadRuntimeError() bool {
+	return l.hadRuntimeError
+}
+
+// RunFile runs the script at path, which may be source or a program
+// precompiled by BuildFile. It does not exit if the script fails, so the
+// state the script left can still be inspected; call ExitOnError after.
 func (l *Lox) RunFile(path string) {
+	source := l.readFile(path)
+	if loxc.IsPrecompiled([]byte(source)) {
+		l.runPrecompiled(path, []byte(source))
+	} else {
+		l.run(path, source)
+	}
+}
+
+// BuildFile parses the script at path and writes it to out as a precompiled
+// program, so it can be run without being scanned and parsed again.
+func (l *Lox) BuildFile(path, out string) {
+	source := l.readFile(path)
+	program, diagnostics := Parse(source)
+	if l.report(path, source, diagnostics) {
+		l.ExitOnError()
+	}
+	data, err := loxc.Encode(program)
+	if err == nil {
+		err = os.WriteFile(out, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(l.interpreter.stderr, "Error writing %s: %s\n", out, err)
+		os.Exit(74)
+	}
+}
+
+// FormatFile formats the script at path and reports whether it was already
+// formatted. With write the result replaces the script if it differs, with
+// check the path is printed if it differs, and otherwise the result is
+// printed. A script that does not parse is reported and left as it is.
+func (l *Lox) FormatFile(path string, write, check bool) bool {
+	source := l.readFile(path)
+	formatted, diagnostics := format.Source(source)
+	if l.report(path, source, diagnostics) {
+		return false
+	}
+	changed := formatted != source
+	switch {
+	case check:
+		if changed {
+			fmt.Fprintln(l.interpreter.stdout, path)
+		}
+	case write:
+		if changed {
+			if err := os.WriteFile(path, []byte(formatted), 0o644); err != nil {
+				fmt.Fprintf(l.interpreter.stderr, "Error writing %s: %s\n", path, err)
+				os.Exit(74)
+			}
+		}
+	default:
+		fmt.Fprint(l.interpreter.stdout, formatted)
+	}
+	return !changed
+}
+
+func (l *Lox) runPrecompiled(path string, data []byte) {
+	program, err := loxc.Decode(data)
+	if err != nil {
+		fmt.Fprintf(l.interpreter.stderr, "Error loading %s: %s\n", path, err)
+		l.hadError = true
+		return
+	}
+	// The source is not available, so diagnostics only give positions.
+	renderer := errors.NewRenderer(path, "")
+	eval, err := l.interpreter.run(program)
+	if list, ok := err.(errors.List); ok {
+		l.report(path, "", list)
+		return
+	}
+	if err != nil {
+		l.reportRuntime(renderer, err)
+		return
+	}
+	l.printResult(eval)
+}
+
+// readFile returns the contents of the script at path, exiting if it cannot
+// be read.
+func (l *Lox) readFile(path string) string {
 	b, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Println("Error reading file")
+		fmt.Fprintln(l.interpreter.stderr, "Error reading file")
 		os.Exit(74)
 	}
-	env := object.NewEnvironment(nil)
-	l.Run(string(b), env)
-	if errors.HadError {
+	return string(b)
+}
+
+// ExitOnError exits with the status for the kind of error the last script
+// had, if it had one.
+func (l *Lox) ExitOnError() {
+	if l.hadError {
 		os.Exit(65)
 	}
+	if l.hadRuntimeError {
+		os.Exit(70)
+	}
 }
 
 func (l *Lox) RunPrompt() {
@@ -37,41 +151,82 @@ func (l *Lox) RunPrompt() {
 	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("Welcome to %s! Let's get down to monkey business!\n", u.Username)
-	fmt.Println("Explore mokey by writting some code:")
-	env := object.NewEnvironment(nil)
+	stdout := l.interpreter.stdout
+	fmt.Fprintf(stdout, "Welcome to %s! Let's get down to monkey business!\n", u.Username)
+	fmt.Fprintln(stdout, "Explore mokey by writting some code:")
+	// Share the interpreter's reader so input() sees the lines after the
+	// one being run.
+	reader := l.interpreter.stdin
 	for {
-		fmt.Print("> ")
-		reader := bufio.NewReader(os.Stdin)
-		// Potetially use ReadBytes('\n') instead
-		line, _, err := reader.ReadLine()
-		if err != nil {
-			fmt.Println("Error reading input")
-			os.Exit(74)
+		fmt.Fprint(stdout, "> ")
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			fmt.Fprintln(stdout)
+			return
 		}
-		if line == nil {
-			break
+		if err != nil && err != io.EOF {
+			fmt.Fprintln(l.interpreter.stderr, "Error reading input")
+			os.Exit(74)
 		}
-		if string(line) == "exit" {
+		line = strings.TrimRight(line, "\r\n")
+		if line == "exit" {
 			return
 		}
-		l.Run(string(line), env)
-		errors.HadError = false
+		l.Run(line)
+		l.hadError = false
+		l.hadRuntimeError = false
 	}
 }
 
-func (l *Lox) Run(source string, env *object.Environment) {
-	scanner := scanner.NewScanner(source)
-	tokens := scanner.ScanTokens()
-	p := parser.NewParser(tokens)
-	program := p.Parse()
-	if len(p.Errors()) != 0 {
+// Run evaluates source in the global scope shared by every script this Lox
+// runs, printing the result or any diagnostics.
+func (l *Lox) Run(source string) {
+	l.run("<stdin>", source)
+}
+
+func (l *Lox) run(filename string, source string) {
+	program, diagnostics := Parse(source)
+	if l.report(filename, source, diagnostics) {
 		return
 	}
+	renderer := errors.NewRenderer(filename, source)
+	eval, err := l.interpreter.run(program)
+	if list, ok := err.(errors.List); ok {
+		l.report(filename, source, list)
+		return
+	}
+	if err != nil {
+		l.reportRuntime(renderer, err)
+		return
+	}
+	l.printResult(eval)
+}
 
-	eval := evaluator.Eval(program, env)
+func (l *Lox) reportRuntime(renderer *errors.Renderer, err error) {
+	if d, ok := err.(*errors.Diagnostic); ok {
+		fmt.Fprint(l.interpreter.stderr, renderer.Render(d))
+	} else {
+		fmt.Fprintln(l.interpreter.stderr, err)
+	}
+	l.hadRuntimeError = true
+}
+
+func (l *Lox) printResult(eval object.Object) {
 	if eval != nil {
-		fmt.Printf("%s\n", eval.Inspect())
+		fmt.Fprintf(l.interpreter.stdout, "%s\n", eval.Inspect())
 	}
+}
+
+// Parse scans and parses source, returning the program together with every
+// diagnostic reported along the way, ordered by position.
+func Parse(source string) (*ast.Program, errors.List) {
+	s := scanner.NewScanner(source)
+	tokens := s.ScanTokens()
+	p := parser.NewParser(tokens)
+	program := p.Parse()
 
+	diagnostics := append(errors.List{}, s.Errors()...)
+	diagnostics = append(diagnostics, p.Errors()...)
+	diagnostics.Sort()
+	return program, diagnostics
 }
@@ -0,0 +1,867 @@
+// Package loxc reads and writes precompiled programs: parsed syntax trees in
+// a binary format that can be run without scanning or parsing the source
+// again.
+//
+// A file is laid out as:
+//
+//	magic     "LOXC"
+//	version   uint16, big-endian
+//	length    uint32, big-endian: the size of the constants and program
+//	constants uvarint count, then per entry a kind byte and its data:
+//	          a uvarint length and bytes for a string, 8 big-endian bytes of
+//	          IEEE 754 bits for a number, 8 big-endian bytes of two's
+//	          complement for an integer
+//	program   uvarint statement count, then the statements as a node stream
+//	checksum  CRC-32 (IEEE) of everything before it, uint32 big-endian
+//
+// Each node is a tag byte followed by its fields. Tokens are written as the
+// constant indexes of their type and lexeme and the start and end positions
+// of their span, so decoded programs report errors at the same places as the
+// source they were built from. Strings in the node stream, including token
+// types and lexemes, are written as indexes into the constant table.
+package loxc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go-compiler/main/ast"
+	"go-compiler/main/token"
+	"hash/crc32"
+	"math"
+)
+
+// Version is the format version written by Encode. Decode rejects files
+// written with any other version, since the node stream changes with the
+// language's syntax.
+const Version = 11
+
+var magic = []byte("LOXC")
+
+// headerSize is the size of the magic, version and length.
+const headerSize = 4 + 2 + 4
+
+var (
+	ErrNotPrecompiled = errors.New("not a precompiled program")
+	ErrVersion        = errors.New("unsupported format version")
+	ErrChecksum       = errors.New("checksum mismatch")
+	ErrTruncated      = errors.New("unexpected end of data")
+	ErrCorrupt        = errors.New("corrupt program data")
+)
+
+// maxDepth bounds how deeply nodes may nest, so a corrupt file cannot
+// exhaust the stack.
+const maxDepth = 10000
+
+const (
+	constString byte = iota + 1
+	constNumber
+	constInteger
+)
+
+const (
+	tagNil byte = iota
+	tagLet
+	tagAssign
+	tagIdentifier
+	tagNumber
+	tagString
+	tagReturn
+	tagExpressionStatement
+	tagPrefix
+	tagInfix
+	tagBoolean
+	tagIf
+	tagWhile
+	tagBlock
+	tagFunction
+	tagCall
+	tagArray
+	tagIndex
+	tagHash
+	tagStruct
+	tagThis
+	tagProperty
+	tagPropertyAssign
+	tagSuper
+	tagFor
+	tagForIn
+	tagBreak
+	tagContinue
+	tagLogical
+	tagIndexAssign
+	tagCompoundAssign
+	tagUpdate
+	tagConditional
+	tagInteger
+)
+
+// IsPrecompiled reports whether data starts like a precompiled program.
+func IsPrecompiled(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Encode serializes program.
+func Encode(program *ast.Program) ([]byte, error) {
+	e := &encoder{index: make(map[constant]int)}
+	e.uvarint(uint64(len(program.Statements)))
+	for _, s := range program.Statements {
+		e.node(s)
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	var body bytes.Buffer
+	body.Write(binary.AppendUvarint(nil, uint64(len(e.constants))))
+	for _, c := range e.constants {
+		body.WriteByte(c.kind)
+		switch c.kind {
+		case constString:
+			body.Write(binary.AppendUvarint(nil, uint64(len(c.str))))
+			body.WriteString(c.str)
+		case constNumber, constInteger:
+			binary.Write(&body, binary.BigEndian, c.bits)
+		}
+	}
+	body.Write(e.nodes.Bytes())
+
+	var out bytes.Buffer
+	out.Write(magic)
+	binary.Write(&out, binary.BigEndian, uint16(Version))
+	binary.Write(&out, binary.BigEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	binary.Write(&out, binary.BigEndian, crc32.ChecksumIEEE(out.Bytes()))
+	return out.Bytes(), nil
+}
+
+// Decode deserializes a program written by Encode. It fails if data is not a
+// precompiled program, was written by another format version, or is
+// truncated or corrupt.
+func Decode(data []byte) (*ast.Program, error) {
+	if !IsPrecompiled(data) {
+		return nil, ErrNotPrecompiled
+	}
+	if len(data) < len(magic)+2 {
+		return nil, ErrTruncated
+	}
+	if version := binary.BigEndian.Uint16(data[len(magic):]); version != Version {
+		return nil, fmt.Errorf("%w %d (want %d)", ErrVersion, version, Version)
+	}
+	if len(data) < headerSize {
+		return nil, ErrTruncated
+	}
+	size := headerSize + int64(binary.BigEndian.Uint32(data[len(magic)+2:])) + crc32.Size
+	if int64(len(data)) < size {
+		return nil, ErrTruncated
+	}
+	if int64(len(data)) > size {
+		return nil, fmt.Errorf("%w: %d bytes of trailing data", ErrCorrupt, int64(len(data))-size)
+	}
+	body, sum := data[:len(data)-crc32.Size], data[len(data)-crc32.Size:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return nil, ErrChecksum
+	}
+
+	d := &decoder{data: body, pos: headerSize}
+	d.readConstants()
+	program := &ast.Program{Statements: []ast.Statement{}}
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		program.Statements = append(program.Statements, d.statement())
+	}
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail("%d bytes of trailing data", len(d.data)-d.pos)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return program, nil
+}
+
+type constant struct {
+	kind byte
+	str  string
+	bits uint64
+}
+
+type encoder struct {
+	constants []constant
+	index     map[constant]int
+	nodes     bytes.Buffer
+	err       error
+}
+
+func (e *encoder) uvarint(v uint64) {
+	e.nodes.Write(binary.AppendUvarint(nil, v))
+}
+
+func (e *encoder) constant(c constant) {
+	i, ok := e.index[c]
+	if !ok {
+		i = len(e.constants)
+		e.constants = append(e.constants, c)
+		e.index[c] = i
+	}
+	e.uvarint(uint64(i))
+}
+
+func (e *encoder) string(s string) {
+	e.constant(constant{kind: constString, str: s})
+}
+
+func (e *encoder) number(f float64) {
+	e.constant(constant{kind: constNumber, bits: math.Float64bits(f)})
+}
+
+func (e *encoder) integer(i int64) {
+	e.constant(constant{kind: constInteger, bits: uint64(i)})
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.nodes.WriteByte(1)
+	} else {
+		e.nodes.WriteByte(0)
+	}
+}
+
+func (e *encoder) position(p token.Position) {
+	e.uvarint(uint64(p.Offset))
+	e.uvarint(uint64(p.Line))
+	e.uvarint(uint64(p.Column))
+}
+
+func (e *encoder) token(t *token.Token) {
+	e.string(string(t.Type))
+	e.string(t.Lexeme)
+	e.position(t.Start)
+	e.position(t.End)
+}
+
+// optionalToken writes t preceded by whether it is present.
+func (e *encoder) optionalToken(t *token.Token) {
+	e.bool(t != nil)
+	if t != nil {
+		e.token(t)
+	}
+}
+
+func (e *encoder) block(b *ast.BlockStatment) {
+	if b == nil {
+		e.nodes.WriteByte(tagNil)
+		return
+	}
+	e.node(b)
+}
+
+// optionalNode writes node, or tagNil if it is absent.
+func (e *encoder) optionalNode(node ast.Node) {
+	if node == nil {
+		e.nodes.WriteByte(tagNil)
+		return
+	}
+	e.node(node)
+}
+
+func (e *encoder) node(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		e.nodes.WriteByte(tagLet)
+		e.token(node.Token)
+		e.node(node.Name)
+		e.node(node.Value)
+		e.string(node.Doc)
+	case *ast.AssignStatement:
+		e.nodes.WriteByte(tagAssign)
+		e.token(&node.Token)
+		e.node(node.Name)
+		e.node(node.Value)
+	case *ast.Identifier:
+		e.nodes.WriteByte(tagIdentifier)
+		e.token(node.Token)
+		e.string(node.Value)
+	case *ast.IntegerLiteral:
+		e.nodes.WriteByte(tagInteger)
+		e.token(node.Token)
+		e.integer(node.Value)
+	case *ast.NumberLiteral:
+		e.nodes.WriteByte(tagNumber)
+		e.token(node.Token)
+		e.number(node.Value)
+	case *ast.StringLiteral:
+		e.nodes.WriteByte(tagString)
+		e.token(node.Token)
+		e.string(node.Value)
+	case *ast.ReturnStatement:
+		e.nodes.WriteByte(tagReturn)
+		e.token(node.Token)
+		e.node(node.ReturnValue)
+	case *ast.BreakStatement:
+		e.nodes.WriteByte(tagBreak)
+		e.token(node.Token)
+	case *ast.ContinueStatement:
+		e.nodes.WriteByte(tagContinue)
+		e.token(node.Token)
+	case *ast.ExpressionStatement:
+		e.nodes.WriteByte(tagExpressionStatement)
+		e.token(node.Token)
+		e.node(node.Expression)
+	case *ast.PrefixExpression:
+		e.nodes.WriteByte(tagPrefix)
+		e.token(node.Token)
+		e.string(node.Operator)
+		e.node(node.Right)
+	case *ast.InfixExpression:
+		e.nodes.WriteByte(tagInfix)
+		e.token(node.Token)
+		e.string(node.Operator)
+		e.node(node.Left)
+		e.node(node.Right)
+	case *ast.LogicalExpression:
+		e.nodes.WriteByte(tagLogical)
+		e.token(node.Token)
+		e.string(node.Operator)
+		e.node(node.Left)
+		e.node(node.Right)
+	case *ast.ConditionalExpression:
+		e.nodes.WriteByte(tagConditional)
+		e.token(node.Token)
+		e.node(node.Condition)
+		e.node(node.Then)
+		e.node(node.Else)
+	case *ast.Boolean:
+		e.nodes.WriteByte(tagBoolean)
+		e.token(node.Token)
+		e.bool(node.Value)
+	case *ast.IfExpression:
+		e.nodes.WriteByte(tagIf)
+		e.token(node.Token)
+		e.node(node.Condition)
+		e.block(node.Then)
+		e.block(node.Else)
+	case *ast.WhileExpression:
+		e.nodes.WriteByte(tagWhile)
+		e.token(node.Token)
+		e.node(node.Condition)
+		e.block(node.Body)
+	case *ast.ForExpression:
+		e.nodes.WriteByte(tagFor)
+		e.token(node.Token)
+		e.optionalNode(node.Init)
+		e.optionalNode(node.Condition)
+		e.optionalNode(node.Update)
+		e.block(node.Body)
+	case *ast.ForInExpression:
+		e.nodes.WriteByte(tagForIn)
+		e.token(node.Token)
+		e.node(node.Variable)
+		e.node(node.Iterable)
+		e.block(node.Body)
+	case *ast.BlockStatment:
+		e.nodes.WriteByte(tagBlock)
+		e.token(&node.Token)
+		e.uvarint(uint64(len(node.Statements)))
+		for _, s := range node.Statements {
+			e.node(s)
+		}
+		e.optionalToken(node.EndToken)
+	case *ast.FunctionLiteral:
+		e.nodes.WriteByte(tagFunction)
+		e.token(node.Token)
+		e.uvarint(uint64(len(node.Parameters)))
+		for _, p := range node.Parameters {
+			e.node(p)
+		}
+		e.block(node.Body)
+	case *ast.CallExpression:
+		e.nodes.WriteByte(tagCall)
+		e.token(node.Token)
+		e.node(node.Function)
+		e.uvarint(uint64(len(node.Arguments)))
+		for _, arg := range node.Arguments {
+			e.node(arg)
+		}
+		e.optionalToken(node.EndToken)
+	case *ast.ArrayLiteral:
+		e.nodes.WriteByte(tagArray)
+		e.token(&node.Token)
+		e.uvarint(uint64(len(node.Elements)))
+		for _, el := range node.Elements {
+			e.node(el)
+		}
+		e.optionalToken(node.EndToken)
+	case *ast.IndexExpression:
+		e.nodes.WriteByte(tagIndex)
+		e.token(&node.Token)
+		e.node(node.Left)
+		e.node(node.Index)
+		e.optionalToken(node.EndToken)
+	case *ast.HashLiteral:
+		e.nodes.WriteByte(tagHash)
+		e.token(&node.Token)
+		keys := node.SortedKeys()
+		e.uvarint(uint64(len(keys)))
+		for _, key := range keys {
+			e.node(key)
+			e.node(node.Pairs[key])
+		}
+		e.optionalToken(node.EndToken)
+	case *ast.StructStatement:
+		e.nodes.WriteByte(tagStruct)
+		e.token(node.Token)
+		e.node(node.Name)
+		if node.Superclass == nil {
+			e.nodes.WriteByte(tagNil)
+		} else {
+			e.node(node.Superclass)
+		}
+		e.uvarint(uint64(len(node.Fields)))
+		for _, f := range node.Fields {
+			e.node(f.Name)
+			e.optionalNode(f.Value)
+		}
+		e.uvarint(uint64(len(node.Methods)))
+		for _, m := range node.Methods {
+			e.node(m.Name)
+			e.node(m.Function)
+			e.string(m.Doc)
+		}
+		e.optionalToken(node.EndToken)
+		e.string(node.Doc)
+	case *ast.ThisExpression:
+		e.nodes.WriteByte(tagThis)
+		e.token(node.Token)
+	case *ast.SuperExpression:
+		e.nodes.WriteByte(tagSuper)
+		e.token(node.Token)
+		e.node(node.Method)
+	case *ast.PropertyExpression:
+		e.nodes.WriteByte(tagProperty)
+		e.token(node.Token)
+		e.node(node.Object)
+		e.node(node.Name)
+	case *ast.PropertyAssignment:
+		e.nodes.WriteByte(tagPropertyAssign)
+		e.token(node.Token)
+		e.node(node.Target)
+		e.node(node.Value)
+	case *ast.IndexAssignment:
+		e.nodes.WriteByte(tagIndexAssign)
+		e.token(node.Token)
+		e.node(node.Target)
+		e.node(node.Value)
+	case *ast.CompoundAssignment:
+		e.nodes.WriteByte(tagCompoundAssign)
+		e.token(node.Token)
+		e.string(node.Operator)
+		e.node(node.Target)
+		e.node(node.Value)
+	case *ast.UpdateExpression:
+		e.nodes.WriteByte(tagUpdate)
+		e.token(node.Token)
+		e.string(node.Operator)
+		e.bool(node.Prefix)
+		e.node(node.Target)
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("cannot encode %T", node)
+		}
+	}
+}
+
+type decoder struct {
+	data      []byte
+	pos       int
+	constants []constant
+	depth     int
+	err       error // the first error; later reads return zero values
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrCorrupt, fmt.Sprintf(format, a...))
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.data) {
+		d.err = ErrTruncated
+		return 0
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data)-d.pos {
+		d.err = ErrTruncated
+		return nil
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.pos:])
+	switch {
+	case n == 0:
+		d.err = ErrTruncated
+	case n < 0:
+		d.fail("varint overflows 64 bits")
+	}
+	if n <= 0 {
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+// int reads a uvarint that must fit in an int.
+func (d *decoder) int() int {
+	v := d.uvarint()
+	if v > math.MaxInt32 {
+		d.fail("value %d out of range", v)
+		return 0
+	}
+	return int(v)
+}
+
+// count reads the length of a list. Every element takes at least a byte, so
+// lengths beyond the remaining data are rejected before anything is
+// allocated for them.
+func (d *decoder) count() int {
+	n := d.int()
+	if n > len(d.data)-d.pos {
+		if d.err == nil {
+			d.err = ErrTruncated
+		}
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bool() bool {
+	switch b := d.byte(); b {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		d.fail("invalid boolean %d", b)
+		return false
+	}
+}
+
+func (d *decoder) readConstants() {
+	n := d.count()
+	d.constants = make([]constant, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		switch kind := d.byte(); kind {
+		case constString:
+			d.constants = append(d.constants, constant{kind: kind, str: string(d.bytes(d.count()))})
+		case constNumber, constInteger:
+			bits := d.bytes(8)
+			if bits != nil {
+				d.constants = append(d.constants, constant{kind: kind, bits: binary.BigEndian.Uint64(bits)})
+			}
+		default:
+			d.fail("unknown constant kind %d", kind)
+		}
+	}
+}
+
+func (d *decoder) constant(kind byte) constant {
+	i := d.int()
+	if d.err != nil {
+		return constant{}
+	}
+	if i >= len(d.constants) {
+		d.fail("constant index %d out of range", i)
+		return constant{}
+	}
+	if d.constants[i].kind != kind {
+		d.fail("constant %d has the wrong kind", i)
+		return constant{}
+	}
+	return d.constants[i]
+}
+
+func (d *decoder) string() string {
+	return d.constant(constString).str
+}
+
+func (d *decoder) number() float64 {
+	return math.Float64frombits(d.constant(constNumber).bits)
+}
+
+func (d *decoder) integer() int64 {
+	return int64(d.constant(constInteger).bits)
+}
+
+func (d *decoder) position() token.Position {
+	return token.Position{Offset: d.int(), Line: d.int(), Column: d.int()}
+}
+
+func (d *decoder) token() *token.Token {
+	typ := token.TokenType(d.string())
+	lexeme := d.string()
+	start := d.position()
+	end := d.position()
+	return token.NewTokenAt(typ, lexeme, nil, start, end)
+}
+
+func (d *decoder) optionalToken() *token.Token {
+	if d.bool() {
+		return d.token()
+	}
+	return nil
+}
+
+func (d *decoder) statement() ast.Statement {
+	node := d.node()
+	s, ok := node.(ast.Statement)
+	if !ok && d.err == nil {
+		d.fail("expected statement, got %T", node)
+	}
+	return s
+}
+
+func (d *decoder) expression() ast.Expression {
+	node := d.node()
+	e, ok := node.(ast.Expression)
+	if !ok && d.err == nil {
+		d.fail("expected expression, got %T", node)
+	}
+	return e
+}
+
+func (d *decoder) identifier() *ast.Identifier {
+	node := d.node()
+	i, ok := node.(*ast.Identifier)
+	if !ok && d.err == nil {
+		d.fail("expected identifier, got %T", node)
+	}
+	return i
+}
+
+// optionalExpression reads an expression, or nil if it was absent.
+func (d *decoder) optionalExpression() ast.Expression {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	e, ok := node.(ast.Expression)
+	if !ok && d.err == nil {
+		d.fail("expected expression, got %T", node)
+	}
+	return e
+}
+
+// optionalStatement reads a statement, or nil if it was absent.
+func (d *decoder) optionalStatement() ast.Statement {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	s, ok := node.(ast.Statement)
+	if !ok && d.err == nil {
+		d.fail("expected statement, got %T", node)
+	}
+	return s
+}
+
+// optionalIdentifier reads an identifier, or nil if it was absent.
+func (d *decoder) optionalIdentifier() *ast.Identifier {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	i, ok := node.(*ast.Identifier)
+	if !ok && d.err == nil {
+		d.fail("expected identifier, got %T", node)
+	}
+	return i
+}
+
+func (d *decoder) function() *ast.FunctionLiteral {
+	node := d.node()
+	fn, ok := node.(*ast.FunctionLiteral)
+	if !ok && d.err == nil {
+		d.fail("expected function, got %T", node)
+	}
+	return fn
+}
+
+func (d *decoder) index() *ast.IndexExpression {
+	node := d.node()
+	i, ok := node.(*ast.IndexExpression)
+	if !ok && d.err == nil {
+		d.fail("expected index expression, got %T", node)
+	}
+	return i
+}
+
+func (d *decoder) property() *ast.PropertyExpression {
+	node := d.node()
+	p, ok := node.(*ast.PropertyExpression)
+	if !ok && d.err == nil {
+		d.fail("expected property, got %T", node)
+	}
+	return p
+}
+
+// block reads a block statement, or nil if the block was absent.
+func (d *decoder) block() *ast.BlockStatment {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	b, ok := node.(*ast.BlockStatment)
+	if !ok && d.err == nil {
+		d.fail("expected block, got %T", node)
+	}
+	return b
+}
+
+func (d *decoder) node() ast.Node {
+	if d.depth++; d.depth > maxDepth {
+		d.fail("nodes nested too deeply")
+	}
+	defer func() { d.depth-- }()
+
+	tag := d.byte()
+	if d.err != nil {
+		return nil
+	}
+	switch tag {
+	case tagNil:
+		return nil
+	case tagLet:
+		return &ast.LetStatement{Token: d.token(), Name: d.identifier(), Value: d.expression(), Doc: d.string()}
+	case tagAssign:
+		return &ast.AssignStatement{Token: *d.token(), Name: d.identifier(), Value: d.expression()}
+	case tagIdentifier:
+		return &ast.Identifier{Token: d.token(), Value: d.string()}
+	case tagInteger:
+		return &ast.IntegerLiteral{Token: d.token(), Value: d.integer()}
+	case tagNumber:
+		return &ast.NumberLiteral{Token: d.token(), Value: d.number()}
+	case tagString:
+		return &ast.StringLiteral{Token: d.token(), Value: d.string()}
+	case tagReturn:
+		return &ast.ReturnStatement{Token: d.token(), ReturnValue: d.expression()}
+	case tagBreak:
+		return &ast.BreakStatement{Token: d.token()}
+	case tagContinue:
+		return &ast.ContinueStatement{Token: d.token()}
+	case tagExpressionStatement:
+		return &ast.ExpressionStatement{Token: d.token(), Expression: d.expression()}
+	case tagPrefix:
+		return &ast.PrefixExpression{Token: d.token(), Operator: d.string(), Right: d.expression()}
+	case tagInfix:
+		return &ast.InfixExpression{Token: d.token(), Operator: d.string(), Left: d.expression(), Right: d.expression()}
+	case tagLogical:
+		return &ast.LogicalExpression{Token: d.token(), Operator: d.string(), Left: d.expression(), Right: d.expression()}
+	case tagConditional:
+		return &ast.ConditionalExpression{Token: d.token(), Condition: d.expression(), Then: d.expression(), Else: d.expression()}
+	case tagBoolean:
+		return &ast.Boolean{Token: d.token(), Value: d.bool()}
+	case tagIf:
+		return &ast.IfExpression{Token: d.token(), Condition: d.expression(), Then: d.requiredBlock(), Else: d.block()}
+	case tagWhile:
+		return &ast.WhileExpression{Token: d.token(), Condition: d.expression(), Body: d.requiredBlock()}
+	case tagFor:
+		return &ast.ForExpression{Token: d.token(), Init: d.optionalStatement(), Condition: d.optionalExpression(),
+			Update: d.optionalExpression(), Body: d.requiredBlock()}
+	case tagForIn:
+		return &ast.ForInExpression{Token: d.token(), Variable: d.identifier(), Iterable: d.expression(),
+			Body: d.requiredBlock()}
+	case tagBlock:
+		block := &ast.BlockStatment{Token: *d.token(), Statements: []ast.Statement{}}
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			block.Statements = append(block.Statements, d.statement())
+		}
+		block.EndToken = d.optionalToken()
+		return block
+	case tagFunction:
+		fn := &ast.FunctionLiteral{Token: d.token(), Parameters: []*ast.Identifier{}}
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			fn.Parameters = append(fn.Parameters, d.identifier())
+		}
+		fn.Body = d.requiredBlock()
+		return fn
+	case tagCall:
+		call := &ast.CallExpression{Token: d.token(), Function: d.expression(), Arguments: []ast.Expression{}}
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			call.Arguments = append(call.Arguments, d.expression())
+		}
+		call.EndToken = d.optionalToken()
+		return call
+	case tagArray:
+		array := &ast.ArrayLiteral{Token: *d.token(), Elements: []ast.Expression{}}
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			array.Elements = append(array.Elements, d.expression())
+		}
+		array.EndToken = d.optionalToken()
+		return array
+	case tagIndex:
+		return &ast.IndexExpression{Token: *d.token(), Left: d.expression(), Index: d.expression(), EndToken: d.optionalToken()}
+	case tagHash:
+		hash := &ast.HashLiteral{Token: *d.token(), Pairs: make(map[ast.Expression]ast.Expression)}
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			key := d.expression()
+			hash.Pairs[key] = d.expression()
+		}
+		hash.EndToken = d.optionalToken()
+		return hash
+	case tagStruct:
+		s := &ast.StructStatement{Token: d.token(), Name: d.identifier(), Superclass: d.optionalIdentifier()}
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			s.Fields = append(s.Fields, &ast.StructField{Name: d.identifier(), Value: d.optionalExpression()})
+		}
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			s.Methods = append(s.Methods, &ast.Method{Name: d.identifier(), Function: d.function(), Doc: d.string()})
+		}
+		s.EndToken = d.optionalToken()
+		s.Doc = d.string()
+		return s
+	case tagThis:
+		return &ast.ThisExpression{Token: d.token()}
+	case tagSuper:
+		return &ast.SuperExpression{Token: d.token(), Method: d.identifier()}
+	case tagProperty:
+		return &ast.PropertyExpression{Token: d.token(), Object: d.expression(), Name: d.identifier()}
+	case tagPropertyAssign:
+		return &ast.PropertyAssignment{Token: d.token(), Target: d.property(), Value: d.expression()}
+	case tagIndexAssign:
+		return &ast.IndexAssignment{Token: d.token(), Target: d.index(), Value: d.expression()}
+	case tagCompoundAssign:
+		return &ast.CompoundAssignment{Token: d.token(), Operator: d.string(), Target: d.expression(), Value: d.expression()}
+	case tagUpdate:
+		return &ast.UpdateExpression{Token: d.token(), Operator: d.string(), Prefix: d.bool(), Target: d.expression()}
+	default:
+		d.fail("unknown node tag %d", tag)
+		return nil
+	}
+}
+
+// requiredBlock reads a block statement that must be present.
+func (d *decoder) requiredBlock() *ast.BlockStatment {
+	b := d.block()
+	if b == nil && d.err == nil {
+		d.fail("missing block")
+	}
+	return b
+}
@@ -0,0 +1,141 @@
+package loxc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go-compiler/main/ast"
+	"go-compiler/main/parser"
+	"go-compiler/main/scanner"
+	"hash/crc32"
+	"testing"
+)
+
+const input = `
+/// Adds a and b.
+let add = fn(a, b) { a + b; }; /* not /* documentation */ */
+let values = [1.5, -2, "three", true, 0xFF, 1_000, 6.02e23];
+let lookup = {"one": 1, 2: !false or false and 3};
+let i = 0;
+while (i < 3) { i = i + 1; if (i > 5) { break; } else { continue; } }
+for (let j = 0; j < 2; j = j + 1) { i = i + j; }
+for (;;) { }
+for (k in lookup) { k }
+if (add(i, 1) > 3) { values[0] } else { lookup["one"] };
+/// A point in the plane.
+struct Point { x = 0; y; /// Adds the coordinates.
+fn sum() { this.x + this.y } }
+let p = Point(1, 2);
+values[1] = lookup["one"] = p;
+p.y = p.sum();
+let picked = i > 2 ? values?[0] : lookup["none"] ?? 0;
+let greeting = "hi ${p.x + 1}\t${values[0]}!";
+i += 2; i++; --values[0]; p.x *= 3;
+struct Point3 < Point { z = 0; fn sum() { super.sum() + this.z } }
+return lookup[2];
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.NewParser(scanner.NewScanner(input).ScanTokens())
+	program := p.Parse()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func encode(t *testing.T, input string) []byte {
+	t.Helper()
+	data, err := Encode(parse(t, input))
+	if err != nil {
+		t.Fatalf("Encode returned error: %v", err)
+	}
+	return data
+}
+
+func TestRoundTrip(t *testing.T) {
+	program := parse(t, input)
+	data, err := Encode(program)
+	if err != nil {
+		t.Fatalf("Encode returned error: %v", err)
+	}
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+
+	// Dump includes the position of every node, so equal dumps mean the
+	// spans survived along with the structure.
+	if ast.Dump(decoded) != ast.Dump(program) {
+		t.Errorf("decoded program differs.\nwant=%s\ngot =%s", ast.Dump(program), ast.Dump(decoded))
+	}
+	if decoded.String() != program.String() {
+		t.Errorf("decoded program prints differently.\nwant=%q\ngot =%q", program.String(), decoded.String())
+	}
+	if decoded.Span() != program.Span() {
+		t.Errorf("decoded program has wrong span. want=%v, got=%v", program.Span(), decoded.Span())
+	}
+}
+
+func TestEncodingIsDeterministic(t *testing.T) {
+	first := encode(t, input)
+	for i := 0; i < 5; i++ {
+		if string(encode(t, input)) != string(first) {
+			t.Fatalf("encoding the same program twice gave different bytes")
+		}
+	}
+}
+
+func TestDecodeRejectsTruncatedData(t *testing.T) {
+	data := encode(t, input)
+	for n := 0; n < len(data); n++ {
+		if _, err := Decode(data[:n]); err == nil {
+			t.Fatalf("Decode accepted data truncated to %d of %d bytes", n, len(data))
+		}
+	}
+	if _, err := Decode(data[:len(data)-10]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected ErrTruncated, got=%v", err)
+	}
+}
+
+func TestDecodeRejectsCorruptData(t *testing.T) {
+	data := encode(t, input)
+	for i := range data {
+		corrupt := append([]byte{}, data...)
+		corrupt[i] ^= 0x5a
+		if _, err := Decode(corrupt); err == nil {
+			t.Fatalf("Decode accepted data with byte %d flipped", i)
+		}
+	}
+
+	// Data whose checksum still matches must fail cleanly too.
+	for i := headerSize; i < len(data)-crc32.Size; i++ {
+		corrupt := append([]byte{}, data...)
+		corrupt[i] ^= 0xff
+		body := corrupt[:len(corrupt)-crc32.Size]
+		binary.BigEndian.PutUint32(corrupt[len(body):], crc32.ChecksumIEEE(body))
+		Decode(corrupt)
+	}
+
+	extra := append(append([]byte{}, data...), 0)
+	if _, err := Decode(extra); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt for trailing data, got=%v", err)
+	}
+}
+
+func TestDecodeRejectsOtherVersions(t *testing.T) {
+	data := encode(t, input)
+	binary.BigEndian.PutUint16(data[len(magic):], Version+1)
+	_, err := Decode(data)
+	if !errors.Is(err, ErrVersion) {
+		t.Fatalf("expected ErrVersion, got=%v", err)
+	}
+	if want := fmt.Sprintf("unsupported format version %d (want %d)", Version+1, Version); err.Error() != want {
+		t.Errorf("wrong error message. got=%q", err.Error())
+	}
+
+	if _, err := Decode([]byte("let a = 1;")); !errors.Is(err, ErrNotPrecompiled) {
+		t.Errorf("expected ErrNotPrecompiled, got=%v", err)
+	}
+}
@@ -1,31 +1,140 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"go-compiler/main/tools"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"go-compiler/main/lox"
 )
 
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: golox [flags] [script]")
+	fmt.Fprintln(out, "       golox build [-o output] script")
+	fmt.Fprintln(out, "       golox fmt [-w] [--check] files...")
+	fmt.Fprintln(out, "-g: golox -g|--generate [output directory]: Generates AST files")
+	flag.PrintDefaults()
+}
+
 func main() {
-	args := os.Args[1:]
+	if len(os.Args) > 1 && os.Args[1] == "build" {
+		build(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		formatFiles(os.Args[2:])
+		return
+	}
 
-	lox := lox.NewLox()
-	if len(args) > 1 {
-		fmt.Println("%s,%s", len(args), args)
-		if (args[0] == "-g") || (args[0] == "--generate") && len(args) == 2 {
-			tools.Generate(args[1])
-			return
-		}
-		fmt.Println("Usage: golox [script]")
-		fmt.Println("-g: golox -g|--generate [output directory]: Generates AST files")
-		os.Exit(64)
+	var generate string
+	flag.StringVar(&generate, "g", "", "generate AST files into `directory`")
+	flag.StringVar(&generate, "generate", "", "generate AST files into `directory`")
+	useVM := flag.Bool("vm", false, "run scripts on the bytecode virtual machine instead of the tree-walking evaluator")
+	tokens := flag.Bool("tokens", false, "print the tokens of the script instead of running it")
+	printAST := flag.Bool("ast", false, "print the syntax tree of the script instead of running it")
+	env := flag.Bool("env", false, "print the global bindings and their types after running")
+	flag.Usage = usage
+	flag.Parse()
+
+	if generate != "" {
+		tools.Generate(generate)
 		return
-	} else if len(args) == 1 {
+	}
+
+	config := lox.Config{}
+	if *useVM {
+		config.Engine = lox.EngineVM
+	}
+	lox := lox.NewLoxWithConfig(config)
+
+	args := flag.Args()
+	if len(args) > 1 || (*tokens || *printAST) && (len(args) != 1 || *env) {
+		usage()
+		os.Exit(64)
+	}
+	switch {
+	case *tokens:
+		lox.PrintTokens(args[0])
+	case *printAST:
+		lox.PrintAST(args[0])
+	case len(args) == 1:
 		lox.RunFile(args[0])
-	} else {
+	default:
 		lox.RunPrompt()
 	}
+	// Print the globals even if the script failed, since that is when
+	// they are most useful.
+	if *env {
+		lox.PrintGlobals()
+	}
+	lox.ExitOnError()
+}
+
+// build precompiles a script: golox build script.lox -o script.loxc
+func build(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	out := fs.String("o", "", "write the precompiled program to `file` (default: the script with a .loxc extension)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: golox build [-o output] script")
+		fs.PrintDefaults()
+	}
+
+	// Accept flags on either side of the script.
+	fs.Parse(args)
+	scripts := []string{}
+	for fs.NArg() > 0 {
+		scripts = append(scripts, fs.Arg(0))
+		fs.Parse(fs.Args()[1:])
+	}
+	if len(scripts) != 1 {
+		fs.Usage()
+		os.Exit(64)
+	}
+
+	script := scripts[0]
+	if *out == "" {
+		*out = strings.TrimSuffix(script, filepath.Ext(script)) + ".loxc"
+	}
+	lox.NewLox().BuildFile(script, *out)
+}
+
+// formatFiles formats scripts: golox fmt [-w] [--check] files...
+func formatFiles(args []string) {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fs.Bool("w", false, "write the result to the files instead of printing it")
+	check := fs.Bool("check", false, "list the files that are not formatted instead of printing them, and exit with status 1 if there are any")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: golox fmt [-w] [--check] files...")
+		fs.PrintDefaults()
+	}
 
+	// Accept flags on either side of the files.
+	fs.Parse(args)
+	files := []string{}
+	for fs.NArg() > 0 {
+		files = append(files, fs.Arg(0))
+		fs.Parse(fs.Args()[1:])
+	}
+	if len(files) == 0 {
+		fs.Usage()
+		os.Exit(64)
+	}
+
+	lox := lox.NewLox()
+	formatted := true
+	for _, file := range files {
+		if !lox.FormatFile(file, *write, *check) {
+			formatted = false
+		}
+	}
+	if lox.HadError() {
+		os.Exit(65)
+	}
+	if *check && !formatted {
+		os.Exit(1)
+	}
 }
@@ -1,5 +1,7 @@
 package object
 
+import "sort"
+
 func NewEnvironment(e *Environment) *Environment {
 	s := make(map[string]Object)
 	return &Environment{store: s, outer: e}
@@ -40,3 +42,24 @@ func (e *Environment) Reset(name string, val Object) (Object, bool) {
 	}
 	return val, ok
 }
+
+// Copy returns a new environment enclosed by the same outer environment,
+// holding its own copy of the bindings of e.
+func (e *Environment) Copy() *Environment {
+	c := NewEnvironment(e.outer)
+	for name, obj := range e.store {
+		c.store[name] = obj
+	}
+	return c
+}
+
+// Names returns the names bound in this environment, not counting its outer
+// ones, in sorted order.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
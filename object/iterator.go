@@ -0,0 +1,75 @@
+package object
+
+import (
+	"go-compiler/main/errors"
+	"sort"
+)
+
+// Iterator steps through the values a for-in loop visits: the elements of an
+// array, the characters of a string, or the keys of a hash in sorted order.
+// The values are taken when the loop starts, so changes the loop makes to
+// the collection do not affect it.
+type Iterator struct {
+	values []Object
+	next   int
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "<iterator>" }
+
+// Next returns the next value, or false once there are none left.
+func (it *Iterator) Next() (Object, bool) {
+	if it.next >= len(it.values) {
+		return nil, false
+	}
+	value := it.values[it.next]
+	it.next++
+	return value, true
+}
+
+// Iterate returns an *Iterator over obj, or an *Error if obj cannot be
+// iterated over.
+func Iterate(obj Object) Object {
+	switch obj := obj.(type) {
+	case *Array:
+		return &Iterator{values: append([]Object{}, obj.Elements...)}
+	case *String:
+		values := []Object{}
+		for _, r := range obj.Value {
+			values = append(values, &String{Value: string(r)})
+		}
+		return &Iterator{values: values}
+	case *Hash:
+		keys := make([]Object, 0, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			keys = append(keys, pair.Key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keyLess(keys[i], keys[j]) })
+		return &Iterator{values: keys}
+	default:
+		return operatorError(errors.CodeNotIterable, "cannot iterate over %s", obj.Type())
+	}
+}
+
+// keyLess orders hash keys by type, then by value. Integers and Numbers are
+// ordered together by value.
+func keyLess(a, b Object) bool {
+	if isNumeric(a) && isNumeric(b) {
+		if a, ok := a.(*Integer); ok {
+			if b, ok := b.(*Integer); ok {
+				return a.Value < b.Value
+			}
+		}
+		return toFloat(a) < toFloat(b)
+	}
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	}
+	return false
+}
@@ -0,0 +1,461 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Conversions between Go values and script values, for host programs that
+// embed the interpreter.
+//
+// Go integers become Integers (unsigned ones too large for an Integer become
+// Numbers), floats become Numbers, strings become Strings, bools become Booleans,
+// nil becomes NULL, slices and arrays become Arrays, and maps and structs
+// become Hashes. Struct fields are keyed by their name, or by the name given
+// in a `lox:"name"` tag; fields tagged `lox:"-"` and unexported fields are
+// skipped. Funcs are wrapped as Builtins with WrapFunc.
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// FromGo converts a Go value into the equivalent script value.
+func FromGo(v interface{}) (Object, error) {
+	if v == nil {
+		return NULL, nil
+	}
+	return fromValue(reflect.ValueOf(v))
+}
+
+func fromValue(v reflect.Value) (Object, error) {
+	if v.Type().Implements(objectType) {
+		if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+			return NULL, nil
+		}
+		return v.Interface().(Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return NativeBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return &Number{Value: float64(v.Uint())}, nil
+		}
+		return &Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Number{Value: v.Float()}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return fromValue(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return fromSequence(v)
+	case reflect.Array:
+		return fromSequence(v)
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		hash := &Hash{Pairs: make(map[HashKey]HashPair, v.Len())}
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := fromValue(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := fromValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			hash.Pairs[hashable.HashKey()] = HashPair{Key: key, Value: value}
+		}
+		return hash, nil
+	case reflect.Struct:
+		hash := &Hash{Pairs: make(map[HashKey]HashPair)}
+		for _, field := range structFields(v.Type()) {
+			// A field promoted through a nil embedded pointer has no
+			// value, so it is null.
+			value := Object(NULL)
+			if fv, err := v.FieldByIndexErr(field.index); err == nil {
+				if value, err = fromValue(fv); err != nil {
+					return nil, fmt.Errorf("field %s: %w", field.name, err)
+				}
+			}
+			key := &String{Value: field.name}
+			hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: value}
+		}
+		return hash, nil
+	case reflect.Func:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return WrapFunc(v.Interface())
+	}
+	return nil, fmt.Errorf("cannot convert Go value of type %s", v.Type())
+}
+
+func fromSequence(v reflect.Value) (Object, error) {
+	elements := make([]Object, v.Len())
+	for i := range elements {
+		element, err := fromValue(v.Index(i))
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		elements[i] = element
+	}
+	return &Array{Elements: elements}, nil
+}
+
+// ToGo converts a script value into a plain Go value: nil, bool, int64,
+// float64, string, []interface{}, or map[string]interface{} for hashes whose keys are
+// all strings and map[interface{}]interface{} otherwise. Functions cannot be
+// converted.
+func ToGo(obj Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case nil, *Null:
+		return nil, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Integer:
+		return obj.Value, nil
+	case *Number:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, e := range obj.Elements {
+			element, err := ToGo(e)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return elements, nil
+	case *Hash:
+		stringKeys := make(map[string]interface{}, len(obj.Pairs))
+		anyKeys := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, err := ToGo(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := ToGo(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			if str, ok := key.(string); ok {
+				stringKeys[str] = value
+			}
+			anyKeys[key] = value
+		}
+		if len(stringKeys) == len(anyKeys) {
+			return stringKeys, nil
+		}
+		return anyKeys, nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to a Go value", obj.Type())
+}
+
+// Decode converts obj into the Go value pointed to by target, checking that
+// the script value fits the target's type.
+func Decode(obj Object, target interface{}) error {
+	ptr := reflect.ValueOf(target)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return fmt.Errorf("Decode target must be a non-nil pointer, got %T", target)
+	}
+	value, err := toValue(obj, ptr.Type().Elem())
+	if err != nil {
+		return err
+	}
+	ptr.Elem().Set(value)
+	return nil
+}
+
+// toValue converts obj into a Go value of type typ.
+func toValue(obj Object, typ reflect.Type) (reflect.Value, error) {
+	if obj == nil {
+		obj = NULL
+	}
+	if typ.Implements(objectType) && reflect.TypeOf(obj).AssignableTo(typ) {
+		return reflect.ValueOf(obj), nil
+	}
+	if typ.Kind() == reflect.Interface && typ.NumMethod() == 0 {
+		v, err := ToGo(obj)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if v == nil {
+			return reflect.Zero(typ), nil
+		}
+		return reflect.ValueOf(v), nil
+	}
+
+	mismatch := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), typ)
+	}
+	if _, ok := obj.(*Null); ok {
+		switch typ.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface, reflect.Func:
+			return reflect.Zero(typ), nil
+		}
+		return mismatch()
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		if b, ok := obj.(*Boolean); ok {
+			return reflect.ValueOf(b.Value).Convert(typ), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !isNumeric(obj) {
+			return mismatch()
+		}
+		n, err := integral(obj)
+		v := reflect.New(typ).Elem()
+		if err != nil || v.OverflowInt(n) {
+			return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Inspect(), typ)
+		}
+		v.SetInt(n)
+		return v, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !isNumeric(obj) {
+			return mismatch()
+		}
+		v := reflect.New(typ).Elem()
+		if n, ok := obj.(*Number); ok && n.Value >= math.MaxInt64 && n.Value < math.MaxUint64 &&
+			n.Value == math.Trunc(n.Value) && !v.OverflowUint(uint64(n.Value)) {
+			// Too large for an Integer, but it fits the unsigned type.
+			v.SetUint(uint64(n.Value))
+			return v, nil
+		}
+		n, err := integral(obj)
+		if err != nil || n < 0 || v.OverflowUint(uint64(n)) {
+			return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Inspect(), typ)
+		}
+		v.SetUint(uint64(n))
+		return v, nil
+	case reflect.Float32, reflect.Float64:
+		if isNumeric(obj) {
+			return reflect.ValueOf(toFloat(obj)).Convert(typ), nil
+		}
+	case reflect.String:
+		if s, ok := obj.(*String); ok {
+			return reflect.ValueOf(s.Value).Convert(typ), nil
+		}
+	case reflect.Pointer:
+		elem, err := toValue(obj, typ.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(typ.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	case reflect.Slice:
+		arr, ok := obj.(*Array)
+		if !ok {
+			return mismatch()
+		}
+		slice := reflect.MakeSlice(typ, len(arr.Elements), len(arr.Elements))
+		for i, e := range arr.Elements {
+			element, err := toValue(e, typ.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+			}
+			slice.Index(i).Set(element)
+		}
+		return slice, nil
+	case reflect.Array:
+		arr, ok := obj.(*Array)
+		if !ok {
+			return mismatch()
+		}
+		if len(arr.Elements) != typ.Len() {
+			return reflect.Value{}, fmt.Errorf("cannot use ARRAY of length %d as %s", len(arr.Elements), typ)
+		}
+		array := reflect.New(typ).Elem()
+		for i, e := range arr.Elements {
+			element, err := toValue(e, typ.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+			}
+			array.Index(i).Set(element)
+		}
+		return array, nil
+	case reflect.Map:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return mismatch()
+		}
+		m := reflect.MakeMapWithSize(typ, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			key, err := toValue(pair.Key, typ.Key())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			value, err := toValue(pair.Value, typ.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			m.SetMapIndex(key, value)
+		}
+		return m, nil
+	case reflect.Struct:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return mismatch()
+		}
+		v := reflect.New(typ).Elem()
+		for _, field := range structFields(typ) {
+			key := &String{Value: field.name}
+			pair, ok := hash.Pairs[key.HashKey()]
+			if !ok {
+				continue
+			}
+			value, err := toValue(pair.Value, field.typ)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("field %s: %w", field.name, err)
+			}
+			fv, err := settableField(v, field.index)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("field %s: %w", field.name, err)
+			}
+			fv.Set(value)
+		}
+		return v, nil
+	}
+	return mismatch()
+}
+
+type structField struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+// structFields lists the exported fields of a struct type under the names
+// scripts see them by.
+func structFields(typ reflect.Type) []structField {
+	fields := []structField{}
+	for _, field := range reflect.VisibleFields(typ) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("lox"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{name: name, index: field.Index, typ: field.Type})
+	}
+	return fields
+}
+
+// settableField returns the field of the struct v at index, allocating the
+// embedded pointers on the way to it that are nil.
+func settableField(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot allocate embedded %s", v.Type())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// WrapFunc wraps a Go function as a Builtin. Arguments from scripts are
+// converted to the function's parameter types, with a script error returned
+// if there are too few or too many of them or one does not convert. The
+// function may return nothing, a value, an error, or a value and an error; a
+// non-nil error is returned to the script as an error value.
+func WrapFunc(fn interface{}) (*Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if !v.IsValid() {
+		return nil, fmt.Errorf("cannot wrap nil as a builtin function")
+	}
+	typ := v.Type()
+	if typ.Kind() != reflect.Func {
+		return nil, fmt.Errorf("cannot wrap %s as a builtin function", typ)
+	}
+	if v.IsNil() {
+		return nil, fmt.Errorf("cannot wrap a nil %s as a builtin function", typ)
+	}
+	numOut := typ.NumOut()
+	returnsError := numOut > 0 && typ.Out(numOut-1) == errorType
+	if numOut > 2 || (numOut == 2 && !returnsError) {
+		return nil, fmt.Errorf("cannot wrap %s: must return at most a value and an error", typ)
+	}
+
+	return &Builtin{Fn: func(args ...Object) Object {
+		in, err := funcArgs(typ, args)
+		if err != nil {
+			return NewError("%s", err)
+		}
+		out := v.Call(in)
+		if returnsError {
+			if err, _ := out[numOut-1].Interface().(error); err != nil {
+				return NewError("%s", err)
+			}
+			out = out[:numOut-1]
+		}
+		if len(out) == 0 {
+			return NULL
+		}
+		result, err := fromValue(out[0])
+		if err != nil {
+			return NewError("%s", err)
+		}
+		return result
+	}}, nil
+}
+
+// funcArgs converts script arguments to the parameter types of typ.
+func funcArgs(typ reflect.Type, args []Object) ([]reflect.Value, error) {
+	numIn := typ.NumIn()
+	if typ.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, fmt.Errorf("wrong number of arguments. got=%d, want at least %d", len(args), numIn-1)
+		}
+	} else if len(args) != numIn {
+		return nil, fmt.Errorf("wrong number of arguments. got=%d, want=%d", len(args), numIn)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		paramType := typ.In(min(i, numIn-1))
+		if typ.IsVariadic() && i >= numIn-1 {
+			paramType = paramType.Elem()
+		}
+		value, err := toValue(arg, paramType)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		in[i] = value
+	}
+	return in, nil
+}
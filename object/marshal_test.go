@@ -0,0 +1,223 @@
+package object
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	X      int
+	Y      int
+	Label  string `lox:"label"`
+	Hidden bool   `lox:"-"`
+	secret string
+}
+
+type inner struct {
+	A int
+}
+
+type Inner struct {
+	A int
+}
+
+type outer struct {
+	*Inner
+	B int
+}
+
+type hidden struct {
+	*inner
+	B int
+}
+
+func TestEmbeddedNilPointers(t *testing.T) {
+	obj, err := FromGo(struct {
+		*Inner
+		B int
+	}{B: 1})
+	if err != nil {
+		t.Fatalf("FromGo returned error: %v", err)
+	}
+	hash := obj.(*Hash)
+	for key, want := range map[string]string{"A": "null", "B": "1"} {
+		if pair, ok := hash.Pairs[(&String{Value: key}).HashKey()]; !ok || pair.Value.Inspect() != want {
+			t.Errorf("field %q wrong. want=%q, got=%+v", key, want, pair.Value)
+		}
+	}
+
+	obj, _ = FromGo(map[string]interface{}{"A": 2, "B": 3})
+	var o outer
+	if err := Decode(obj, &o); err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+	if o.Inner == nil || o.A != 2 || o.B != 3 {
+		t.Errorf("Decode wrong. got=%+v, inner=%+v", o, o.Inner)
+	}
+
+	// An embedded pointer to an unexported type cannot be allocated.
+	var h hidden
+	if err := Decode(obj, &h); err == nil || !strings.Contains(err.Error(), "field A") {
+		t.Errorf("wrong error decoding through unexported embedded pointer. got=%v", err)
+	}
+	obj, _ = FromGo(map[string]interface{}{"B": 4})
+	if err := Decode(obj, &h); err != nil || h.inner != nil || h.B != 4 {
+		t.Errorf("Decode without the promoted field wrong. got=%+v, err=%v", h, err)
+	}
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{42, "42"},
+		{int64(9007199254740993), "9007199254740993"},
+		{uint64(1 << 63), "9.223372036854776e+18"},
+		{uint8(7), "7"},
+		{1.5, "1.5"},
+		{"monkey", "monkey"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]interface{}{1, "two", nil}, "[1, two, null]"},
+		{map[string]interface{}{"a": []bool{true}}, "{a:[true]}"},
+		{&point{X: 1, Y: 2, Label: "p", Hidden: true}, ""},
+		{(*point)(nil), "null"},
+		{&String{Value: "already"}, "already"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%#v) returned error: %v", tt.input, err)
+			continue
+		}
+		if tt.expected != "" && obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v) wrong. want=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	obj, _ := FromGo(point{X: 1, Y: 2, Label: "p"})
+	hash, ok := obj.(*Hash)
+	if !ok {
+		t.Fatalf("struct not converted to Hash. got=%T", obj)
+	}
+	if len(hash.Pairs) != 3 {
+		t.Errorf("wrong number of fields. want=3, got=%d", len(hash.Pairs))
+	}
+	for key, want := range map[string]string{"X": "1", "Y": "2", "label": "p"} {
+		pair, ok := hash.Pairs[(&String{Value: key}).HashKey()]
+		if !ok {
+			t.Errorf("no pair for field %q", key)
+			continue
+		}
+		if pair.Value.Inspect() != want {
+			t.Errorf("field %q wrong. want=%q, got=%q", key, want, pair.Value.Inspect())
+		}
+	}
+
+	if _, err := FromGo(make(chan int)); err == nil {
+		t.Errorf("FromGo(chan int) did not return an error")
+	}
+}
+
+func TestToGo(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	key := &String{Value: "nums"}
+	hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: &Array{Elements: []Object{&Number{Value: 1}, &Integer{Value: 2}, NULL}}}
+
+	got, err := ToGo(hash)
+	if err != nil {
+		t.Fatalf("ToGo returned error: %v", err)
+	}
+	expected := map[string]interface{}{"nums": []interface{}{1.0, int64(2), nil}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ToGo wrong. want=%#v, got=%#v", expected, got)
+	}
+
+	if _, err := ToGo(&Builtin{}); err == nil {
+		t.Errorf("ToGo(builtin) did not return an error")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	obj, _ := FromGo(map[string]interface{}{"X": 3, "Y": 4, "label": "q"})
+	var p point
+	if err := Decode(obj, &p); err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+	if p != (point{X: 3, Y: 4, Label: "q"}) {
+		t.Errorf("Decode wrong. got=%+v", p)
+	}
+
+	var ints []int
+	obj, _ = FromGo([]float64{1, 2.5})
+	err := Decode(obj, &ints)
+	if err == nil || err.Error() != "element 1: cannot use 2.5 as int" {
+		t.Errorf("wrong error decoding non-integral number. got=%v", err)
+	}
+
+	var b bool
+	err = Decode(&String{Value: "x"}, &b)
+	if err == nil || err.Error() != "cannot use STRING as bool" {
+		t.Errorf("wrong error decoding mismatched type. got=%v", err)
+	}
+}
+
+func TestWrapFunc(t *testing.T) {
+	repeat, err := WrapFunc(func(s string, n int) (string, error) {
+		if n < 0 {
+			return "", errors.New("count must not be negative")
+		}
+		return strings.Repeat(s, n), nil
+	})
+	if err != nil {
+		t.Fatalf("WrapFunc returned error: %v", err)
+	}
+	sum, _ := WrapFunc(func(nums ...float64) float64 {
+		total := 0.0
+		for _, n := range nums {
+			total += n
+		}
+		return total
+	})
+	noop, _ := WrapFunc(func() {})
+
+	tests := []struct {
+		fn       *Builtin
+		args     []Object
+		expected string
+	}{
+		{repeat, []Object{&String{Value: "ab"}, &Number{Value: 3}}, "ababab"},
+		{repeat, []Object{&String{Value: "ab"}}, "ERROR: wrong number of arguments. got=1, want=2"},
+		{repeat, []Object{&Number{Value: 1}, &Number{Value: 3}}, "ERROR: argument 1: cannot use NUMBER as string"},
+		{repeat, []Object{&String{Value: "ab"}, &Number{Value: -1}}, "ERROR: count must not be negative"},
+		{sum, []Object{}, "0"},
+		{sum, []Object{&Number{Value: 1}, &Number{Value: 2.5}}, "3.5"},
+		{noop, []Object{}, "null"},
+	}
+	for _, tt := range tests {
+		result := tt.fn.Fn(tt.args...)
+		if result.Inspect() != tt.expected {
+			t.Errorf("wrong result. want=%q, got=%q", tt.expected, result.Inspect())
+		}
+	}
+
+	if _, err := WrapFunc(42); err == nil {
+		t.Errorf("WrapFunc(42) did not return an error")
+	}
+	if _, err := WrapFunc(nil); err == nil {
+		t.Errorf("WrapFunc(nil) did not return an error")
+	}
+	var nilFunc func(int) int
+	if _, err := WrapFunc(nilFunc); err == nil {
+		t.Errorf("WrapFunc with a nil func did not return an error")
+	}
+	if _, err := WrapFunc(func() (int, int) { return 0, 0 }); err == nil {
+		t.Errorf("WrapFunc with two non-error results did not return an error")
+	}
+}
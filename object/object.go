@@ -2,26 +2,40 @@ package object
 
 import (
 	"bytes"
-	"encoding/binary"
 	"fmt"
 	"go-compiler/main/ast"
+	"go-compiler/main/code"
+	"go-compiler/main/errors"
+	"go-compiler/main/token"
 	"hash/fnv"
+	"math"
+	"strconv"
 	"strings"
 )
 
 type ObjectType string
 
 const (
+	INTEGER_OBJ  = "INTEGER"
 	NUMBER_OBJ   = "NUMBER"
 	STRING_OBJ   = "STRING"
 	BOOLEAN_OBJ  = "BOOLEAN"
 	NULL_OBJ     = "NULL"
 	RETURN_OBJ   = "RETURN"
+	BREAK_OBJ    = "BREAK"
+	CONTINUE_OBJ = "CONTINUE"
 	FUNCITON_OBJ = "FUNCTION"
 	BUILTIN_OBJ  = "BUILTIN"
 	ARRAY_OBJ    = "ARRAY"
 	HASH_OBJ     = "HASH"
 	ERROR_OBJ    = "ERROR"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+
+	STRUCT_OBJ       = "STRUCT"
+	INSTANCE_OBJ     = "INSTANCE"
+	BOUND_METHOD_OBJ = "BOUND_METHOD"
+	ITERATOR_OBJ     = "ITERATOR"
 )
 
 type Object interface {
@@ -29,6 +43,26 @@ type Object interface {
 	Inspect() string
 }
 
+// The boolean and null values are singletons, so they can be compared by
+// identity.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+// Integer is a whole number, the value of an integer literal. Arithmetic on
+// two integers stays exact, and reports an error rather than wrapping around
+// when the result does not fit in 64 bits.
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Inspect() string  { return strconv.FormatInt(i.Value, 10) }
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+
+// Number is a floating-point number. Mixing a Number and an Integer in
+// arithmetic converts the Integer to a Number.
 type Number struct {
 	Value float64
 }
@@ -62,6 +96,19 @@ type ReturnValue struct {
 func (r *ReturnValue) Inspect() string  { return r.Value.Inspect() }
 func (r *ReturnValue) Type() ObjectType { return RETURN_OBJ }
 
+// Break and Continue carry a break or continue statement out of the blocks
+// around it to the loop it ends or continues, the way ReturnValue carries a
+// return to its function.
+type Break struct{}
+
+func (b *Break) Inspect() string  { return "break" }
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+
+type Continue struct{}
+
+func (c *Continue) Inspect() string  { return "continue" }
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatment
@@ -83,13 +130,82 @@ func (f *Function) Inspect() string {
 }
 func (f *Function) Type() ObjectType { return FUNCITON_OBJ }
 
+// CompiledFunction is a function body compiled to bytecode. The VM only runs
+// it wrapped in a Closure.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	Spans         code.SpanTable
+	NumLocals     int
+	NumParameters int
+	Upvalues      []UpvalueRef
+	Name          string
+}
+
+// UpvalueRef says where a closure captures one of its upvalues from when it
+// is created: a local slot of the enclosing function, or one of the enclosing
+// closure's own upvalues.
+type UpvalueRef struct {
+	IsLocal bool
+	Index   int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	if cf.Name == "" {
+		return "<fn>"
+	}
+	return "<fn " + cf.Name + ">"
+}
+
+// Closure is a compiled function together with the variables it captured
+// from the functions enclosing it. It is the VM's function value.
+type Closure struct {
+	Fn       *CompiledFunction
+	Upvalues []*Upvalue
+}
+
+func (c *Closure) Type() ObjectType { return FUNCITON_OBJ }
+func (c *Closure) Inspect() string  { return c.Fn.Inspect() }
+
+// Upvalue is a variable captured by a closure. While the function that
+// declared it is running, Value points at its slot on the VM stack; once that
+// function returns the variable is moved into Closed so it outlives the slot.
+type Upvalue struct {
+	Value  *Object
+	Closed Object
+	Slot   int
+}
+
+// Close moves the variable off the stack.
+func (u *Upvalue) Close() {
+	u.Closed = *u.Value
+	u.Value = &u.Closed
+}
+
 type Error struct {
 	Message string
+	Code    string
+	Span    token.Span // the expression that failed, if known
+}
+
+// NewError returns an error value with a formatted message. Builtins return
+// it to fail the call that invoked them.
+func NewError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
+// Diagnostic converts the runtime error into a diagnostic for rendering.
+func (e *Error) Diagnostic() *errors.Diagnostic {
+	code := e.Code
+	if code == "" {
+		code = errors.CodeRuntime
+	}
+	return errors.NewDiagnostic(errors.SeverityError, code, e.Span, e.Message)
+}
+
 type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
@@ -140,11 +256,11 @@ func (a *Hash) Inspect() string {
 
 type HashKey struct {
 	Type  ObjectType
-	Value uint32
+	Value uint64
 }
 
 func (b *Boolean) HashKey() HashKey {
-	var val uint32
+	var val uint64
 	if b.Value {
 		val = 1
 	} else {
@@ -154,19 +270,23 @@ func (b *Boolean) HashKey() HashKey {
 	return HashKey{Type: b.Type(), Value: val}
 }
 
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+// HashKey returns the key of the equal Integer for whole numbers, since 1 and
+// 1.0 are equal and must find the same hash entry.
 func (n *Number) HashKey() HashKey {
-	b := make([]byte, 8)
-	binary.LittleEndian.PutUint32(b, uint32(n.Value))
-	h := fnv.New32a()
-	h.Write(b)
-	return HashKey{Type: n.Type(), Value: h.Sum32()}
-	// return HashKey{Type: n.Type(), Value: n.Value}
+	if i, ok := exactInteger(n.Value); ok {
+		return (&Integer{Value: i}).HashKey()
+	}
+	return HashKey{Type: n.Type(), Value: math.Float64bits(n.Value)}
 }
 
 func (s *String) HashKey() HashKey {
-	h := fnv.New32a()
+	h := fnv.New64a()
 	h.Write([]byte(s.Value))
-	return HashKey{Type: s.Type(), Value: h.Sum32()}
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
 type Hashable interface {
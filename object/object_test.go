@@ -17,3 +17,22 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestNumberHashKey(t *testing.T) {
+	one := &Integer{Value: 1}
+	if one.HashKey() != (&Integer{Value: 1}).HashKey() {
+		t.Errorf("integers with same value have different hash keys")
+	}
+	if one.HashKey() != (&Number{Value: 1}).HashKey() {
+		t.Errorf("equal integer and number have different hash keys")
+	}
+	if one.HashKey() == (&Number{Value: 1.5}).HashKey() {
+		t.Errorf("1 and 1.5 have same hash keys")
+	}
+	if (&Integer{Value: 1 << 53}).HashKey() == (&Integer{Value: 1<<53 + 1}).HashKey() {
+		t.Errorf("large integers that differ have same hash keys")
+	}
+	if (&Number{Value: 0.1}).HashKey() != (&Number{Value: 0.1}).HashKey() {
+		t.Errorf("numbers with same value have different hash keys")
+	}
+}
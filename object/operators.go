@@ -0,0 +1,431 @@
+package object
+
+import (
+	"fmt"
+	"go-compiler/main/errors"
+	"math"
+)
+
+// The operator functions below define the semantics of the language's
+// operators for every engine that runs it. They report failures as an *Error
+// without a span; callers attach the span of the expression that failed.
+
+// Unary applies the prefix operator op to right.
+func Unary(op string, right Object) Object {
+	switch op {
+	case "!":
+		switch right {
+		case TRUE:
+			return FALSE
+		case FALSE:
+			return TRUE
+		case NULL:
+			return NULL
+		default:
+			return FALSE
+		}
+	case "-":
+		switch right := right.(type) {
+		case *Integer:
+			if right.Value == math.MinInt64 {
+				return overflowError("-(%d)", right.Value)
+			}
+			return &Integer{Value: -right.Value}
+		case *Number:
+			return &Number{Value: -right.Value}
+		}
+		return operatorError(errors.CodeUnknownOperator, "unknown operator: -%s", right.Type())
+	case "~":
+		if isNumeric(right) {
+			value, err := integral(right)
+			if err != nil {
+				return err
+			}
+			return &Integer{Value: ^value}
+		}
+		return operatorError(errors.CodeUnknownOperator, "unknown operator: ~%s", right.Type())
+	case "++", "--":
+		// The step of an increment or decrement expression.
+		step := &Integer{Value: 1}
+		if op == "--" {
+			step.Value = -1
+		}
+		switch right := right.(type) {
+		case *Integer:
+			return integerBinary("+", right, step)
+		case *Number:
+			return &Number{Value: right.Value + float64(step.Value)}
+		}
+		return operatorError(errors.CodeUnknownOperator, "unknown operator: %s%s", op, right.Type())
+	default:
+		return operatorError(errors.CodeUnknownOperator, "unknown operator: %s%s", op, right.Type())
+	}
+}
+
+// Binary applies the infix operator op to left and right.
+func Binary(op string, left, right Object) Object {
+	switch {
+	case isNumeric(left) && isNumeric(right):
+		if left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ {
+			return integerBinary(op, left.(*Integer), right.(*Integer))
+		}
+		return numberBinary(op, left, right)
+	case op == "+" && (left.Type() == STRING_OBJ || right.Type() == STRING_OBJ):
+		// Adding anything to a string concatenates its printed form, which
+		// is also how "${...}" embeds values in strings.
+		return &String{Value: left.Inspect() + right.Inspect()}
+	case (left.Type() == STRING_OBJ || isNumeric(left)) &&
+		(isNumeric(right) || right.Type() == STRING_OBJ):
+		return stringBinary(op, left, right)
+	case left.Type() != right.Type():
+		return operatorError(errors.CodeTypeMismatch, "type mismatch: %s %s %s",
+			left.Type(), op, right.Type())
+	case op == "==":
+		return NativeBool(left == right)
+	case op == "!=":
+		return NativeBool(left != right)
+	default:
+		return operatorError(errors.CodeUnknownOperator, "unknown operator: %s %s %s",
+			left.Type(), op, right.Type())
+	}
+}
+
+// integerBinary applies op to two integers. The result is exact: an error
+// reports a result too large for an Integer, or a division or modulo by
+// zero. / still divides exactly, so it yields a Number, as does ** with a
+// negative exponent. ~/ rounds down and % takes the sign of the divisor, so
+// that a == (a ~/ b) * b + a % b.
+func integerBinary(op string, left, right *Integer) Object {
+	l, r := left.Value, right.Value
+	switch op {
+	case "+":
+		if r > 0 && l > math.MaxInt64-r || r < 0 && l < math.MinInt64-r {
+			return overflowError("%d + %d", l, r)
+		}
+		return &Integer{Value: l + r}
+	case "-":
+		if r < 0 && l > math.MaxInt64+r || r > 0 && l < math.MinInt64+r {
+			return overflowError("%d - %d", l, r)
+		}
+		return &Integer{Value: l - r}
+	case "*":
+		product, ok := multiply(l, r)
+		if !ok {
+			return overflowError("%d * %d", l, r)
+		}
+		return &Integer{Value: product}
+	case "/":
+		return &Number{Value: float64(l) / float64(r)}
+	case "%":
+		if r == 0 {
+			return operatorError(errors.CodeDivisionByZero, "integer modulo by zero")
+		}
+		remainder := l % r
+		if remainder != 0 && (remainder < 0) != (r < 0) {
+			remainder += r
+		}
+		return &Integer{Value: remainder}
+	case "~/":
+		if r == 0 {
+			return operatorError(errors.CodeDivisionByZero, "integer division by zero")
+		}
+		if l == math.MinInt64 && r == -1 {
+			return overflowError("%d ~/ %d", l, r)
+		}
+		quotient := l / r
+		if l%r != 0 && (l < 0) != (r < 0) {
+			quotient--
+		}
+		return &Integer{Value: quotient}
+	case "**":
+		if r < 0 {
+			return &Number{Value: math.Pow(float64(l), float64(r))}
+		}
+		// Exponentiation by squaring; base is only squared when a later
+		// bit of the exponent needs it.
+		result, base := int64(1), l
+		for e := r; e > 0; e >>= 1 {
+			ok := true
+			if e&1 == 1 {
+				result, ok = multiply(result, base)
+			}
+			if ok && e > 1 {
+				base, ok = multiply(base, base)
+			}
+			if !ok {
+				return overflowError("%d ** %d", l, r)
+			}
+		}
+		return &Integer{Value: result}
+	case "&", "|", "^", "<<", ">>":
+		return bitwiseBinary(op, l, r)
+	case ">":
+		return NativeBool(l > r)
+	case "<":
+		return NativeBool(l < r)
+	case ">=":
+		return NativeBool(l >= r)
+	case "<=":
+		return NativeBool(l <= r)
+	case "==":
+		return NativeBool(l == r)
+	case "!=":
+		return NativeBool(l != r)
+	default:
+		return operatorError(errors.CodeUnknownOperator, "unknown operator: %s %s %s",
+			left.Type(), op, right.Type())
+	}
+}
+
+// numberBinary applies op to two numbers, at least one of them a Number, as
+// floating-point values. ~/ divides and rounds down, % takes the sign of
+// the divisor to match it, and ** raises left to the power of right. The
+// bitwise operators and shifts work on the operands as integers, so both
+// must be whole numbers that fit in an Integer.
+func numberBinary(op string, left, right Object) Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+	switch op {
+	case "+":
+		return &Number{Value: leftVal + rightVal}
+	case "-":
+		return &Number{Value: leftVal - rightVal}
+	case "*":
+		return &Number{Value: leftVal * rightVal}
+	case "/":
+		return &Number{Value: leftVal / rightVal}
+	case "%":
+		remainder := math.Mod(leftVal, rightVal)
+		if remainder != 0 && (remainder < 0) != (rightVal < 0) {
+			remainder += rightVal
+		}
+		return &Number{Value: remainder}
+	case "~/":
+		return &Number{Value: math.Floor(leftVal / rightVal)}
+	case "**":
+		return &Number{Value: math.Pow(leftVal, rightVal)}
+	case "&", "|", "^", "<<", ">>":
+		l, err := integral(left)
+		if err != nil {
+			return err
+		}
+		r, err := integral(right)
+		if err != nil {
+			return err
+		}
+		return bitwiseBinary(op, l, r)
+	case ">":
+		return NativeBool(leftVal > rightVal)
+	case "<":
+		return NativeBool(leftVal < rightVal)
+	case ">=":
+		return NativeBool(leftVal >= rightVal)
+	case "<=":
+		return NativeBool(leftVal <= rightVal)
+	case "==":
+		return NativeBool(leftVal == rightVal)
+	case "!=":
+		return NativeBool(leftVal != rightVal)
+	default:
+		return operatorError(errors.CodeUnknownOperator, "unknown operator: %s %s %s",
+			left.Type(), op, right.Type())
+	}
+}
+
+// bitwiseBinary applies a bitwise operator or shift. Shift counts must not
+// be negative.
+func bitwiseBinary(op string, l, r int64) Object {
+	if (op == "<<" || op == ">>") && r < 0 {
+		return operatorError(errors.CodeInvalidOperand, "negative shift count: %d", r)
+	}
+	var result int64
+	switch op {
+	case "&":
+		result = l & r
+	case "|":
+		result = l | r
+	case "^":
+		result = l ^ r
+	case "<<":
+		result = l << r
+		if r >= 64 || result>>r != l {
+			return overflowError("%d << %d", l, r)
+		}
+	case ">>":
+		result = l >> r
+	}
+	return &Integer{Value: result}
+}
+
+// integral converts a number to an int64 for a bitwise operator, or reports
+// that it is not a whole number in range.
+func integral(obj Object) (int64, *Error) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value, nil
+	case *Number:
+		if value, ok := exactInteger(obj.Value); ok {
+			return value, nil
+		}
+	}
+	return 0, operatorError(errors.CodeInvalidOperand, "bitwise operand must be an integer, got %s", obj.Inspect())
+}
+
+// exactInteger converts v to an int64 if it is a whole number in range.
+func exactInteger(v float64) (int64, bool) {
+	if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(v), true
+}
+
+// multiply returns l * r, or false if the product does not fit in an int64.
+func multiply(l, r int64) (int64, bool) {
+	product := l * r
+	if l != 0 && (product/l != r || l == -1 && r == math.MinInt64) {
+		return 0, false
+	}
+	return product, true
+}
+
+func isNumeric(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *Number:
+		return true
+	}
+	return false
+}
+
+// toFloat returns the value of an Integer or Number as a float64.
+func toFloat(obj Object) float64 {
+	if i, ok := obj.(*Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*Number).Value
+}
+
+func overflowError(format string, a ...interface{}) *Error {
+	return operatorError(errors.CodeIntegerOverflow, "integer overflow: "+format, a...)
+}
+
+func stringBinary(op string, left, right Object) Object {
+	leftVal := left.Inspect()
+	rightVal := right.Inspect()
+	switch op {
+	case "+":
+		return &String{Value: leftVal + rightVal}
+	case ">":
+		return NativeBool(leftVal > rightVal)
+	case "<":
+		return NativeBool(leftVal < rightVal)
+	case ">=":
+		return NativeBool(leftVal >= rightVal)
+	case "<=":
+		return NativeBool(leftVal <= rightVal)
+	case "==":
+		return NativeBool(leftVal == rightVal)
+	case "!=":
+		return NativeBool(leftVal != rightVal)
+	}
+	return operatorError(errors.CodeUnknownOperator, "unknown operator: %s %s %s",
+		left.Type(), op, right.Type())
+}
+
+// Index returns the element of left at index. Missing elements are null.
+// Strings are indexed by character, not by byte.
+func Index(left, index Object) Object {
+	switch {
+	case left.Type() == ARRAY_OBJ && isNumeric(index):
+		elements := left.(*Array).Elements
+		idx, ok := arrayIndex(index)
+		if !ok || idx < 0 || idx >= int64(len(elements)) {
+			return NULL
+		}
+		return elements[idx]
+	case left.Type() == STRING_OBJ && isNumeric(index):
+		chars := []rune(left.(*String).Value)
+		idx, ok := arrayIndex(index)
+		if !ok || idx < 0 || idx >= int64(len(chars)) {
+			return NULL
+		}
+		return &String{Value: string(chars[idx])}
+	case left.Type() == HASH_OBJ:
+		key, ok := index.(Hashable)
+		if !ok {
+			return operatorError(errors.CodeUnhashable, "unusable as hash key: %s", index.Type())
+		}
+		pair, ok := left.(*Hash).Pairs[key.HashKey()]
+		if !ok {
+			return NULL
+		}
+		return pair.Value
+	default:
+		return operatorError(errors.CodeIndexNotSupported, "index operator not supported: %s", left.Type())
+	}
+}
+
+// SetIndex sets the element of left at index to value and returns value.
+// Arrays are changed in place and only elements they have can be set; hashes
+// gain the key if they lack it.
+func SetIndex(left, index, value Object) Object {
+	switch left := left.(type) {
+	case *Array:
+		idx, ok := arrayIndex(index)
+		if !ok {
+			return operatorError(errors.CodeTypeMismatch, "array index must be INTEGER, got %s", index.Type())
+		}
+		if idx < 0 || idx >= int64(len(left.Elements)) {
+			return operatorError(errors.CodeIndexOutOfRange, "index out of range: %s (length %d)",
+				index.Inspect(), len(left.Elements))
+		}
+		left.Elements[idx] = value
+		return value
+	case *Hash:
+		if err := left.SetPair(index, value); err != nil {
+			return err
+		}
+		return value
+	default:
+		return operatorError(errors.CodeIndexNotSupported, "index assignment not supported: %s", left.Type())
+	}
+}
+
+// arrayIndex converts index to a position in an array. It must be an
+// Integer, or a Number holding a whole number.
+func arrayIndex(index Object) (int64, bool) {
+	switch index := index.(type) {
+	case *Integer:
+		return index.Value, true
+	case *Number:
+		return exactInteger(index.Value)
+	}
+	return 0, false
+}
+
+// SetPair binds key to value in hash.
+func (h *Hash) SetPair(key, value Object) *Error {
+	hashable, ok := key.(Hashable)
+	if !ok {
+		return operatorError(errors.CodeUnhashable, "unusable as hash key: %s", key.Type())
+	}
+	h.Pairs[hashable.HashKey()] = HashPair{Key: key, Value: value}
+	return nil
+}
+
+// IsTruthy reports whether obj counts as true in a condition. Only false and
+// null do not.
+func IsTruthy(obj Object) bool {
+	return obj != FALSE && obj != NULL
+}
+
+// NativeBool returns the boolean singleton for b.
+func NativeBool(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
+
+func operatorError(code string, format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Code: code}
+}
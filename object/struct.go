@@ -0,0 +1,169 @@
+package object
+
+import (
+	"bytes"
+	"go-compiler/main/errors"
+	"strings"
+)
+
+// Struct is a struct type declared by a script. Calling it creates an
+// instance: its init method, if it has one, is called with the arguments,
+// otherwise the arguments set its fields in the order they are declared.
+type Struct struct {
+	Name       string
+	Fields     []Field
+	Methods    map[string]Object // *Function or *Closure, depending on the engine
+	Superclass *Struct           // nil if the struct does not inherit
+}
+
+// Field is a field declared in a struct. Default is evaluated once, when the
+// struct is declared, and shared by the instances that do not set the field.
+type Field struct {
+	Name    string
+	Default Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string  { return "<struct " + s.Name + ">" }
+
+// Method returns the method of s called name, looking it up on the
+// superclasses of s if s does not define it.
+func (s *Struct) Method(name string) (Object, bool) {
+	for ; s != nil; s = s.Superclass {
+		if method, ok := s.Methods[name]; ok {
+			return method, true
+		}
+	}
+	return nil, false
+}
+
+// Inherit makes superclass the superclass of s. The fields of superclass
+// come first in s, followed by the fields only s declares; a field both
+// declare keeps its place but takes the default s gives it.
+func (s *Struct) Inherit(superclass Object) *Error {
+	super, ok := superclass.(*Struct)
+	if !ok {
+		return operatorError(errors.CodeInvalidSuperclass, "superclass must be a struct, got %s", superclass.Type())
+	}
+	fields := append([]Field{}, super.Fields...)
+	for _, f := range s.Fields {
+		inherited := false
+		for i := range fields {
+			if fields[i].Name == f.Name {
+				fields[i] = f
+				inherited = true
+				break
+			}
+		}
+		if !inherited {
+			fields = append(fields, f)
+		}
+	}
+	s.Fields = fields
+	s.Superclass = super
+	return nil
+}
+
+// Instance is a value of a struct type.
+type Instance struct {
+	Struct *Struct
+	Fields map[string]Object
+}
+
+// NewInstance returns an instance of s with every field set to its default,
+// or null if it has none.
+func NewInstance(s *Struct) *Instance {
+	fields := make(map[string]Object, len(s.Fields))
+	for _, f := range s.Fields {
+		value := f.Default
+		if value == nil {
+			value = NULL
+		}
+		fields[f.Name] = value
+	}
+	return &Instance{Struct: s, Fields: fields}
+}
+
+func (i *Instance) Type() ObjectType { return INSTANCE_OBJ }
+func (i *Instance) Inspect() string {
+	var out bytes.Buffer
+	fields := []string{}
+	for _, f := range i.Struct.Fields {
+		fields = append(fields, f.Name+": "+i.Fields[f.Name].Inspect())
+	}
+	out.WriteString(i.Struct.Name + "{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// SetFields sets the fields of i from the arguments of a call to a struct
+// without an init method. Fields without an argument keep their defaults.
+func (i *Instance) SetFields(args []Object) *Error {
+	if len(args) > len(i.Struct.Fields) {
+		return operatorError(errors.CodeRuntime, "wrong number of arguments. got=%d, want at most %d",
+			len(args), len(i.Struct.Fields))
+	}
+	for idx, arg := range args {
+		i.Fields[i.Struct.Fields[idx].Name] = arg
+	}
+	return nil
+}
+
+// BoundMethod is a method looked up on an instance. Calling it runs the
+// method with this set to the instance.
+type BoundMethod struct {
+	Receiver *Instance
+	Method   Object
+	Name     string
+}
+
+func (b *BoundMethod) Type() ObjectType { return BOUND_METHOD_OBJ }
+func (b *BoundMethod) Inspect() string {
+	return "<method " + b.Receiver.Struct.Name + "." + b.Name + ">"
+}
+
+// GetProperty returns the field of obj called name, or its method of that
+// name bound to obj. Fields shadow methods.
+func GetProperty(obj Object, name string) Object {
+	instance, ok := obj.(*Instance)
+	if !ok {
+		return operatorError(errors.CodeNoProperties, "only instances have properties, got %s", obj.Type())
+	}
+	if value, ok := instance.Fields[name]; ok {
+		return value
+	}
+	if method, ok := instance.Struct.Method(name); ok {
+		return &BoundMethod{Receiver: instance, Method: method, Name: name}
+	}
+	return operatorError(errors.CodeUndefined, "undefined property %s on %s", name, instance.Struct.Name)
+}
+
+// SuperMethod returns the method of superclass called name bound to
+// receiver, the value of super.name in a method of a struct inheriting from
+// superclass.
+func SuperMethod(superclass *Struct, receiver Object, name string) Object {
+	instance, ok := receiver.(*Instance)
+	if !ok {
+		return operatorError(errors.CodeNoProperties, "only instances have methods, got %s", receiver.Type())
+	}
+	method, ok := superclass.Method(name)
+	if !ok {
+		return operatorError(errors.CodeUndefined, "undefined method %s on %s", name, superclass.Name)
+	}
+	return &BoundMethod{Receiver: instance, Method: method, Name: name}
+}
+
+// SetProperty sets the field of obj called name to value and returns value.
+// Only fields the struct declares can be set.
+func SetProperty(obj Object, name string, value Object) Object {
+	instance, ok := obj.(*Instance)
+	if !ok {
+		return operatorError(errors.CodeNoProperties, "only instances have fields, got %s", obj.Type())
+	}
+	if _, ok := instance.Fields[name]; !ok {
+		return operatorError(errors.CodeUndefined, "undefined field %s on %s", name, instance.Struct.Name)
+	}
+	instance.Fields[name] = value
+	return value
+}
@@ -3,38 +3,66 @@ package parser
 import (
 	"fmt"
 	"go-compiler/main/ast"
+	"go-compiler/main/errors"
 	"go-compiler/main/token"
-	"strconv"
+	"strings"
 )
 
 const (
 	_ int = iota
 	LOWEST
 	ASSIGN
-	AND         // and OR or
+	CONDITIONAL // ? :
+	COALESCE    // ??
+	OR          // or
+	AND         // and
 	EQUALS      // ==
 	LESSGREATER // > OR <
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
+	SHIFT       // << OR >>
 	SUM         // + OR -
-	PRODUCT     // * OR /
-	PREFIX      // -X OR !X
+	PRODUCT     // * OR / OR ~/ OR %
+	PREFIX      // -X OR !X OR ~X
+	POWER       // **
 	CALL        // myFunction(X)
 	INDEX
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQUAL:        ASSIGN,
-	token.AND:          AND,
-	token.OR:           AND,
-	token.EQUAL_EQUAL:  EQUALS,
-	token.BANG_EQUAL:   EQUALS,
-	token.GREATER:      LESSGREATER,
-	token.LESS:         LESSGREATER,
-	token.PLUS:         SUM,
-	token.MINUS:        SUM,
-	token.SLASH:        PRODUCT,
-	token.STAR:         PRODUCT,
-	token.LEFT_PAREN:   CALL,
-	token.LEFT_BRACKET: INDEX,
+	token.EQUAL:             ASSIGN,
+	token.PLUS_EQUAL:        ASSIGN,
+	token.MINUS_EQUAL:       ASSIGN,
+	token.STAR_EQUAL:        ASSIGN,
+	token.SLASH_EQUAL:       ASSIGN,
+	token.PERCENT_EQUAL:     ASSIGN,
+	token.PLUS_PLUS:         CALL,
+	token.MINUS_MINUS:       CALL,
+	token.QUESTION:          CONDITIONAL,
+	token.QUESTION_QUESTION: COALESCE,
+	token.AND:               AND,
+	token.OR:                OR,
+	token.EQUAL_EQUAL:       EQUALS,
+	token.BANG_EQUAL:        EQUALS,
+	token.GREATER:           LESSGREATER,
+	token.LESS:              LESSGREATER,
+	token.PLUS:              SUM,
+	token.MINUS:             SUM,
+	token.SLASH:             PRODUCT,
+	token.STAR:              PRODUCT,
+	token.TILDE_SLASH:       PRODUCT,
+	token.PERCENT:           PRODUCT,
+	token.STAR_STAR:         POWER,
+	token.AMPERSAND:         BITAND,
+	token.PIPE:              BITOR,
+	token.CARET:             BITXOR,
+	token.LESS_LESS:         SHIFT,
+	token.GREATER_GREATER:   SHIFT,
+	token.LEFT_PAREN:        CALL,
+	token.LEFT_BRACKET:      INDEX,
+	token.QUESTION_BRACKET:  INDEX,
+	token.DOT:               INDEX,
 }
 
 type (
@@ -47,13 +75,20 @@ type Parser struct {
 	current        int
 	currToken      *token.Token
 	peekToken      *token.Token
-	errors         []string
+	currDoc        string // the doc comments directly before currToken
+	peekDoc        string // the doc comments directly before peekToken
+	errors         errors.List
+	panicMode      bool   // set after an error until the parser resynchronizes
+	braceDepth     int    // number of braces open at currToken
+	blocks         []int  // braceDepth just inside each block being parsed
+	methods        []bool // for each method enclosing currToken, whether its struct has a superclass
+	loops          int    // number of loops enclosing currToken in the function being parsed
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
 
 func NewParser(tokens []*token.Token) *Parser {
-	p := &Parser{tokens: tokens, current: 0, errors: []string{}}
+	p := &Parser{tokens: tokens, current: 0, errors: errors.List{}}
 
 	p.nextToken()
 	p.nextToken()
@@ -62,43 +97,91 @@ func NewParser(tokens []*token.Token) *Parser {
 	p.registerPrefix(token.IDENTIFIER, p.parseIdentifier)
 	p.registerPrefix(token.NUMBER, p.parseNumberLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.INTERPOLATION, p.parseInterpolation)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LEFT_PAREN, p.parseGroupedExpressions)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.WHILE, p.parseWhileExpression)
-	// p.registerPrefix(token.FOR, p.parseForExpression)
+	p.registerPrefix(token.FOR, p.parseForExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.LEFT_BRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LEFT_BRACE, p.parseHashLiteral)
+	p.registerPrefix(token.THIS, p.parseThisExpression)
+	p.registerPrefix(token.SUPER, p.parseSuperExpression)
+	p.registerPrefix(token.PLUS_PLUS, p.parsePrefixUpdate)
+	p.registerPrefix(token.MINUS_MINUS, p.parsePrefixUpdate)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.STAR, p.parseInfixExpression)
+	p.registerInfix(token.TILDE_SLASH, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.STAR_STAR, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.LESS_LESS, p.parseInfixExpression)
+	p.registerInfix(token.GREATER_GREATER, p.parseInfixExpression)
 	p.registerInfix(token.EQUAL_EQUAL, p.parseInfixExpression)
 	p.registerInfix(token.BANG_EQUAL, p.parseInfixExpression)
 	p.registerInfix(token.LESS, p.parseInfixExpression)
 	p.registerInfix(token.GREATER, p.parseInfixExpression)
-	p.registerInfix(token.AND, p.parseInfixExpression)
-	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseLogicalExpression)
+	p.registerInfix(token.OR, p.parseLogicalExpression)
+	p.registerInfix(token.QUESTION_QUESTION, p.parseLogicalExpression)
+	p.registerInfix(token.QUESTION, p.parseConditionalExpression)
 	p.registerInfix(token.LEFT_PAREN, p.parseCallExpression)
 	p.registerInfix(token.LEFT_BRACKET, p.parseIndexExpression)
+	p.registerInfix(token.QUESTION_BRACKET, p.parseIndexExpression)
 	p.registerInfix(token.EQUAL, p.parseAssignExpression)
+	p.registerInfix(token.DOT, p.parsePropertyExpression)
+	p.registerInfix(token.PLUS_EQUAL, p.parseCompoundAssignment)
+	p.registerInfix(token.MINUS_EQUAL, p.parseCompoundAssignment)
+	p.registerInfix(token.STAR_EQUAL, p.parseCompoundAssignment)
+	p.registerInfix(token.SLASH_EQUAL, p.parseCompoundAssignment)
+	p.registerInfix(token.PERCENT_EQUAL, p.parseCompoundAssignment)
+	p.registerInfix(token.PLUS_PLUS, p.parsePostfixUpdate)
+	p.registerInfix(token.MINUS_MINUS, p.parsePostfixUpdate)
 	return p
 }
 
 func (p *Parser) nextToken() {
 	p.currToken = p.peekToken
-	if p.current < len(p.tokens) {
-		p.peekToken = p.tokens[p.current]
-	} else {
-		p.peekToken = nil
+	p.currDoc = p.peekDoc
+	p.peekDoc = ""
+	// Once the tokens run out keep peeking at the final EOF token. Doc
+	// comments are collected for the token after them and trivia skipped.
+	for p.current < len(p.tokens) {
+		next := p.tokens[p.current]
+		p.current++
+		if next.Type == token.DOC_COMMENT {
+			if p.peekDoc != "" {
+				p.peekDoc += "\n"
+			}
+			p.peekDoc += next.Literal.(string)
+			continue
+		}
+		if next.Type.IsTrivia() {
+			continue
+		}
+		p.peekToken = next
+		break
+	}
+	if p.currToken == nil {
+		return
+	}
+	switch p.currToken.Type {
+	case token.LEFT_BRACE:
+		p.braceDepth++
+	case token.RIGHT_BRACE:
+		p.braceDepth--
 	}
-	p.current++
 }
 
 func (p *Parser) Parse() *ast.Program {
@@ -107,6 +190,10 @@ func (p *Parser) Parse() *ast.Program {
 
 	for !p.currTokenIs(token.EOF) {
 		statement := p.parseStatement()
+		if p.panicMode {
+			p.synchronize()
+			continue
+		}
 
 		if statement != nil {
 			program.Statements = append(program.Statements, statement)
@@ -117,20 +204,64 @@ func (p *Parser) Parse() *ast.Program {
 	return program
 }
 
+// parseStatement parses the statement starting at currToken. It returns nil
+// if the statement could not be parsed, in which case the parser is left in
+// panic mode.
 func (p *Parser) parseStatement() ast.Statement {
-
+	var statement ast.Statement
 	switch p.currToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		if s := p.parseLetStatement(); s != nil {
+			statement = s
+		}
 	case token.RETURN:
-		return p.parseReturnStatement()
+		statement = p.parseReturnStatement()
+	case token.BREAK, token.CONTINUE:
+		statement = p.parseLoopControlStatement()
+	case token.STRUCT:
+		if s := p.parseStructStatement(); s != nil {
+			statement = s
+		}
 	default:
-		return p.parseExpressionStatement()
+		statement = p.parseExpressionStatement()
+	}
+	if p.panicMode {
+		return nil
+	}
+	return statement
+}
+
+// synchronize discards tokens after a parse error until it reaches the start
+// of the next statement: just past a ';', before a 'let', 'return', 'break',
+// 'continue', 'fn' or 'struct', or at the '}' closing the block being parsed.
+// Errors are reported again from there on.
+func (p *Parser) synchronize() {
+	p.panicMode = false
+	for !p.currTokenIs(token.EOF) {
+		switch {
+		case p.currTokenIs(token.SEMICOLON):
+			p.nextToken()
+			return
+		case p.currTokenIs(token.RIGHT_BRACE) && p.closesBlock():
+			return
+		}
+		switch p.peekToken.Type {
+		case token.LET, token.RETURN, token.BREAK, token.CONTINUE, token.FUNCTION, token.STRUCT:
+			p.nextToken()
+			return
+		}
+		p.nextToken()
 	}
 }
 
+// closesBlock reports whether currToken is the '}' ending the innermost
+// block statement or struct body being parsed.
+func (p *Parser) closesBlock() bool {
+	return len(p.blocks) > 0 && p.braceDepth == p.blocks[len(p.blocks)-1]-1
+}
+
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	statement := &ast.LetStatement{Token: p.currToken}
+	statement := &ast.LetStatement{Token: p.currToken, Doc: p.currDoc}
 	if !p.expectPeek(token.IDENTIFIER) {
 		return nil
 	}
@@ -149,6 +280,100 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return statement
 }
 
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	statement := &ast.StructStatement{Token: p.currToken, Doc: p.currDoc}
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil
+	}
+	statement.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
+	if p.peekTokenIs(token.LESS) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENTIFIER) {
+			return nil
+		}
+		if p.currToken.Lexeme == statement.Name.Value {
+			p.error(errors.TokenError(errors.CodeInheritsItself, p.currToken,
+				fmt.Sprintf("struct %s cannot inherit from itself", statement.Name.Value)))
+			return nil
+		}
+		statement.Superclass = &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
+	}
+	if !p.expectPeek(token.LEFT_BRACE) {
+		return nil
+	}
+
+	p.blocks = append(p.blocks, p.braceDepth)
+	defer func() { p.blocks = p.blocks[:len(p.blocks)-1] }()
+	p.nextToken()
+
+	for !p.currTokenIs(token.RIGHT_BRACE) && !p.currTokenIs(token.EOF) {
+		switch p.currToken.Type {
+		case token.IDENTIFIER:
+			if field := p.parseStructField(); field != nil {
+				statement.Fields = append(statement.Fields, field)
+			}
+		case token.FUNCTION:
+			if method := p.parseMethod(statement.Superclass != nil); method != nil {
+				statement.Methods = append(statement.Methods, method)
+			}
+		default:
+			p.error(errors.TokenError(errors.CodeUnexpectedToken, p.currToken,
+				fmt.Sprintf("expected field or method in struct %s, got %s", statement.Name.Value, p.currToken.Type)))
+		}
+		if p.panicMode {
+			p.synchronize()
+			continue
+		}
+		p.nextToken()
+	}
+	if !p.currTokenIs(token.RIGHT_BRACE) {
+		p.error(errors.TokenError(errors.CodeUnexpectedToken, p.currToken, "expected '}' to close struct"))
+		return nil
+	}
+	statement.EndToken = p.currToken
+	return statement
+}
+
+// parseStructField parses a field declaration, name or name = default,
+// optionally followed by a ';'.
+func (p *Parser) parseStructField() *ast.StructField {
+	field := &ast.StructField{Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}}
+	if p.peekTokenIs(token.EQUAL) {
+		p.nextToken()
+		p.nextToken()
+		field.Value = p.parseExpression(LOWEST)
+		if p.panicMode {
+			return nil
+		}
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return field
+}
+
+// parseMethod parses a method declaration: fn name(parameters) { body }.
+// subclass says whether the struct declaring it has a superclass.
+func (p *Parser) parseMethod(subclass bool) *ast.Method {
+	fn := &ast.FunctionLiteral{Token: p.currToken}
+	doc := p.currDoc
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil
+	}
+	method := &ast.Method{Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}, Function: fn, Doc: doc}
+	if !p.expectPeek(token.LEFT_PAREN) {
+		return nil
+	}
+	fn.Parameters = p.parseFunctionParameters()
+	if !p.expectPeek(token.LEFT_BRACE) {
+		return nil
+	}
+	p.methods = append(p.methods, subclass)
+	fn.Body = p.parseFunctionBody()
+	p.methods = p.methods[:len(p.methods)-1]
+	return method
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	statement := &ast.ReturnStatement{Token: p.currToken}
 	p.nextToken()
@@ -160,6 +385,26 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return statement
 }
 
+// parseLoopControlStatement parses a break or continue statement, which may
+// only appear inside a loop.
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	if p.loops == 0 {
+		p.error(errors.TokenError(errors.CodeOutsideLoop, p.currToken,
+			fmt.Sprintf("'%s' used outside of a loop", p.currToken.Lexeme)))
+		return nil
+	}
+	var statement ast.Statement
+	if p.currTokenIs(token.BREAK) {
+		statement = &ast.BreakStatement{Token: p.currToken}
+	} else {
+		statement = &ast.ContinueStatement{Token: p.currToken}
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	statement := &ast.ExpressionStatement{Token: p.currToken}
 	statement.Expression = p.parseExpression(LOWEST)
@@ -176,7 +421,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		return nil
 	}
 	leftExp := prefix()
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecendence() {
+	for !p.panicMode && !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecendence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -226,22 +471,122 @@ func (p *Parser) parseWhileExpression() ast.Expression {
 	if !p.expectPeek(token.LEFT_BRACE) {
 		return nil
 	}
-	expression.Body = p.parseBlockStatement()
+	expression.Body = p.parseLoopBody()
+	return expression
+}
+
+// parseForExpression parses a C-style loop, for (init; condition; update)
+// { body }, or a for-in loop, for (name in iterable) { body }.
+func (p *Parser) parseForExpression() ast.Expression {
+	forToken := p.currToken
+	if !p.expectPeek(token.LEFT_PAREN) {
+		return nil
+	}
+	p.nextToken()
+	if p.currTokenIs(token.IDENTIFIER) && p.peekTokenIs(token.IN) {
+		return p.parseForInExpression(forToken)
+	}
+
+	expression := &ast.ForExpression{Token: forToken}
+	switch p.currToken.Type {
+	case token.SEMICOLON:
+		// no init clause
+	case token.LET:
+		init := p.parseLetStatement()
+		if init == nil {
+			return nil
+		}
+		expression.Init = init
+		if !p.currTokenIs(token.SEMICOLON) && !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	default:
+		expression.Init = &ast.ExpressionStatement{Token: p.currToken, Expression: p.parseExpression(LOWEST)}
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		expression.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+	if !p.peekTokenIs(token.RIGHT_PAREN) {
+		p.nextToken()
+		expression.Update = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.RIGHT_PAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LEFT_BRACE) {
+		return nil
+	}
+	expression.Body = p.parseLoopBody()
+	return expression
+}
+
+func (p *Parser) parseForInExpression(forToken *token.Token) ast.Expression {
+	expression := &ast.ForInExpression{
+		Token:    forToken,
+		Variable: &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme},
+	}
+	// consume in
+	p.nextToken()
+	p.nextToken()
+	expression.Iterable = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RIGHT_PAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LEFT_BRACE) {
+		return nil
+	}
+	expression.Body = p.parseLoopBody()
 	return expression
 }
 
+// parseLoopBody parses the block of a loop, in which break and continue
+// refer to the loop.
+func (p *Parser) parseLoopBody() *ast.BlockStatment {
+	p.loops++
+	defer func() { p.loops-- }()
+	return p.parseBlockStatement()
+}
+
+// parseFunctionBody parses the block of a function or method. Loops around
+// the function do not extend into it.
+func (p *Parser) parseFunctionBody() *ast.BlockStatment {
+	loops := p.loops
+	p.loops = 0
+	defer func() { p.loops = loops }()
+	return p.parseBlockStatement()
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatment {
 	block := &ast.BlockStatment{Token: *p.currToken}
 	block.Statements = []ast.Statement{}
+	p.blocks = append(p.blocks, p.braceDepth)
+	defer func() { p.blocks = p.blocks[:len(p.blocks)-1] }()
 	p.nextToken()
 
 	for !p.currTokenIs(token.RIGHT_BRACE) && !p.currTokenIs(token.EOF) {
 		statement := p.parseStatement()
+		if p.panicMode {
+			p.synchronize()
+			continue
+		}
 		if statement != nil {
 			block.Statements = append(block.Statements, statement)
 		}
 		p.nextToken()
 	}
+	if !p.currTokenIs(token.RIGHT_BRACE) {
+		p.error(errors.TokenError(errors.CodeUnexpectedToken, p.currToken, "expected '}' to close block"))
+		return block
+	}
+	block.EndToken = p.currToken
 	return block
 
 }
@@ -256,7 +601,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.LEFT_BRACE) {
 		return nil
 	}
-	expression.Body = p.parseBlockStatement()
+	expression.Body = p.parseFunctionBody()
 	return expression
 }
 
@@ -267,7 +612,9 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers
 	}
 	// consume (
-	p.nextToken()
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil
+	}
 	identifier := &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
 	identifiers = append(identifiers, identifier)
 
@@ -275,7 +622,9 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		// consume ,
 		p.nextToken()
 		// consume y
-		p.nextToken()
+		if !p.expectPeek(token.IDENTIFIER) {
+			return nil
+		}
 		identifier = &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
 		identifiers = append(identifiers, identifier)
 	}
@@ -289,6 +638,9 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	expression := &ast.CallExpression{Token: p.currToken, Function: function}
 	expression.Arguments = p.parseExpressionList(token.RIGHT_PAREN)
+	if p.currTokenIs(token.RIGHT_PAREN) {
+		expression.EndToken = p.currToken
+	}
 	return expression
 }
 
@@ -296,17 +648,77 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
 }
 
+// parseNumberLiteral takes the value the scanner decoded: an int64 for an
+// integer literal, a float64 for one with a fraction or an exponent.
 func (p *Parser) parseNumberLiteral() ast.Expression {
-	f, err := strconv.ParseFloat(p.currToken.Lexeme, 64)
-	if err != nil {
-		message := token.TokenError(p.peekToken, fmt.Sprintf("could not parse %q as integer", p.currToken.Lexeme))
-		p.errors = append(p.errors, message)
-		return nil
+	switch value := p.currToken.Literal.(type) {
+	case int64:
+		return &ast.IntegerLiteral{Token: p.currToken, Value: value}
+	case float64:
+		return &ast.NumberLiteral{Token: p.currToken, Value: value}
 	}
-	return &ast.NumberLiteral{Token: p.currToken, Value: f}
+	p.error(errors.TokenError(errors.CodeInvalidNumber, p.currToken,
+		fmt.Sprintf("could not parse %q as number", p.currToken.Lexeme)))
+	return nil
 }
 func (p *Parser) parseStringLiteral() ast.Expression {
-	return &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Lexeme}
+	return &ast.StringLiteral{Token: p.currToken, Value: stringValue(p.currToken)}
+}
+
+// parseInterpolation parses a string with embedded expressions, lowering
+// "a ${x} b" to the concatenation ("a " + x) + " b". The concatenations
+// keep the INTERPOLATION token that precedes their expression.
+func (p *Parser) parseInterpolation() ast.Expression {
+	var result ast.Expression = &ast.StringLiteral{Token: p.currToken, Value: stringValue(p.currToken)}
+	for p.currTokenIs(token.INTERPOLATION) {
+		part := p.currToken
+		p.nextToken()
+		embedded := p.parseExpression(LOWEST)
+		if embedded == nil {
+			return nil
+		}
+		result = &ast.InfixExpression{Token: part, Left: result, Operator: "+", Right: embedded}
+		if !p.peekTokenIs(token.STRING) && !p.peekTokenIs(token.INTERPOLATION) {
+			p.peekError(token.RIGHT_BRACE)
+			return nil
+		}
+		p.nextToken()
+		if value := stringValue(p.currToken); value != "" {
+			rest := &ast.StringLiteral{Token: p.currToken, Value: value}
+			result = &ast.InfixExpression{Token: part, Left: result, Operator: "+", Right: rest}
+		}
+	}
+	return result
+}
+
+// stringValue returns the string a STRING or INTERPOLATION token denotes.
+func stringValue(t *token.Token) string {
+	if value, ok := t.Literal.(string); ok {
+		return value
+	}
+	return t.Lexeme
+}
+
+func (p *Parser) parseThisExpression() ast.Expression {
+	if len(p.methods) == 0 {
+		p.error(errors.TokenError(errors.CodeInvalidThis, p.currToken, "'this' used outside of a method"))
+		return nil
+	}
+	return &ast.ThisExpression{Token: p.currToken}
+}
+
+func (p *Parser) parseSuperExpression() ast.Expression {
+	if len(p.methods) == 0 || !p.methods[len(p.methods)-1] {
+		p.error(errors.TokenError(errors.CodeInvalidSuper, p.currToken,
+			"'super' used outside of a method of a struct with a superclass"))
+		return nil
+	}
+	expression := &ast.SuperExpression{Token: p.currToken}
+	if !p.expectPeek(token.DOT) || !p.expectPeek(token.IDENTIFIER) {
+		return nil
+	}
+	expression.Method = &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
+	return expression
 }
 
 func (p *Parser) parseBoolean() ast.Expression {
@@ -334,14 +746,44 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	expression := &ast.InfixExpression{Token: p.currToken, Left: left, Operator: p.currToken.Lexeme}
 	precedence := p.currPrecendence()
+	if p.currTokenIs(token.STAR_STAR) {
+		// ** is right-associative: 2 ** 3 ** 2 is 2 ** (3 ** 2).
+		precedence--
+	}
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+	return expression
+}
+
+func (p *Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
+	expression := &ast.LogicalExpression{Token: p.currToken, Left: left, Operator: p.currToken.Lexeme}
+	precedence := p.currPrecendence()
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 	return expression
 }
 
+// parseConditionalExpression parses cond ? then : else. The then branch runs
+// up to the first ':' that is not part of it, so a conditional can be a hash
+// key; conditionals nest to the right.
+func (p *Parser) parseConditionalExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{Token: p.currToken, Condition: condition}
+	p.nextToken()
+	expression.Then = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+	p.nextToken()
+	expression.Else = p.parseExpression(CONDITIONAL - 1)
+	return expression
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	arr := &ast.ArrayLiteral{Token: *p.currToken}
 	arr.Elements = p.parseExpressionList(token.RIGHT_BRACKET)
+	if p.currTokenIs(token.RIGHT_BRACKET) {
+		arr.EndToken = p.currToken
+	}
 	return arr
 }
 
@@ -352,21 +794,103 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RIGHT_BRACKET) {
 		return nil
 	}
+	expression.EndToken = p.currToken
+	return expression
+}
+
+func (p *Parser) parsePropertyExpression(object ast.Expression) ast.Expression {
+	expression := &ast.PropertyExpression{Token: p.currToken, Object: object}
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil
+	}
+	expression.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Lexeme}
 	return expression
 }
 
+// parseAssignExpression parses an assignment to a variable, a property or an
+// index expression. Anything else on the left of the '=' is an error.
 func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
-	expression := &ast.AssignStatement{Token: *p.currToken}
-	p.nextToken()
-	identifier, ok := left.(*ast.Identifier)
-	if !ok {
+	switch target := left.(type) {
+	case *ast.Identifier:
+		expression := &ast.AssignStatement{Token: *p.currToken, Name: target}
+		p.nextToken()
+		expression.Value = p.parseExpression(LOWEST)
+		return expression
+	case *ast.PropertyExpression:
+		expression := &ast.PropertyAssignment{Token: p.currToken, Target: target}
+		p.nextToken()
+		expression.Value = p.parseExpression(LOWEST)
+		return expression
+	case *ast.IndexExpression:
+		if target.Optional() {
+			p.invalidTarget(left)
+			return nil
+		}
+		expression := &ast.IndexAssignment{Token: p.currToken, Target: target}
+		p.nextToken()
+		expression.Value = p.parseExpression(LOWEST)
+		return expression
+	default:
+		p.invalidTarget(left)
 		return nil
 	}
-	expression.Name = identifier
+}
+
+// parseCompoundAssignment parses target op= value.
+func (p *Parser) parseCompoundAssignment(left ast.Expression) ast.Expression {
+	if !isUpdatable(left) {
+		p.invalidTarget(left)
+		return nil
+	}
+	expression := &ast.CompoundAssignment{
+		Token:    p.currToken,
+		Target:   left,
+		Operator: strings.TrimSuffix(p.currToken.Lexeme, "="),
+	}
+	p.nextToken()
 	expression.Value = p.parseExpression(LOWEST)
 	return expression
 }
 
+func (p *Parser) parsePrefixUpdate() ast.Expression {
+	expression := &ast.UpdateExpression{Token: p.currToken, Operator: p.currToken.Lexeme, Prefix: true}
+	p.nextToken()
+	expression.Target = p.parseExpression(PREFIX)
+	if expression.Target == nil {
+		return nil
+	}
+	if !isUpdatable(expression.Target) {
+		p.invalidTarget(expression.Target)
+		return nil
+	}
+	return expression
+}
+
+func (p *Parser) parsePostfixUpdate(left ast.Expression) ast.Expression {
+	if !isUpdatable(left) {
+		p.invalidTarget(left)
+		return nil
+	}
+	return &ast.UpdateExpression{Token: p.currToken, Operator: p.currToken.Lexeme, Target: left}
+}
+
+// isUpdatable reports whether target can be read and assigned in place by a
+// compound assignment or an update expression.
+func isUpdatable(target ast.Expression) bool {
+	switch target := target.(type) {
+	case *ast.Identifier, *ast.PropertyExpression:
+		return true
+	case *ast.IndexExpression:
+		return !target.Optional()
+	}
+	return false
+}
+
+func (p *Parser) invalidTarget(target ast.Expression) {
+	p.error(errors.Errorf(errors.CodeInvalidAssignment, target.Span(),
+		"invalid assignment target: %s", target.String()))
+}
+
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	list := []ast.Expression{}
 	if p.peekTokenIs(end) {
@@ -398,6 +922,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
 	if p.peekTokenIs(token.RIGHT_BRACE) {
 		p.nextToken()
+		hash.EndToken = p.currToken
 		return hash
 	}
 	for !p.peekTokenIs(token.RIGHT_BRACE) {
@@ -445,6 +970,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RIGHT_BRACE) {
 		return nil
 	}
+	hash.EndToken = p.currToken
 	return hash
 }
 
@@ -466,18 +992,21 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
-func (p *Parser) peekPrecendence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
+// Precedence returns how tightly the infix or postfix operator t binds, or
+// LOWEST if t is not one.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
 		return p
 	}
 	return LOWEST
 }
 
+func (p *Parser) peekPrecendence() int {
+	return Precedence(p.peekToken.Type)
+}
+
 func (p *Parser) currPrecendence() int {
-	if p, ok := precedences[p.currToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return Precedence(p.currToken.Type)
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -488,19 +1017,27 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) peekError(t token.TokenType) *ParseError {
-	errorMessage := token.TokenError(p.peekToken, fmt.Sprintf("expected next token to be %s, got %s instead",
-		t, p.peekToken.Type))
-	p.errors = append(p.errors, errorMessage)
+	p.error(errors.TokenError(errors.CodeUnexpectedToken, p.peekToken,
+		fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)))
 	return NewParseError()
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	errorMessage := token.TokenError(p.currToken, fmt.Sprintf("no prefix parse function for %s found",
-		t))
-	p.errors = append(p.errors, errorMessage)
+	p.error(errors.TokenError(errors.CodeExpectedExpression, p.currToken,
+		fmt.Sprintf("expected expression, got %s", t)))
+}
+
+// error records d unless the parser is already recovering from an earlier
+// error in the same statement, and enters panic mode.
+func (p *Parser) error(d *errors.Diagnostic) {
+	if p.panicMode {
+		return
+	}
+	p.panicMode = true
+	p.errors = append(p.errors, d)
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() errors.List {
 	return p.errors
 }
 
@@ -108,7 +108,7 @@ func TestIdentifierExpression(t *testing.T) {
 	}
 }
 
-func TestNumberLiteralExpression(t *testing.T) {
+func TestIntegerLiteralExpression(t *testing.T) {
 	input := "5;"
 
 	tokens := scanner.NewScanner(input).ScanTokens()
@@ -116,6 +116,26 @@ func TestNumberLiteralExpression(t *testing.T) {
 	program := p.Parse()
 	checkParserErrors(t, p)
 
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	testIntegerLiteral(t, stmt.Expression, 5)
+}
+
+func TestNumberLiteralExpression(t *testing.T) {
+	input := "5.5;"
+
+	tokens := scanner.NewScanner(input).ScanTokens()
+	p := NewParser(tokens)
+	program := p.Parse()
+	checkParserErrors(t, p)
+
 	if len(program.Statements) != 1 {
 		t.Fatalf("program has not enough statements. got=%d",
 			len(program.Statements))
@@ -130,16 +150,59 @@ func TestNumberLiteralExpression(t *testing.T) {
 	if !ok {
 		t.Fatalf("exp not *ast.NumberLiteral. got=%T", stmt.Expression)
 	}
-	if literal.Value != 5 {
-		t.Errorf("literal.Value not %d. got=%v", 5, literal.Value)
+	if literal.Value != 5.5 {
+		t.Errorf("literal.Value not %v. got=%v", 5.5, literal.Value)
 	}
-	if literal.TokenLiteral() != "5" {
-		t.Errorf("literal.TokenLiteral not %s. got=%s", "5",
+	if literal.TokenLiteral() != "5.5" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "5.5",
 			literal.TokenLiteral())
 	}
 }
+func TestNumberLiteralString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0xFF", "255"},
+		{"1_000", "1000"},
+		{"0b11", "3"},
+		{"2.0", "2.0"},
+		{"1_000.5", "1000.5"},
+		{"6.02e23", "6.02e+23"},
+		{"1e21", "1e+21"},
+		{"1e-7", "1e-07"},
+		{"0.1", "0.1"},
+		{"5e0", "5.0"},
+	}
+
+	parseOne := func(input string) ast.Expression {
+		p := NewParser(scanner.NewScanner(input).ScanTokens())
+		program := p.Parse()
+		checkParserErrors(t, p)
+		return program.Statements[0].(*ast.ExpressionStatement).Expression
+	}
+	for _, tt := range tests {
+		literal := parseOne(tt.input)
+		if literal.String() != tt.expected {
+			t.Errorf("%q: String() wrong. expected=%q, got=%q", tt.input, tt.expected, literal.String())
+		}
+		switch literal := literal.(type) {
+		case *ast.IntegerLiteral:
+			again, ok := parseOne(literal.String()).(*ast.IntegerLiteral)
+			if !ok || again.Value != literal.Value {
+				t.Errorf("%q: %q does not scan back to %d", tt.input, literal.String(), literal.Value)
+			}
+		case *ast.NumberLiteral:
+			again, ok := parseOne(literal.String()).(*ast.NumberLiteral)
+			if !ok || again.Value != literal.Value {
+				t.Errorf("%q: %q does not scan back to %v", tt.input, literal.String(), literal.Value)
+			}
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
-	input := `"hello world";`
+	input := `"hello\tworld";`
 	tokens := scanner.NewScanner(input).ScanTokens()
 	p := NewParser(tokens)
 	program := p.Parse()
@@ -149,8 +212,29 @@ func TestStringLiteralExpression(t *testing.T) {
 	if !ok {
 		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
 	}
-	if literal.Value != "hello world" {
-		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	if literal.Value != "hello\tworld" {
+		t.Errorf("literal.Value not %q. got=%q", "hello\tworld", literal.Value)
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a ${b} c"`, `((a  + b) +  c)`},
+		{`"${b}"`, `( + b)`},
+		{`"${a}${b + 1}!"`, `((( + a) + (b + 1)) + !)`},
+		{`"x ${"y ${z}"}"`, `(x  + (y  + z))`},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(scanner.NewScanner(tt.input).ScanTokens())
+		program := p.Parse()
+		checkParserErrors(t, p)
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
 	}
 }
 
@@ -260,6 +344,82 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"-a * b",
 			"((-a) * b)",
 		},
+		{
+			"a * b % c ~/ d",
+			"(((a * b) % c) ~/ d)",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-a ** b * c",
+			"((-(a ** b)) * c)",
+		},
+		{
+			"a ** -b",
+			"(a ** (-b))",
+		},
+		{
+			"a | b ^ c & d == e",
+			"((a | (b ^ (c & d))) == e)",
+		},
+		{
+			"a & b << c + d",
+			"(a & (b << (c + d)))",
+		},
+		{
+			"~a >> 1 < b",
+			"(((~a) >> 1) < b)",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"x = a or b ? c + 1 : d",
+			"(x = ((a or b) ? (c + 1) : d))",
+		},
+		{
+			"a ?? b ?? c or d",
+			"((a ?? b) ?? (c or d))",
+		},
+		{
+			"a ?? b ? c : d",
+			"((a ?? b) ? c : d)",
+		},
+		{
+			"a?[0]?[1] + b ? [2] : [3]",
+			"((((a?[0])?[1]) + b) ? [2] : [3])",
+		},
+		{
+			"a += b * c",
+			"(a += (b * c))",
+		},
+		{
+			"a[i] -= b = c",
+			"((a[i]) -= (b = c))",
+		},
+		{
+			"-x++ * ++p.y",
+			"((-(x++)) * (++(p.y)))",
+		},
+		{
+			"a[i]-- + --a[i]",
+			"(((a[i])--) + (--(a[i])))",
+		},
+		{
+			"a or b and c or d",
+			"((a or (b and c)) or d)",
+		},
+		{
+			"a == b and !c",
+			"((a == b) and (!c))",
+		},
 		{
 			"!-a",
 			"(!(-a))",
@@ -360,6 +520,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"-a.b * c.d(e)",
+			"((-(a.b)) * (c.d)(e))",
+		},
+		{
+			"a.b[0].c",
+			"(((a.b)[0]).c)",
+		},
+		{
+			"a.b = c.d = 1 + 2",
+			"((a.b) = ((c.d) = (1 + 2)))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -702,7 +874,7 @@ func TestParsingArrayLiterals(t *testing.T) {
 	if len(array.Elements) != 3 {
 		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
 	}
-	testNumberLiteral(t, array.Elements[0], 1)
+	testIntegerLiteral(t, array.Elements[0], 1)
 
 	testInfixExpression(t, array.Elements[1], 2, "*", 2)
 	testInfixExpression(t, array.Elements[2], 3, "+", 3)
@@ -727,6 +899,38 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingIndexAssignment(t *testing.T) {
+	input := `h["a"][i] = x + 1`
+	tokens := scanner.NewScanner(input).ScanTokens()
+	p := NewParser(tokens)
+	program := p.Parse()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	assign, ok := stmt.Expression.(*ast.IndexAssignment)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexAssignment. got=%T", stmt.Expression)
+	}
+	testIdentifier(t, assign.Target.Index, "i")
+	if _, ok := assign.Target.Left.(*ast.IndexExpression); !ok {
+		t.Errorf("target not indexing an *ast.IndexExpression. got=%T", assign.Target.Left)
+	}
+	testInfixExpression(t, assign.Value, "x", "+", 1)
+	if got := program.String(); got != "(((h[a])[i]) = (x + 1))" {
+		t.Errorf("program.String() wrong. got=%q", got)
+	}
+}
+
+func TestConditionalHashKey(t *testing.T) {
+	input := `{a ? "b" : "c": d ? 1 : 2}`
+	tokens := scanner.NewScanner(input).ScanTokens()
+	p := NewParser(tokens)
+	program := p.Parse()
+	checkParserErrors(t, p)
+	if got := program.String(); got != "{(a ? b : c):(d ? 1 : 2)}" {
+		t.Errorf("program.String() wrong. got=%q", got)
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 	tokens := scanner.NewScanner(input).ScanTokens()
@@ -741,7 +945,7 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	if len(hash.Pairs) != 3 {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
-	expected := map[string]float64{"one": 1,
+	expected := map[string]int64{"one": 1,
 		"two":   2,
 		"three": 3}
 	for key, value := range hash.Pairs {
@@ -750,7 +954,7 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
 		}
 		expectedValue := expected[literal.String()]
-		testNumberLiteral(t, value, expectedValue)
+		testIntegerLiteral(t, value, expectedValue)
 	}
 }
 
@@ -809,6 +1013,354 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestDocComments(t *testing.T) {
+	input := `
+/// Adds two numbers.
+///
+/// Both must be numbers.
+let add = fn(a, b) { a + b };
+/// Not attached: an expression follows.
+add(1, 2);
+// A plain comment.
+let x = 1;
+/// A point.
+struct Point {
+  x; /* a field */ y;
+  /// The sum of the coordinates.
+  fn sum() { this.x + this.y }
+  fn norm() { 0 }
+}
+`
+	for _, scan := range []func(string) *scanner.Scanner{scanner.NewScanner, scanner.NewScannerWithTrivia} {
+		p := NewParser(scan(input).ScanTokens())
+		program := p.Parse()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 4 {
+			t.Fatalf("program.Statements does not contain 4 statements. got=%d", len(program.Statements))
+		}
+
+		add := program.Statements[0].(*ast.LetStatement)
+		if add.Doc != "Adds two numbers.\n\nBoth must be numbers." {
+			t.Errorf("add has wrong doc. got=%q", add.Doc)
+		}
+		if x := program.Statements[2].(*ast.LetStatement); x.Doc != "" {
+			t.Errorf("x has wrong doc. got=%q", x.Doc)
+		}
+		point := program.Statements[3].(*ast.StructStatement)
+		if point.Doc != "A point." {
+			t.Errorf("Point has wrong doc. got=%q", point.Doc)
+		}
+		if len(point.Fields) != 2 || len(point.Methods) != 2 {
+			t.Fatalf("Point has wrong members. got=%d fields, %d methods", len(point.Fields), len(point.Methods))
+		}
+		if point.Methods[0].Doc != "The sum of the coordinates." {
+			t.Errorf("sum has wrong doc. got=%q", point.Methods[0].Doc)
+		}
+		if point.Methods[1].Doc != "" {
+			t.Errorf("norm has wrong doc. got=%q", point.Methods[1].Doc)
+		}
+	}
+}
+
+func TestStructStatement(t *testing.T) {
+	input := `struct Point {
+  x = 0;
+  y;
+  fn add(other) { Point(this.x + other.x, this.y + other.y) }
+}`
+	tokens := scanner.NewScanner(input).ScanTokens()
+	p := NewParser(tokens)
+	program := p.Parse()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has wrong number of statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("statement not *ast.StructStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "Point" {
+		t.Errorf("name wrong. got=%q", stmt.Name.Value)
+	}
+
+	if len(stmt.Fields) != 2 {
+		t.Fatalf("wrong number of fields. got=%d", len(stmt.Fields))
+	}
+	testIdentifier(t, stmt.Fields[0].Name, "x")
+	testLiteralExpression(t, stmt.Fields[0].Value, 0)
+	testIdentifier(t, stmt.Fields[1].Name, "y")
+	if stmt.Fields[1].Value != nil {
+		t.Errorf("field y has a default: %s", stmt.Fields[1].Value)
+	}
+
+	if len(stmt.Methods) != 1 {
+		t.Fatalf("wrong number of methods. got=%d", len(stmt.Methods))
+	}
+	method := stmt.Methods[0]
+	testIdentifier(t, method.Name, "add")
+	if len(method.Function.Parameters) != 1 {
+		t.Fatalf("wrong number of parameters. got=%d", len(method.Function.Parameters))
+	}
+	testLiteralExpression(t, method.Function.Parameters[0], "other")
+	body := method.Function.Body.String()
+	if body != "Point(((this.x) + (other.x)), ((this.y) + (other.y)))" {
+		t.Errorf("method body wrong. got=%q", body)
+	}
+}
+
+func TestStructInheritance(t *testing.T) {
+	input := "struct Dog < Animal { fn speak() { super.speak() + \"!\" } }"
+	tokens := scanner.NewScanner(input).ScanTokens()
+	p := NewParser(tokens)
+	program := p.Parse()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("statement not *ast.StructStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Superclass == nil {
+		t.Fatalf("struct has no superclass")
+	}
+	testIdentifier(t, stmt.Superclass, "Animal")
+
+	body := stmt.Methods[0].Function.Body.Statements[0].(*ast.ExpressionStatement)
+	infix, ok := body.Expression.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("method body not *ast.InfixExpression. got=%T", body.Expression)
+	}
+	call, ok := infix.Left.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("left not *ast.CallExpression. got=%T", infix.Left)
+	}
+	super, ok := call.Function.(*ast.SuperExpression)
+	if !ok {
+		t.Fatalf("callee not *ast.SuperExpression. got=%T", call.Function)
+	}
+	testIdentifier(t, super.Method, "speak")
+}
+
+func TestForExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < 3; i = i + 1) { i }", "for (let i = 0; (i < 3); (i = (i + 1))) i"},
+		{"for (i = 0; i < 3;) { i }", "for ((i = 0); (i < 3); ) i"},
+		{"for (;;) { 1 }", "for (; ; ) 1"},
+		{"for (x in [1, 2]) { x }", "for (x in [1, 2]) x"},
+		{"for (k in h) { }", "for (k in h) "},
+	}
+	for _, tt := range tests {
+		tokens := scanner.NewScanner(tt.input).ScanTokens()
+		p := NewParser(tokens)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: program has wrong number of statements. got=%d", tt.input, len(program.Statements))
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	program := NewParser(scanner.NewScanner("for (x in xs) { if (x) { continue; } break }").ScanTokens()).Parse()
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	loop, ok := stmt.Expression.(*ast.ForInExpression)
+	if !ok {
+		t.Fatalf("expression not *ast.ForInExpression. got=%T", stmt.Expression)
+	}
+	testIdentifier(t, loop.Variable, "x")
+	testIdentifier(t, loop.Iterable, "xs")
+	if _, ok := loop.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("statement not *ast.BreakStatement. got=%T", loop.Body.Statements[1])
+	}
+	inner := loop.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if _, ok := inner.Then.Statements[0].(*ast.ContinueStatement); !ok {
+		t.Errorf("statement not *ast.ContinueStatement. got=%T", inner.Then.Statements[0])
+	}
+}
+
+func TestNodeSpans(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart int
+		expectedEnd   int
+	}{
+		{"foobar;", 0, 6},
+		{"  1 + 2 * 3;", 2, 11},
+		{"let x = -y;", 0, 10},
+		{"return a;", 0, 8},
+		{"add(1, 2)", 0, 9},
+		{"myArray[1 + 1]", 0, 14},
+		{"[1, 2]", 0, 6},
+		{`{"a": 1}`, 0, 8},
+		{"fn(x) { x }", 0, 11},
+		{"if (x) { 1 } else { 2 }", 0, 23},
+		{"while (x) { y }", 0, 15},
+		{"x = 1 + 2", 0, 9},
+		{"struct P { x; fn f() { 1 } }", 0, 28},
+		{"p.x = y.z", 0, 9},
+		{"a[i] = 1", 0, 8},
+		{"for (;;) { y }", 0, 14},
+		{"for (x in xs) { x }", 0, 19},
+		{"a ? b : c + d", 0, 13},
+		{"a ?? b", 0, 6},
+		{"a?[i]", 0, 5},
+	}
+
+	for _, tt := range tests {
+		tokens := scanner.NewScanner(tt.input).ScanTokens()
+		p := NewParser(tokens)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		span := program.Statements[0].Span()
+		if span.Start.Offset != tt.expectedStart || span.End.Offset != tt.expectedEnd {
+			t.Errorf("%q: span wrong. expected=[%d, %d), got=[%d, %d)", tt.input,
+				tt.expectedStart, tt.expectedEnd, span.Start.Offset, span.End.Offset)
+		}
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements []string
+	}{
+		{
+			"let x 5;\nlet = 10;\nlet y = ;",
+			[]string{
+				"[line 1:7] error: expected next token to be =, got NUMBER instead at '5'",
+				"[line 2:5] error: expected next token to be IDENTIFIER, got = instead at '='",
+				"[line 3:9] error: expected expression, got ; at ';'",
+			},
+			[]string{},
+		},
+		{
+			"let a = 1;\nlet b = (1 + ;\nlet c = 3;",
+			[]string{"[line 2:14] error: expected expression, got ; at ';'"},
+			[]string{"let a = 1;", "let c = 3;"},
+		},
+		{
+			"let f = fn() { let = 1; return 2; };\nlet g = ;",
+			[]string{
+				"[line 1:20] error: expected next token to be IDENTIFIER, got = instead at '='",
+				"[line 2:9] error: expected expression, got ; at ';'",
+			},
+			[]string{"let f = fn()return 2;;"},
+		},
+		{
+			"if (x) { let y = ] } let z = 1;",
+			[]string{"[line 1:18] error: expected expression, got ] at ']'"},
+			[]string{"if", "let z = 1;"},
+		},
+		{
+			"} let z = 1;",
+			[]string{"[line 1:1] error: expected expression, got } at '}'"},
+			[]string{"let z = 1;"},
+		},
+		{
+			"let h = {\"a\": };\nfn(1) { 1 };\nlet ok = true;",
+			[]string{
+				"[line 1:15] error: expected expression, got } at '}'",
+				"[line 2:4] error: expected next token to be IDENTIFIER, got NUMBER instead at '1'",
+			},
+			[]string{"let ok = true;"},
+		},
+		{
+			"let x = fn() { 1",
+			[]string{"[line 1:17] error: expected '}' to close block at end"},
+			[]string{},
+		},
+		{
+			"let t = this;\nstruct P { 1; x = this; fn f() { this.x } }",
+			[]string{
+				"[line 1:9] error: 'this' used outside of a method at 'this'",
+				"[line 2:12] error: expected field or method in struct P, got NUMBER at '1'",
+				"[line 2:19] error: 'this' used outside of a method at 'this'",
+			},
+			[]string{"struct P { fn f()(this.x) }"},
+		},
+		{
+			"fn() { super.f() };\nstruct A { fn f() { super.f() } }\nstruct B < B {}\nstruct C < A { fn f() { super.f() } }",
+			[]string{
+				"[line 1:8] error: 'super' used outside of a method of a struct with a superclass at 'super'",
+				"[line 2:21] error: 'super' used outside of a method of a struct with a superclass at 'super'",
+				"[line 3:12] error: struct B cannot inherit from itself at 'B'",
+			},
+			[]string{"fn()", "struct A { fn f() }", "struct C < A { fn f()super.f() }"},
+		},
+		{
+			"break;\nwhile (x) { let f = fn() { continue }; break }\ncontinue",
+			[]string{
+				"[line 1:1] error: 'break' used outside of a loop at 'break'",
+				"[line 2:28] error: 'continue' used outside of a loop at 'continue'",
+				"[line 3:1] error: 'continue' used outside of a loop at 'continue'",
+			},
+			[]string{"while"},
+		},
+		{
+			"1 = 2;\nf() = 3;\nlet ok = a[0] = 1;",
+			[]string{
+				"[line 1:1] error: invalid assignment target: 1",
+				"[line 2:1] error: invalid assignment target: f()",
+			},
+			[]string{"let ok = ((a[0]) = 1);"},
+		},
+		{
+			"1++;\n++f();\n(a + b) *= 2;\nx %= 3;",
+			[]string{
+				"[line 1:1] error: invalid assignment target: 1",
+				"[line 2:3] error: invalid assignment target: f()",
+				"[line 3:2] error: invalid assignment target: (a + b)",
+			},
+			[]string{"(x %= 3)"},
+		},
+		{
+			"a?[0] = 1;\na?[0]++;\nb = c ? d : e;",
+			[]string{
+				"[line 1:1] error: invalid assignment target: (a?[0])",
+				"[line 2:1] error: invalid assignment target: (a?[0])",
+			},
+			[]string{"(b = (c ? d : e))"},
+		},
+	}
+
+	for _, tt := range tests {
+		tokens := scanner.NewScanner(tt.input).ScanTokens()
+		p := NewParser(tokens)
+		program := p.Parse()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("%q: wrong number of errors. want=%d, got=%d: %v", tt.input,
+				len(tt.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, expected := range tt.expectedErrors {
+			if errors[i].Error() != expected {
+				t.Errorf("%q: error %d wrong. want=%q, got=%q", tt.input, i, expected, errors[i].Error())
+			}
+		}
+
+		if len(program.Statements) != len(tt.expectedStatements) {
+			t.Errorf("%q: wrong number of statements. want=%d, got=%d", tt.input,
+				len(tt.expectedStatements), len(program.Statements))
+			continue
+		}
+		for i, expected := range tt.expectedStatements {
+			if program.Statements[i].String() != expected {
+				t.Errorf("%q: statement %d wrong. want=%q, got=%q", tt.input, i, expected,
+					program.Statements[i].String())
+			}
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
@@ -866,7 +1418,7 @@ func testLiteralExpression(
 ) bool {
 	switch v := expected.(type) {
 	case int:
-		return testNumberLiteral(t, exp, float64(v))
+		return testIntegerLiteral(t, exp, int64(v))
 	case float64:
 		return testNumberLiteral(t, exp, v)
 	case string:
@@ -878,6 +1430,27 @@ func testLiteralExpression(
 	return false
 }
 
+func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
+	integer, ok := il.(*ast.IntegerLiteral)
+	if !ok {
+		t.Errorf("il not *ast.IntegerLiteral. got=%T", il)
+		return false
+	}
+
+	if integer.Value != value {
+		t.Errorf("integer.Value not %d. got=%d", value, integer.Value)
+		return false
+	}
+
+	if integer.TokenLiteral() != fmt.Sprintf("%d", value) {
+		t.Errorf("integer.TokenLiteral not %d. got=%s", value,
+			integer.TokenLiteral())
+		return false
+	}
+
+	return true
+}
+
 func testNumberLiteral(t *testing.T, nl ast.Expression, value float64) bool {
 	numberValue, ok := nl.(*ast.NumberLiteral)
 	if !ok {
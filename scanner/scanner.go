@@ -1,36 +1,91 @@
 package scanner
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"go-compiler/main/errors"
 	"go-compiler/main/token"
 )
 
 type Scanner struct {
-	source  string
-	tokens  []*token.Token
-	start   int
-	current int
-	line    int
-}
+	source    string
+	tokens    []*token.Token
+	start     int
+	current   int
+	line      int
+	lineStart int            // byte offset of the first character on the current line
+	startPos  token.Position // position of the token being scanned
+	errors    errors.List
+	trivia    bool // whether comments and whitespace are scanned as tokens
 
-const ()
+	// interpolations holds, for each string whose embedded expression is
+	// being scanned, the number of braces open inside that expression.
+	interpolations []int
+}
 
 func NewScanner(source string) *Scanner {
 	return &Scanner{source: source, tokens: []*token.Token{}, start: 0, current: 0, line: 1}
 }
 
+// NewScannerWithTrivia returns a scanner that also scans comments and
+// whitespace as COMMENT and WHITESPACE tokens, so that the spans of the
+// tokens cover the whole source.
+func NewScannerWithTrivia(source string) *Scanner {
+	s := NewScanner(source)
+	s.trivia = true
+	return s
+}
+
 func (s *Scanner) ScanTokens() []*token.Token {
 	for !s.isAtEnd() {
 		s.start = s.current
+		s.startPos = s.position()
 		s.ScanToken()
 	}
-	s.tokens = append(s.tokens, token.NewToken(token.EOF, "", nil, s.line))
+	s.start = s.current
+	s.startPos = s.position()
+	if len(s.interpolations) > 0 {
+		s.error(errors.CodeUnterminatedString, "Unterminated string interpolation.")
+	}
+	s.tokens = append(s.tokens, token.NewTokenAt(token.EOF, "", nil, s.startPos, s.startPos))
 	return s.tokens
 }
 
+// position returns the location of the next character to be consumed.
+func (s *Scanner) position() token.Position {
+	column := utf8.RuneCountInString(s.source[s.lineStart:s.current]) + 1
+	return token.Position{Offset: s.current, Line: s.line, Column: column}
+}
+
+// Errors returns the diagnostics reported while scanning.
+func (s *Scanner) Errors() errors.List {
+	return s.errors
+}
+
+// error reports a problem with the token being scanned.
+func (s *Scanner) error(code string, message string) {
+	s.errorFrom(s.startPos, code, message)
+}
+
+// errorFrom reports a problem with the source from start to the next
+// character to be consumed.
+func (s *Scanner) errorFrom(start token.Position, code string, message string) {
+	span := token.Span{Start: start, End: s.position()}
+	s.errors = append(s.errors, errors.NewDiagnostic(errors.SeverityError, code, span, message))
+}
+
+// newline records that the character just consumed ended a line.
+func (s *Scanner) newline() {
+	s.line++
+	s.lineStart = s.current
+}
+
 func (s *Scanner) ScanToken() *token.Token {
+	scanned := len(s.tokens)
 	c := s.advance()
 	switch c {
 	case '(':
@@ -38,8 +93,21 @@ func (s *Scanner) ScanToken() *token.Token {
 	case ')':
 		s.addToken(token.RIGHT_PAREN)
 	case '{':
+		if n := len(s.interpolations); n > 0 {
+			s.interpolations[n-1]++
+		}
 		s.addToken(token.LEFT_BRACE)
 	case '}':
+		n := len(s.interpolations)
+		if n > 0 && s.interpolations[n-1] == 0 {
+			// The end of an embedded expression: the string resumes.
+			s.interpolations = s.interpolations[:n-1]
+			s.string()
+			break
+		}
+		if n > 0 {
+			s.interpolations[n-1]--
+		}
 		s.addToken(token.RIGHT_BRACE)
 	case '[':
 		s.addToken(token.LEFT_BRACKET)
@@ -50,15 +118,63 @@ func (s *Scanner) ScanToken() *token.Token {
 	case '.':
 		s.addToken(token.DOT)
 	case '-':
-		s.addToken(token.MINUS)
+		if s.match('-') {
+			s.addToken(token.MINUS_MINUS)
+		} else if s.match('=') {
+			s.addToken(token.MINUS_EQUAL)
+		} else {
+			s.addToken(token.MINUS)
+		}
 	case '+':
-		s.addToken(token.PLUS)
+		if s.match('+') {
+			s.addToken(token.PLUS_PLUS)
+		} else if s.match('=') {
+			s.addToken(token.PLUS_EQUAL)
+		} else {
+			s.addToken(token.PLUS)
+		}
 	case ';':
 		s.addToken(token.SEMICOLON)
 	case ':':
 		s.addToken(token.COLON)
+	case '?':
+		// "a?[i]" is an optional index but "c ? [1] : [2]" a conditional:
+		// '?' starts an optional index only when nothing separates it from
+		// the operand before it.
+		if s.peek() == '[' && s.start > 0 && !isSpace(s.source[s.start-1]) {
+			s.advance()
+			s.addToken(token.QUESTION_BRACKET)
+		} else if s.match('?') {
+			s.addToken(token.QUESTION_QUESTION)
+		} else {
+			s.addToken(token.QUESTION)
+		}
 	case '*':
-		s.addToken(token.STAR)
+		if s.match('*') {
+			s.addToken(token.STAR_STAR)
+		} else if s.match('=') {
+			s.addToken(token.STAR_EQUAL)
+		} else {
+			s.addToken(token.STAR)
+		}
+	case '%':
+		if s.match('=') {
+			s.addToken(token.PERCENT_EQUAL)
+		} else {
+			s.addToken(token.PERCENT)
+		}
+	case '&':
+		s.addToken(token.AMPERSAND)
+	case '|':
+		s.addToken(token.PIPE)
+	case '^':
+		s.addToken(token.CARET)
+	case '~':
+		if s.match('/') {
+			s.addToken(token.TILDE_SLASH)
+		} else {
+			s.addToken(token.TILDE)
+		}
 	case '!':
 		if s.match('=') {
 			s.addToken(token.BANG_EQUAL)
@@ -72,43 +188,62 @@ func (s *Scanner) ScanToken() *token.Token {
 			s.addToken(token.EQUAL)
 		}
 	case '<':
-		if s.match('=') {
+		if s.match('<') {
+			s.addToken(token.LESS_LESS)
+		} else if s.match('=') {
 			s.addToken(token.LESS_EQUAL)
 		} else {
 			s.addToken(token.LESS)
 		}
 	case '>':
-		if s.match('=') {
+		if s.match('>') {
+			s.addToken(token.GREATER_GREATER)
+		} else if s.match('=') {
 			s.addToken(token.GREATER_EQUAL)
 		} else {
 			s.addToken(token.GREATER)
 		}
 	case '/':
 		if s.match('/') {
-			for s.peek() != '\n' && !s.isAtEnd() {
-				s.advance()
-			}
+			s.lineComment()
+		} else if s.match('*') {
+			s.blockComment()
+		} else if s.match('=') {
+			s.addToken(token.SLASH_EQUAL)
 		} else {
 			s.addToken(token.SLASH)
 		}
-	case ' ', '\r', '\t':
-		// Ignore whitespace
-		return nil
-	case '\n':
-		s.line++
-		return nil
+	case ' ', '\r', '\t', '\n':
+		s.whitespace(c)
+		if !s.trivia {
+			return nil
+		}
+		s.addToken(token.WHITESPACE)
 	case '"':
 		s.string()
+	case '`':
+		s.rawString()
 	default:
 		if isDigit(c) {
 			s.number()
-		} else if isAlpha(c) {
+			break
+		}
+		r := s.character(c)
+		if r == utf8.RuneError && s.current-s.start == 1 {
+			// An invalid encoding, which has been reported.
+			return nil
+		}
+		if isAlpha(r) {
 			s.identifier()
 		} else {
-			errors.Error(s.line, "Unexpected character.")
+			s.error(errors.CodeUnexpectedCharacter, "Unexpected character.")
 			return nil
 		}
 	}
+	if len(s.tokens) == scanned {
+		// The token was malformed and has been reported.
+		return nil
+	}
 	return s.tokens[len(s.tokens)-1]
 }
 
@@ -118,15 +253,48 @@ func (s *Scanner) advance() byte {
 	return char
 }
 
+// character consumes the rest of the UTF-8 encoded character whose first
+// byte, c, was just consumed, and returns it. A byte that does not start a
+// valid encoding is reported and returned as utf8.RuneError.
+func (s *Scanner) character(c byte) rune {
+	if c < utf8.RuneSelf {
+		return rune(c)
+	}
+	r, size := utf8.DecodeRuneInString(s.source[s.current-1:])
+	if r == utf8.RuneError && size == 1 {
+		start := s.position()
+		start.Offset--
+		start.Column--
+		s.errorFrom(start, errors.CodeInvalidEncoding, "Invalid UTF-8 encoding.")
+		return r
+	}
+	s.current += size - 1
+	return r
+}
+
+// peekCharacter returns the character at the next byte to be consumed and
+// the number of bytes encoding it, which is 0 at the end of the source.
+func (s *Scanner) peekCharacter() (rune, int) {
+	if s.isAtEnd() {
+		return 0, 0
+	}
+	return utf8.DecodeRuneInString(s.source[s.current:])
+}
+
 func (s *Scanner) addToken(t token.TokenType) {
 	s.addTokenLiteral(t, nil)
 }
 func (s *Scanner) addTokenLiteral(t token.TokenType, literal interface{}) {
 	text := s.source[s.start:s.current]
-	s.tokens = append(s.tokens, token.NewToken(t, text, literal, s.line))
+	s.tokens = append(s.tokens, token.NewTokenAt(t, text, literal, s.startPos, s.position()))
 }
-func (s *Scanner) addStringLiteral(t token.TokenType, literal string) {
-	s.tokens = append(s.tokens, token.NewToken(t, literal, literal, s.line))
+
+// addStringLiteral adds a string token whose lexeme is the source between
+// the character that opened it and the closeLen characters that closed it,
+// and whose literal is value, the string it denotes.
+func (s *Scanner) addStringLiteral(t token.TokenType, value string, closeLen int) {
+	lexeme := s.source[s.start+1 : s.current-closeLen]
+	s.tokens = append(s.tokens, token.NewTokenAt(t, lexeme, value, s.startPos, s.position()))
 }
 
 func (s *Scanner) match(expected byte) bool {
@@ -155,53 +323,362 @@ func (s *Scanner) peekNext() byte {
 	return s.source[s.current+1]
 }
 
+// whitespace consumes the run of whitespace starting with c.
+func (s *Scanner) whitespace(c byte) {
+	for {
+		if c == '\n' {
+			s.newline()
+		}
+		if !isSpace(s.peek()) {
+			return
+		}
+		c = s.advance()
+	}
+}
+
+// followsOperand reports whether the token before the one being scanned,
+// ignoring trivia, ends an operand on the same line. A closing brace is
+// taken to end a block, not a hash.
+func (s *Scanner) followsOperand() bool {
+	for i := len(s.tokens) - 1; i >= 0; i-- {
+		prev := s.tokens[i]
+		if prev.Type.IsTrivia() || prev.Type == token.DOC_COMMENT {
+			continue
+		}
+		if prev.End.Line != s.line {
+			return false
+		}
+		switch prev.Type {
+		case token.IDENTIFIER, token.NUMBER, token.STRING, token.TRUE, token.FALSE, token.NIL, token.THIS,
+			token.RIGHT_PAREN, token.RIGHT_BRACKET:
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// lineComment scans the rest of a "//" comment. One starting with exactly
+// three slashes is a doc comment, whose literal is its text.
+func (s *Scanner) lineComment() {
+	for s.peek() != '\n' && !s.isAtEnd() {
+		s.character(s.advance())
+	}
+	text := s.source[s.start:s.current]
+	if strings.HasPrefix(text, "///") && !strings.HasPrefix(text, "////") {
+		doc := strings.TrimPrefix(strings.TrimSuffix(text[3:], "\r"), " ")
+		s.addTokenLiteral(token.DOC_COMMENT, doc)
+		return
+	}
+	// "//" always starts a comment, but "7 // 2" was probably meant to
+	// divide, so it is pointed out rather than silently ignored.
+	if text := strings.TrimLeft(text[2:], " \t"); text != "" && isDigit(text[0]) && s.followsOperand() {
+		span := token.Span{Start: s.startPos, End: s.position()}
+		s.errors = append(s.errors, errors.NewDiagnostic(errors.SeverityWarning, errors.CodeCommentedDivision, span,
+			"'//' starts a comment here; integer division is written '~/'."))
+	}
+	if s.trivia {
+		s.addToken(token.COMMENT)
+	}
+}
+
+// blockComment scans the rest of a "/* */" comment. Block comments nest,
+// so one can comment out code that already has them.
+func (s *Scanner) blockComment() {
+	for depth := 1; depth > 0; {
+		if s.isAtEnd() {
+			s.error(errors.CodeUnterminatedComment, "Unterminated block comment.")
+			return
+		}
+		c := s.advance()
+		switch {
+		case c == '/' && s.match('*'):
+			depth++
+		case c == '*' && s.match('/'):
+			depth--
+		case c == '\n':
+			s.newline()
+		default:
+			s.character(c)
+		}
+	}
+	if s.trivia {
+		s.addToken(token.COMMENT)
+	}
+}
+
+// string scans a double-quoted string, or the rest of one after an embedded
+// expression. A "${" ends the token as an INTERPOLATION: the tokens of the
+// embedded expression follow, and the string resumes at the '}' closing it.
 func (s *Scanner) string() {
+	var value strings.Builder
 	for s.peek() != '"' && !s.isAtEnd() {
-		if s.peek() == '\n' {
-			s.line++
+		c := s.advance()
+		switch {
+		case c == '\\':
+			s.escape(&value)
+		case c == '$' && s.peek() == '{':
+			s.advance()
+			s.interpolations = append(s.interpolations, 0)
+			s.addStringLiteral(token.INTERPOLATION, value.String(), 2)
+			return
+		default:
+			if c == '\n' {
+				s.newline()
+			}
+			value.WriteRune(s.character(c))
 		}
-		s.advance()
 	}
 
 	if s.isAtEnd() {
-		errors.Error(s.line, "Unterminated string.")
+		s.error(errors.CodeUnterminatedString, "Unterminated string.")
 		return
 	}
 
 	// The closing quote
 	s.advance()
+	s.addStringLiteral(token.STRING, value.String(), 1)
+}
+
+// escape decodes the escape sequence following a backslash into value.
+func (s *Scanner) escape(value *strings.Builder) {
+	start := s.position()
+	start.Offset--
+	start.Column--
+	if s.isAtEnd() {
+		return
+	}
+	c := s.advance()
+	switch c {
+	case 'n':
+		value.WriteByte('\n')
+	case 't':
+		value.WriteByte('\t')
+	case 'r':
+		value.WriteByte('\r')
+	case 'b':
+		value.WriteByte('\b')
+	case 'f':
+		value.WriteByte('\f')
+	case 'v':
+		value.WriteByte('\v')
+	case '0':
+		value.WriteByte(0)
+	case '\\', '"', '\'', '$':
+		value.WriteByte(c)
+	case 'x':
+		// \xHH is the character U+00HH, so strings stay valid UTF-8.
+		if r, ok := s.hexDigits(2, 2); ok {
+			value.WriteRune(r)
+			return
+		}
+		s.errorFrom(start, errors.CodeInvalidEscape, "Invalid escape sequence: \\x must be followed by 2 hex digits.")
+	case 'u':
+		var r rune
+		var ok bool
+		if s.match('{') {
+			r, ok = s.hexDigits(1, 6)
+			ok = ok && s.match('}')
+		} else {
+			r, ok = s.hexDigits(4, 4)
+		}
+		if !ok {
+			s.errorFrom(start, errors.CodeInvalidEscape,
+				"Invalid escape sequence: \\u must be followed by 4 hex digits or 1 to 6 in braces.")
+			return
+		}
+		if !utf8.ValidRune(r) {
+			s.errorFrom(start, errors.CodeInvalidEscape, "Invalid escape sequence: not a Unicode code point.")
+			return
+		}
+		value.WriteRune(r)
+	default:
+		if c == '\n' {
+			s.newline()
+		}
+		s.errorFrom(start, errors.CodeInvalidEscape, "Invalid escape sequence '\\"+string(s.character(c))+"'.")
+	}
+}
 
-	// Trim the surrounding quotes
-	value := s.source[s.start+1 : s.current-1]
-	s.addStringLiteral(token.STRING, value)
+// hexDigits consumes at least min and at most max hex digits and returns
+// their value, or false if there are fewer than min.
+func (s *Scanner) hexDigits(min, max int) (rune, bool) {
+	var r rune
+	n := 0
+	for ; n < max; n++ {
+		d, ok := hexValue(s.peek())
+		if !ok {
+			break
+		}
+		s.advance()
+		r = r*16 + d
+	}
+	return r, n >= min
+}
+
+// rawString scans a string between backticks. Its contents are taken as
+// written: there are no escape sequences or embedded expressions, and it
+// may span lines.
+func (s *Scanner) rawString() {
+	for s.peek() != '`' && !s.isAtEnd() {
+		c := s.advance()
+		if c == '\n' {
+			s.newline()
+		}
+		s.character(c)
+	}
+
+	if s.isAtEnd() {
+		s.error(errors.CodeUnterminatedString, "Unterminated raw string.")
+		return
+	}
+
+	s.advance()
+	s.addStringLiteral(token.STRING, s.source[s.start+1:s.current-1], 1)
+}
+
+func hexValue(c byte) (rune, bool) {
+	switch {
+	case isDigit(c):
+		return rune(c - '0'), true
+	case c >= 'a' && c <= 'f':
+		return rune(c-'a') + 10, true
+	case c >= 'A' && c <= 'F':
+		return rune(c-'A') + 10, true
+	}
+	return 0, false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\r' || c == '\t' || c == '\n'
 }
 
 func isDigit(c byte) bool {
 	return c >= '0' && c <= '9'
 }
 
+// number scans a number literal: an integer in decimal or, after a 0x, 0o
+// or 0b prefix, in hexadecimal, octal or binary, or a decimal with a
+// fraction or an exponent, which is a float. Digits may be separated by
+// single underscores. A malformed literal is consumed whole and reported
+// once, with the first problem found.
 func (s *Scanner) number() {
-	for isDigit(s.peek()) {
-		s.advance()
+	s.current = s.start
+	base, name := 10, "decimal"
+	if s.peek() == '0' {
+		switch s.peekNext() {
+		case 'x', 'X':
+			base, name = 16, "hexadecimal"
+		case 'o', 'O':
+			base, name = 8, "octal"
+		case 'b', 'B':
+			base, name = 2, "binary"
+		}
 	}
-	if s.peek() == '.' && isDigit(s.peekNext()) {
-		s.advance()
-		for isDigit(s.peek()) {
+
+	problem := ""
+	report := func(message string) {
+		if problem == "" {
+			problem = message
+		}
+	}
+	float, missing := false, false
+	if base != 10 {
+		s.current += 2
+		missing = !s.digits(base, report)
+	} else {
+		s.digits(10, report)
+		if s.peek() == '.' && isDigit(s.peekNext()) {
 			s.advance()
+			s.digits(10, report)
+			float = true
+		}
+		if s.peek() == 'e' || s.peek() == 'E' {
+			s.advance()
+			if s.peek() == '+' || s.peek() == '-' {
+				s.advance()
+			}
+			if !s.digits(10, report) {
+				report("Exponent has no digits.")
+			}
+			float = true
 		}
 	}
-	floatNumber, err := strconv.ParseFloat(s.source[s.start:s.current], 64)
 
+	// A literal runs up to the next character that cannot be in a name.
+	if r, size := s.peekCharacter(); size > 0 && isAlphaNumeric(r) {
+		kind := "character"
+		if r < utf8.RuneSelf && isDigit(byte(r)) {
+			kind = "digit"
+		}
+		report(fmt.Sprintf("Invalid %s '%c' in %s number.", kind, r, name))
+		for ; size > 0 && isAlphaNumeric(r); r, size = s.peekCharacter() {
+			s.current += size
+		}
+	}
+	if missing {
+		report(fmt.Sprintf("Missing digits after the %s prefix '%s'.", name, s.source[s.start:s.start+2]))
+	}
+	if problem != "" {
+		s.error(errors.CodeInvalidNumber, problem)
+		return
+	}
+
+	text := strings.ReplaceAll(s.source[s.start:s.current], "_", "")
+	if float {
+		floatNumber, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			s.error(errors.CodeInvalidNumber, "Number literal out of range.")
+			return
+		}
+		s.addTokenLiteral(token.NUMBER, floatNumber)
+		return
+	}
+	if base != 10 {
+		text = text[2:]
+	}
+	integer, err := strconv.ParseInt(text, base, 64)
 	if err != nil {
-		errors.Error(s.line, "Unable to parse number.")
+		s.error(errors.CodeInvalidNumber, "Integer literal out of range.")
 		return
 	}
-	s.addTokenLiteral(token.NUMBER, floatNumber)
+	s.addTokenLiteral(token.NUMBER, integer)
+}
+
+// digits consumes a run of digits in base, which may be separated by
+// single underscores, and reports whether there were any. Underscores that
+// do not separate two digits are passed to report.
+func (s *Scanner) digits(base int, report func(string)) bool {
+	found := false
+	for {
+		c := s.peek()
+		switch {
+		case c == '_':
+			s.advance()
+			if !found || !isDigitIn(s.peek(), base) {
+				report("Digit separator '_' must be between digits.")
+			}
+		case isDigitIn(c, base):
+			s.advance()
+			found = true
+		default:
+			return found
+		}
+	}
+}
+
+func isDigitIn(c byte, base int) bool {
+	value, ok := hexValue(c)
+	return ok && int(value) < base
 }
 
 func (s *Scanner) identifier() {
-	for isAlphaNumeric(s.peek()) {
-		s.advance()
+	for {
+		r, size := s.peekCharacter()
+		if size == 0 || !isAlphaNumeric(r) {
+			break
+		}
+		s.current += size
 	}
 
 	text := s.source[s.start:s.current]
@@ -213,12 +690,12 @@ func (s *Scanner) identifier() {
 
 }
 
-func isAlpha(c byte) bool {
-	return c >= 'a' && c <= 'z' ||
-		c >= 'A' && c <= 'Z' ||
-		c == '_'
+// isAlpha reports whether r can start an identifier: a letter in any
+// script, or '_'.
+func isAlpha(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
 }
 
-func isAlphaNumeric(c byte) bool {
-	return isAlpha(c) || isDigit(c)
+func isAlphaNumeric(r rune) bool {
+	return isAlpha(r) || unicode.IsDigit(r)
 }
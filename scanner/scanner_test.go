@@ -1,12 +1,14 @@
 package scanner
 
 import (
+	"go-compiler/main/errors"
 	"go-compiler/main/token"
+	"strings"
 	"testing"
 )
 
 func TestNextToken(t *testing.T) {
-	input := `(){};+-*/!!= = ==>>=<<=`
+	input := `(){};+-*/!!= = ==> >=< <= += -= *= /= %= ++ -- % ** ~/ ~ & | ^ << >> >>=`
 
 	tests := []struct {
 		expectedType    token.TokenType
@@ -29,6 +31,24 @@ func TestNextToken(t *testing.T) {
 		{token.GREATER_EQUAL, ">="},
 		{token.LESS, "<"},
 		{token.LESS_EQUAL, "<="},
+		{token.PLUS_EQUAL, "+="},
+		{token.MINUS_EQUAL, "-="},
+		{token.STAR_EQUAL, "*="},
+		{token.SLASH_EQUAL, "/="},
+		{token.PERCENT_EQUAL, "%="},
+		{token.PLUS_PLUS, "++"},
+		{token.MINUS_MINUS, "--"},
+		{token.PERCENT, "%"},
+		{token.STAR_STAR, "**"},
+		{token.TILDE_SLASH, "~/"},
+		{token.TILDE, "~"},
+		{token.AMPERSAND, "&"},
+		{token.PIPE, "|"},
+		{token.CARET, "^"},
+		{token.LESS_LESS, "<<"},
+		{token.GREATER_GREATER, ">>"},
+		{token.GREATER_GREATER, ">>"},
+		{token.EQUAL, "="},
 		{token.EOF, ""},
 	}
 
@@ -56,7 +76,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -180,3 +200,416 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestQuestionTokens(t *testing.T) {
+	input := `a?[0] ?? c ? [1] : b ?[2]`
+	expected := []token.TokenType{
+		token.IDENTIFIER, token.QUESTION_BRACKET, token.NUMBER, token.RIGHT_BRACKET,
+		token.QUESTION_QUESTION, token.IDENTIFIER,
+		token.QUESTION, token.LEFT_BRACKET, token.NUMBER, token.RIGHT_BRACKET,
+		token.COLON, token.IDENTIFIER,
+		token.QUESTION, token.LEFT_BRACKET, token.NUMBER, token.RIGHT_BRACKET,
+		token.EOF,
+	}
+	tokens := NewScanner(input).ScanTokens()
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d", len(expected), len(tokens))
+	}
+	for i, tt := range expected {
+		if tokens[i].Type != tt {
+			t.Errorf("tokens[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tokens[i].Type)
+		}
+	}
+}
+
+func TestLineCommentAfterOperand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.TokenType
+		warning  bool
+	}{
+		{"7 ~/ 2", []token.TokenType{token.NUMBER, token.TILDE_SLASH, token.NUMBER, token.EOF}, false},
+		// "//" starts a comment wherever it is.
+		{"print(x) // show x", []token.TokenType{token.IDENTIFIER, token.LEFT_PAREN, token.IDENTIFIER,
+			token.RIGHT_PAREN, token.EOF}, false},
+		{"let a = ten // ten", []token.TokenType{token.LET, token.IDENTIFIER, token.EQUAL, token.IDENTIFIER,
+			token.EOF}, false},
+		{"if (a) { b } // 2", []token.TokenType{token.IF, token.LEFT_PAREN, token.IDENTIFIER,
+			token.RIGHT_PAREN, token.LEFT_BRACE, token.IDENTIFIER, token.RIGHT_BRACE, token.EOF}, false},
+		{"x;\n// 2 more", []token.TokenType{token.IDENTIFIER, token.SEMICOLON, token.EOF}, false},
+		{"a /// 2", []token.TokenType{token.IDENTIFIER, token.DOC_COMMENT, token.EOF}, false},
+		// One that reads like a division is pointed out.
+		{"7 // 2", []token.TokenType{token.NUMBER, token.EOF}, true},
+		{"f(x) //2;", []token.TokenType{token.IDENTIFIER, token.LEFT_PAREN, token.IDENTIFIER,
+			token.RIGHT_PAREN, token.EOF}, true},
+	}
+
+	for _, tt := range tests {
+		s := NewScanner(tt.input)
+		tokens := s.ScanTokens()
+		types := []token.TokenType{}
+		for _, tok := range tokens {
+			types = append(types, tok.Type)
+		}
+		if len(types) != len(tt.expected) {
+			t.Errorf("%q: wrong tokens. expected=%q, got=%q", tt.input, tt.expected, types)
+		} else {
+			for i := range types {
+				if types[i] != tt.expected[i] {
+					t.Errorf("%q: wrong tokens. expected=%q, got=%q", tt.input, tt.expected, types)
+					break
+				}
+			}
+		}
+
+		if s.Errors().HasErrors() {
+			t.Errorf("%q: unexpected errors: %v", tt.input, s.Errors())
+		}
+		warned := len(s.Errors()) == 1 && s.Errors()[0].Severity == errors.SeverityWarning &&
+			s.Errors()[0].Code == errors.CodeCommentedDivision
+		if warned != tt.warning || !tt.warning && len(s.Errors()) != 0 {
+			t.Errorf("%q: wrong warnings. want=%t, got=%v", tt.input, tt.warning, s.Errors())
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 10;\n  \"a\nb\" + y"
+
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedStart token.Position
+		expectedEnd   token.Position
+	}{
+		{token.LET, token.Position{Offset: 0, Line: 1, Column: 1}, token.Position{Offset: 3, Line: 1, Column: 4}},
+		{token.IDENTIFIER, token.Position{Offset: 4, Line: 1, Column: 5}, token.Position{Offset: 5, Line: 1, Column: 6}},
+		{token.EQUAL, token.Position{Offset: 6, Line: 1, Column: 7}, token.Position{Offset: 7, Line: 1, Column: 8}},
+		{token.NUMBER, token.Position{Offset: 8, Line: 1, Column: 9}, token.Position{Offset: 10, Line: 1, Column: 11}},
+		{token.SEMICOLON, token.Position{Offset: 10, Line: 1, Column: 11}, token.Position{Offset: 11, Line: 1, Column: 12}},
+		{token.STRING, token.Position{Offset: 14, Line: 2, Column: 3}, token.Position{Offset: 19, Line: 3, Column: 3}},
+		{token.PLUS, token.Position{Offset: 20, Line: 3, Column: 4}, token.Position{Offset: 21, Line: 3, Column: 5}},
+		{token.IDENTIFIER, token.Position{Offset: 22, Line: 3, Column: 6}, token.Position{Offset: 23, Line: 3, Column: 7}},
+		{token.EOF, token.Position{Offset: 23, Line: 3, Column: 7}, token.Position{Offset: 23, Line: 3, Column: 7}},
+	}
+
+	tokens := NewScanner(input).ScanTokens()
+
+	for i, tt := range tests {
+		if tokens[i].Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tokens[i].Type)
+		}
+		if tokens[i].Start != tt.expectedStart {
+			t.Errorf("tests[%d] - start wrong. expected=%+v, got=%+v", i, tt.expectedStart, tokens[i].Start)
+		}
+		if tokens[i].End != tt.expectedEnd {
+			t.Errorf("tests[%d] - end wrong. expected=%+v, got=%+v", i, tt.expectedEnd, tokens[i].End)
+		}
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	input := "\"a\\tb\\\"\\x41\\u00e9\\u{1F600}\\$\" `raw\\n${x}` \"n: ${a + {\"k\": 1}[\"k\"]}!\""
+
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedValue interface{}
+	}{
+		{token.STRING, "a\tb\"Aé😀$"},
+		{token.STRING, `raw\n${x}`},
+		{token.INTERPOLATION, "n: "},
+		{token.IDENTIFIER, nil},
+		{token.PLUS, nil},
+		{token.LEFT_BRACE, nil},
+		{token.STRING, "k"},
+		{token.COLON, nil},
+		{token.NUMBER, int64(1)},
+		{token.RIGHT_BRACE, nil},
+		{token.LEFT_BRACKET, nil},
+		{token.STRING, "k"},
+		{token.RIGHT_BRACKET, nil},
+		{token.STRING, "!"},
+		{token.EOF, nil},
+	}
+
+	s := NewScanner(input)
+	tokens := s.ScanTokens()
+	if len(s.Errors()) != 0 {
+		t.Fatalf("scanner errors: %v", s.Errors())
+	}
+	if len(tokens) != len(tests) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d", len(tests), len(tokens))
+	}
+	for i, tt := range tests {
+		if tokens[i].Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tokens[i].Type)
+		}
+		if tt.expectedValue != nil && tokens[i].Literal != tt.expectedValue {
+			t.Errorf("tests[%d] - value wrong. expected=%q, got=%q", i, tt.expectedValue, tokens[i].Literal)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let café = \"né\";\nπ_2 + 名前"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLexeme string
+		expectedColumn int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENTIFIER, "café", 5},
+		{token.EQUAL, "=", 10},
+		{token.STRING, "né", 12},
+		{token.SEMICOLON, ";", 16},
+		{token.IDENTIFIER, "π_2", 1},
+		{token.PLUS, "+", 5},
+		{token.IDENTIFIER, "名前", 7},
+		{token.EOF, "", 9},
+	}
+
+	s := NewScanner(input)
+	tokens := s.ScanTokens()
+	if len(s.Errors()) != 0 {
+		t.Fatalf("scanner errors: %v", s.Errors())
+	}
+	for i, tt := range tests {
+		if tokens[i].Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tokens[i].Type)
+		}
+		if tokens[i].Lexeme != tt.expectedLexeme {
+			t.Errorf("tests[%d] - lexeme wrong. expected=%q, got=%q", i, tt.expectedLexeme, tokens[i].Lexeme)
+		}
+		if tokens[i].Start.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tokens[i].Start.Column)
+		}
+	}
+}
+
+func TestInvalidEncoding(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedCode   string
+		expectedColumn int
+	}{
+		{"x \xff y", errors.CodeInvalidEncoding, 3},
+		{"\"é\xc3\"", errors.CodeInvalidEncoding, 3},
+		{"`\x80`", errors.CodeInvalidEncoding, 2},
+		{"1 // \xfe", errors.CodeInvalidEncoding, 6},
+		{"a ∑ b", errors.CodeUnexpectedCharacter, 3},
+	}
+
+	for _, tt := range tests {
+		s := NewScanner(tt.input)
+		s.ScanTokens()
+		errs := s.Errors()
+		if len(errs) != 1 {
+			t.Errorf("%q: expected 1 error, got %d: %v", tt.input, len(errs), errs)
+			continue
+		}
+		if errs[0].Code != tt.expectedCode {
+			t.Errorf("%q: wrong code. expected=%s, got=%s", tt.input, tt.expectedCode, errs[0].Code)
+		}
+		if errs[0].Span.Start.Column != tt.expectedColumn {
+			t.Errorf("%q: wrong column. expected=%d, got=%d", tt.input, tt.expectedColumn, errs[0].Span.Start.Column)
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedCode    string
+		expectedMessage string
+		expectedColumn  int
+	}{
+		{`"a\qb"`, errors.CodeInvalidEscape, "Invalid escape sequence '\\q'.", 3},
+		{`"\x4"`, errors.CodeInvalidEscape, "Invalid escape sequence: \\x must be followed by 2 hex digits.", 2},
+		{`"\u{110000}"`, errors.CodeInvalidEscape, "Invalid escape sequence: not a Unicode code point.", 2},
+		{"\"a\nb", errors.CodeUnterminatedString, "Unterminated string.", 1},
+		{"`a", errors.CodeUnterminatedString, "Unterminated raw string.", 1},
+		{`"a ${b`, errors.CodeUnterminatedString, "Unterminated string interpolation.", 7},
+	}
+
+	for _, tt := range tests {
+		s := NewScanner(tt.input)
+		s.ScanTokens()
+		errs := s.Errors()
+		if len(errs) != 1 {
+			t.Errorf("%q: expected 1 error, got %d: %v", tt.input, len(errs), errs)
+			continue
+		}
+		if errs[0].Code != tt.expectedCode || errs[0].Message != tt.expectedMessage {
+			t.Errorf("%q: wrong error. expected=%s %q, got=%s %q", tt.input,
+				tt.expectedCode, tt.expectedMessage, errs[0].Code, errs[0].Message)
+		}
+		if errs[0].Span.Start.Column != tt.expectedColumn {
+			t.Errorf("%q: wrong column. expected=%d, got=%d", tt.input, tt.expectedColumn, errs[0].Span.Start.Column)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0", int64(0)},
+		{"1_000_000", int64(1000000)},
+		{"0xFF", int64(255)},
+		{"0X_ff", nil},
+		{"0o17", int64(15)},
+		{"0b1010", int64(10)},
+		{"0b1_0000_0000", int64(256)},
+		{"0x7FFF_FFFF_FFFF_FFFF", int64(9223372036854775807)},
+		{"1.5", 1.5},
+		{"1_000.000_1", 1000.0001},
+		{"6.02e23", 6.02e23},
+		{"1E-3", 0.001},
+		{"2e+2", 200.0},
+		{"5e0", 5.0},
+	}
+
+	for _, tt := range tests {
+		s := NewScanner(tt.input)
+		tokens := s.ScanTokens()
+		if tt.expected == nil {
+			if len(s.Errors()) == 0 {
+				t.Errorf("%q: expected an error", tt.input)
+			}
+			continue
+		}
+		if len(s.Errors()) != 0 {
+			t.Errorf("%q: scanner errors: %v", tt.input, s.Errors())
+			continue
+		}
+		if len(tokens) != 2 || tokens[0].Type != token.NUMBER {
+			t.Errorf("%q: expected a single NUMBER, got %v", tt.input, tokens)
+			continue
+		}
+		if tokens[0].Literal != tt.expected {
+			t.Errorf("%q: value wrong. expected=%v (%T), got=%v (%T)", tt.input,
+				tt.expected, tt.expected, tokens[0].Literal, tokens[0].Literal)
+		}
+		if tokens[0].Lexeme != tt.input {
+			t.Errorf("%q: lexeme wrong. got=%q", tt.input, tokens[0].Lexeme)
+		}
+	}
+}
+
+func TestNumberErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedEnd     int
+	}{
+		{"0x", "Missing digits after the hexadecimal prefix '0x'.", 3},
+		{"0b;", "Missing digits after the binary prefix '0b'.", 3},
+		{"1__0", "Digit separator '_' must be between digits.", 5},
+		{"1_", "Digit separator '_' must be between digits.", 3},
+		{"1_.5", "Digit separator '_' must be between digits.", 5},
+		{"1e", "Exponent has no digits.", 3},
+		{"2.5e+x", "Exponent has no digits.", 7},
+		{"0b102", "Invalid digit '2' in binary number.", 6},
+		{"0o8", "Invalid digit '8' in octal number.", 4},
+		{"0xFG", "Invalid character 'G' in hexadecimal number.", 5},
+		{"12abc", "Invalid character 'a' in decimal number.", 6},
+		{"9223372036854775808", "Integer literal out of range.", 20},
+		{"1e400", "Number literal out of range.", 6},
+	}
+
+	for _, tt := range tests {
+		s := NewScanner(tt.input)
+		s.ScanTokens()
+		errs := s.Errors()
+		if len(errs) != 1 {
+			t.Errorf("%q: expected 1 error, got %d: %v", tt.input, len(errs), errs)
+			continue
+		}
+		if errs[0].Code != errors.CodeInvalidNumber || errs[0].Message != tt.expectedMessage {
+			t.Errorf("%q: wrong error. expected=%s %q, got=%s %q", tt.input,
+				errors.CodeInvalidNumber, tt.expectedMessage, errs[0].Code, errs[0].Message)
+		}
+		if errs[0].Span.Start.Column != 1 || errs[0].Span.End.Column != tt.expectedEnd {
+			t.Errorf("%q: wrong span. expected=1-%d, got=%d-%d", tt.input, tt.expectedEnd,
+				errs[0].Span.Start.Column, errs[0].Span.End.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "a /* b /* c */ d */ + // e\n/// Doc for f.\n///\n//// not doc\nf /*\n*/ g"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral interface{}
+		expectedLine    int
+	}{
+		{token.IDENTIFIER, nil, 1},
+		{token.PLUS, nil, 1},
+		{token.DOC_COMMENT, "Doc for f.", 2},
+		{token.DOC_COMMENT, "", 3},
+		{token.IDENTIFIER, nil, 5},
+		{token.IDENTIFIER, nil, 6},
+		{token.EOF, nil, 6},
+	}
+
+	s := NewScanner(input)
+	tokens := s.ScanTokens()
+	if len(s.Errors()) != 0 {
+		t.Fatalf("scanner errors: %v", s.Errors())
+	}
+	if len(tokens) != len(tests) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%v)", len(tests), len(tokens), tokens)
+	}
+	for i, tt := range tests {
+		if tokens[i].Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tokens[i].Type)
+		}
+		if tt.expectedLiteral != nil && tokens[i].Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tokens[i].Literal)
+		}
+		if tokens[i].Start.Line != tt.expectedLine {
+			t.Errorf("tests[%d] - line wrong. expected=%d, got=%d", i, tt.expectedLine, tokens[i].Start.Line)
+		}
+	}
+
+	s = NewScanner("1 /* a /* b */")
+	s.ScanTokens()
+	if errs := s.Errors(); len(errs) != 1 || errs[0].Code != errors.CodeUnterminatedComment {
+		t.Errorf("expected an unterminated comment error, got %v", errs)
+	}
+}
+
+func TestTrivia(t *testing.T) {
+	input := "let x = /* one */ 1; // set x\n\t/// doc\n\"${x}\" `raw`  "
+
+	expected := []token.TokenType{
+		token.LET, token.WHITESPACE, token.IDENTIFIER, token.WHITESPACE, token.EQUAL, token.WHITESPACE,
+		token.COMMENT, token.WHITESPACE, token.NUMBER, token.SEMICOLON, token.WHITESPACE, token.COMMENT,
+		token.WHITESPACE, token.DOC_COMMENT, token.WHITESPACE,
+		token.INTERPOLATION, token.IDENTIFIER, token.STRING, token.WHITESPACE, token.STRING, token.WHITESPACE,
+		token.EOF,
+	}
+	tokens := NewScannerWithTrivia(input).ScanTokens()
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%v)", len(expected), len(tokens), tokens)
+	}
+
+	// The tokens cover the source without gaps, so it can be rebuilt.
+	var rebuilt strings.Builder
+	offset := 0
+	for i, tok := range tokens {
+		if tok.Type != expected[i] {
+			t.Errorf("tokens[%d] - tokentype wrong. expected=%q, got=%q", i, expected[i], tok.Type)
+		}
+		if tok.Start.Offset != offset {
+			t.Errorf("tokens[%d] - starts at %d, expected %d", i, tok.Start.Offset, offset)
+		}
+		rebuilt.WriteString(input[tok.Start.Offset:tok.End.Offset])
+		offset = tok.End.Offset
+	}
+	if rebuilt.String() != input {
+		t.Errorf("source not rebuilt. expected=%q, got=%q", input, rebuilt.String())
+	}
+}
@@ -0,0 +1,30 @@
+package token
+
+import "fmt"
+
+// Position is a single location in the source text.
+type Position struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in characters, starting at 1
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span is the half-open range [Start, End) of source text covered by a
+// token or an AST node.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// To returns the span running from the start of s to the end of end.
+func (s Span) To(end Span) Span {
+	return Span{Start: s.Start, End: end.End}
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%v-%v", s.Start, s.End)
+}
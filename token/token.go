@@ -1,29 +1,29 @@
 package token
 
-import (
-	"fmt"
-	"go-compiler/main/errors"
-)
+import "fmt"
 
 type Token struct {
 	Type    TokenType
 	Lexeme  string
 	Literal interface{}
 	Line    int
+	Start   Position
+	End     Position
 }
 
 func NewToken(t TokenType, lexeme string, literal interface{}, line int) *Token {
 	return &Token{Type: t, Lexeme: lexeme, Literal: literal, Line: line}
 }
 
-func (t *Token) String() string {
-	return fmt.Sprintf("%v %v %v", t.Type, t.Lexeme, t.Literal)
+func NewTokenAt(t TokenType, lexeme string, literal interface{}, start, end Position) *Token {
+	return &Token{Type: t, Lexeme: lexeme, Literal: literal, Line: start.Line, Start: start, End: end}
+}
+
+// Span returns the source range covered by the token.
+func (t *Token) Span() Span {
+	return Span{Start: t.Start, End: t.End}
 }
 
-func TokenError(t *Token, message string) string {
-	if t.Type == EOF {
-		return errors.Report(t.Line, " at end", message)
-	} else {
-		return errors.Report(t.Line, " at '"+t.Lexeme+"'", message)
-	}
+func (t *Token) String() string {
+	return fmt.Sprintf("%v %v %v", t.Type, t.Lexeme, t.Literal)
 }
@@ -17,31 +17,56 @@ const (
 	SEMICOLON     TokenType = ";"
 	SLASH         TokenType = "/"
 	STAR          TokenType = "*"
+	PERCENT       TokenType = "%"
+	AMPERSAND     TokenType = "&"
+	PIPE          TokenType = "|"
+	CARET         TokenType = "^"
 	COLON         TokenType = ":"
+	QUESTION      TokenType = "?"
 
 	// One or two character tokens.
-	BANG          TokenType = "!"
-	BANG_EQUAL    TokenType = "!="
-	EQUAL         TokenType = "="
-	EQUAL_EQUAL   TokenType = "=="
-	GREATER       TokenType = ">"
-	GREATER_EQUAL TokenType = ">="
-	LESS          TokenType = "<"
-	LESS_EQUAL    TokenType = "<="
+	BANG              TokenType = "!"
+	BANG_EQUAL        TokenType = "!="
+	EQUAL             TokenType = "="
+	EQUAL_EQUAL       TokenType = "=="
+	GREATER           TokenType = ">"
+	GREATER_EQUAL     TokenType = ">="
+	LESS              TokenType = "<"
+	LESS_EQUAL        TokenType = "<="
+	PLUS_EQUAL        TokenType = "+="
+	MINUS_EQUAL       TokenType = "-="
+	STAR_EQUAL        TokenType = "*="
+	SLASH_EQUAL       TokenType = "/="
+	PERCENT_EQUAL     TokenType = "%="
+	PLUS_PLUS         TokenType = "++"
+	MINUS_MINUS       TokenType = "--"
+	STAR_STAR         TokenType = "**"
+	TILDE             TokenType = "~"
+	TILDE_SLASH       TokenType = "~/" // integer division; "//" always starts a comment
+	LESS_LESS         TokenType = "<<"
+	GREATER_GREATER   TokenType = ">>"
+	QUESTION_QUESTION TokenType = "??"
+	QUESTION_BRACKET  TokenType = "?[" // optional index, only when '?' directly follows its operand
 
 	// Literals.
 	IDENTIFIER TokenType = "IDENTIFIER"
 	STRING     TokenType = "STRING"
-	NUMBER     TokenType = "NUMBER"
+	// INTERPOLATION is the part of a string before an embedded expression,
+	// "a ${...", or between two, "}...${". The last part is a STRING.
+	INTERPOLATION TokenType = "INTERPOLATION"
+	NUMBER        TokenType = "NUMBER"
 
 	// Keywords.
 	AND      TokenType = "AND"
+	BREAK    TokenType = "BREAK"
+	CONTINUE TokenType = "CONTINUE"
 	STRUCT   TokenType = "STRUCT"
 	ELSE     TokenType = "ELSE"
 	FALSE    TokenType = "FALSE"
 	FUNCTION TokenType = "FN"
 	FOR      TokenType = "FOR"
 	IF       TokenType = "IF"
+	IN       TokenType = "IN"
 	NIL      TokenType = "NIL"
 	OR       TokenType = "OR"
 	PRINT    TokenType = "PRINT"
@@ -52,24 +77,39 @@ const (
 	LET      TokenType = "LET"
 	WHILE    TokenType = "WHILE"
 
+	// Comments. A DOC_COMMENT, "///", documents the declaration after it.
+	// COMMENT and WHITESPACE are trivia, only scanned for tools that need
+	// every character of the source.
+	COMMENT     TokenType = "COMMENT"
+	DOC_COMMENT TokenType = "DOC_COMMENT"
+	WHITESPACE  TokenType = "WHITESPACE"
+
 	EOF     TokenType = "EOF"
 	ILLEGAL TokenType = "ILLEGAL"
 )
 
+// IsTrivia reports whether tokens of type t have no meaning to the parser.
+func (t TokenType) IsTrivia() bool {
+	return t == COMMENT || t == WHITESPACE
+}
+
 var Keywords = map[string]TokenType{
-	"and":    AND,
-	"struct": STRUCT,
-	"else":   ELSE,
-	"false":  FALSE,
-	"for":    FOR,
-	"fn":     FUNCTION,
-	"if":     IF,
-	"let":    LET,
-	"nil":    NIL,
-	"or":     OR,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"while":  WHILE,
+	"and":      AND,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"struct":   STRUCT,
+	"else":     ELSE,
+	"false":    FALSE,
+	"for":      FOR,
+	"fn":       FUNCTION,
+	"if":       IF,
+	"in":       IN,
+	"let":      LET,
+	"nil":      NIL,
+	"or":       OR,
+	"return":   RETURN,
+	"super":    SUPER,
+	"this":     THIS,
+	"true":     TRUE,
+	"while":    WHILE,
 }
@@ -0,0 +1,24 @@
+package vm
+
+import (
+	"go-compiler/main/code"
+	"go-compiler/main/object"
+)
+
+// Frame is the activation of one closure: where it is in its instructions
+// and where its arguments and locals start on the stack.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+	instance    *object.Instance // set while init runs for a call to its struct
+	loops       []int            // stack height at the start of each loop running in the frame
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: 0, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,609 @@
+package vm
+
+import (
+	"fmt"
+	"go-compiler/main/code"
+	"go-compiler/main/compiler"
+	"go-compiler/main/errors"
+	"go-compiler/main/object"
+	"go-compiler/main/token"
+)
+
+const (
+	StackSize   = 2048
+	GlobalsSize = 1 << 16
+	MaxFrames   = 1024
+)
+
+// Builtins resolves the global names a program uses without defining them,
+// such as the standard builtins and functions registered by a host.
+// *object.Environment satisfies it.
+type Builtins interface {
+	Get(name string) (object.Object, bool)
+}
+
+var binaryOperators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpMod:         "%",
+	code.OpIntDiv:      "~/",
+	code.OpPow:         "**",
+	code.OpBitAnd:      "&",
+	code.OpBitOr:       "|",
+	code.OpBitXor:      "^",
+	code.OpShiftLeft:   "<<",
+	code.OpShiftRight:  ">>",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+	builtins    Builtins
+
+	stack []object.Object
+	sp    int // stack[sp-1] is the top of the stack
+
+	frames      []*Frame
+	framesIndex int
+
+	// openUpvalues are the upvalues still pointing into the stack, ordered
+	// by slot.
+	openUpvalues []*object.Upvalue
+
+	main *object.Closure
+}
+
+func New(bytecode *compiler.Bytecode, builtins Builtins) *VM {
+	return NewWithGlobals(bytecode, builtins, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobals returns a VM that runs bytecode against globals, which
+// persist after the run so a REPL can keep them between lines.
+func NewWithGlobals(bytecode *compiler.Bytecode, builtins Builtins, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Spans:        bytecode.Spans,
+		NumLocals:    bytecode.NumLocals,
+	}
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     globals,
+		globalNames: bytecode.Globals,
+		builtins:    builtins,
+		stack:       make([]object.Object, StackSize),
+		frames:      make([]*Frame, MaxFrames),
+		main:        &object.Closure{Fn: mainFn},
+	}
+}
+
+// Run executes the program and returns the value of its last statement, or
+// nil if that statement was a declaration. A runtime failure is returned as
+// an *errors.Diagnostic.
+func (vm *VM) Run() (object.Object, error) {
+	return vm.Call(vm.main)
+}
+
+// Call calls fn with args the way a call expression in a script would.
+func (vm *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	base := vm.framesIndex
+	if err := vm.push(fn); err != nil {
+		return nil, err.Diagnostic()
+	}
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return nil, err.Diagnostic()
+		}
+	}
+	if err := vm.callValue(len(args)); err != nil {
+		return nil, err.Diagnostic()
+	}
+	if vm.framesIndex == base {
+		// A builtin, or a struct without an init method, has already left
+		// its result on the stack.
+		return vm.pop(), nil
+	}
+	result, err := vm.run(base)
+	if err != nil {
+		return nil, err.Diagnostic()
+	}
+	return result, nil
+}
+
+// run executes instructions until the frame above base returns, and returns
+// its result.
+func (vm *VM) run(base int) (object.Object, *object.Error) {
+	for {
+		frame := vm.currentFrame()
+		ins := frame.Instructions()
+		op := code.Opcode(ins[frame.ip])
+		frame.ip++
+
+		var err *object.Error
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpDup:
+			n := int(code.ReadUint8(ins[frame.ip:]))
+			frame.ip++
+			for _, value := range vm.stack[vm.sp-n : vm.sp] {
+				if err = vm.push(value); err != nil {
+					break
+				}
+			}
+
+		case code.OpTrue:
+			err = vm.push(object.TRUE)
+
+		case code.OpFalse:
+			err = vm.push(object.FALSE)
+
+		case code.OpNull:
+			err = vm.push(object.NULL)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpIntDiv, code.OpPow, code.OpBitAnd, code.OpBitOr, code.OpBitXor,
+			code.OpShiftLeft, code.OpShiftRight,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(object.Binary(binaryOperators[op], left, right))
+
+		case code.OpMinus:
+			err = vm.pushResult(object.Unary("-", vm.pop()))
+
+		case code.OpBang:
+			err = vm.pushResult(object.Unary("!", vm.pop()))
+
+		case code.OpBitNot:
+			err = vm.pushResult(object.Unary("~", vm.pop()))
+
+		case code.OpIncrement:
+			err = vm.pushResult(object.Unary("++", vm.pop()))
+
+		case code.OpDecrement:
+			err = vm.pushResult(object.Unary("--", vm.pop()))
+
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[frame.ip:]))
+
+		case code.OpJumpFalsy, code.OpJumpTruthy:
+			// Unlike OpJumpNotTruthy these leave the value they test on
+			// the stack.
+			pos := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			if object.IsTruthy(vm.stack[vm.sp-1]) == (op == code.OpJumpTruthy) {
+				frame.ip = pos
+			}
+
+		case code.OpJumpNull, code.OpJumpNotNull:
+			// Like OpJumpFalsy, these leave the value they test.
+			pos := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			if (vm.stack[vm.sp-1] == object.NULL) == (op == code.OpJumpNull) {
+				frame.ip = pos
+			}
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			if !object.IsTruthy(vm.pop()) {
+				frame.ip = pos
+			}
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.pushGlobal(int(globalIndex))
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			vm.globals[globalIndex] = vm.stack[vm.sp-1]
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[frame.ip:])
+			frame.ip++
+			err = vm.push(vm.stack[frame.basePointer+int(localIndex)])
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[frame.ip:])
+			frame.ip++
+			vm.stack[frame.basePointer+int(localIndex)] = vm.stack[vm.sp-1]
+
+		case code.OpGetUpvalue:
+			upvalueIndex := code.ReadUint8(ins[frame.ip:])
+			frame.ip++
+			err = vm.push(*frame.cl.Upvalues[upvalueIndex].Value)
+
+		case code.OpSetUpvalue:
+			upvalueIndex := code.ReadUint8(ins[frame.ip:])
+			frame.ip++
+			*frame.cl.Upvalues[upvalueIndex].Value = vm.stack[vm.sp-1]
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+			err = vm.push(&object.Array{Elements: elements})
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			err = vm.buildHash(numElements)
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(object.Index(left, index))
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(object.SetIndex(left, index, value))
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.pushClosure(int(constIndex))
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[frame.ip:])
+			frame.ip++
+			err = vm.callValue(int(numArgs))
+
+		case code.OpStruct:
+			constIndex := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.buildStruct(int(constIndex))
+
+		case code.OpMethod:
+			nameIndex := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			method := vm.pop()
+			s := vm.stack[vm.sp-1].(*object.Struct)
+			s.Methods[vm.name(nameIndex)] = method
+
+		case code.OpInherit:
+			superclass := vm.pop()
+			s := vm.stack[vm.sp-1].(*object.Struct)
+			if err = s.Inherit(superclass); err != nil {
+				err = vm.withSpan(err)
+			}
+
+		case code.OpGetSuper:
+			nameIndex := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			this := vm.pop()
+			superclass := vm.pop().(*object.Struct)
+			err = vm.pushResult(object.SuperMethod(superclass, this, vm.name(nameIndex)))
+
+		case code.OpGetProperty:
+			nameIndex := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.pushResult(object.GetProperty(vm.pop(), vm.name(nameIndex)))
+
+		case code.OpSetProperty:
+			nameIndex := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			value := vm.pop()
+			target := vm.pop()
+			err = vm.pushResult(object.SetProperty(target, vm.name(nameIndex), value))
+
+		case code.OpCloseUpvalues:
+			slot := int(code.ReadUint8(ins[frame.ip:]))
+			frame.ip++
+			vm.closeUpvalues(frame.basePointer + slot)
+
+		case code.OpIterator:
+			err = vm.pushResult(object.Iterate(vm.pop()))
+
+		case code.OpIterNext:
+			exit := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			if value, ok := vm.stack[vm.sp-1].(*object.Iterator).Next(); ok {
+				err = vm.push(value)
+			} else {
+				frame.ip = exit
+			}
+
+		case code.OpEnterLoop:
+			frame.loops = append(frame.loops, vm.sp)
+
+		case code.OpLeaveLoop:
+			frame.loops = frame.loops[:len(frame.loops)-1]
+
+		case code.OpLoopJump:
+			// break and continue discard what the loop's body left on
+			// the stack before jumping.
+			vm.sp = frame.loops[len(frame.loops)-1]
+			frame.ip = int(code.ReadUint16(ins[frame.ip:]))
+
+		case code.OpReturnValue, code.OpReturn:
+			var returnValue object.Object
+			if op == code.OpReturnValue {
+				returnValue = vm.pop()
+			}
+			if frame.instance != nil {
+				// A call to a struct returns the new instance, whatever
+				// its init method returns.
+				returnValue = frame.instance
+			}
+			vm.closeUpvalues(frame.basePointer)
+			vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			if vm.framesIndex == base {
+				return returnValue, nil
+			}
+			if returnValue == nil {
+				returnValue = object.NULL
+			}
+			err = vm.push(returnValue)
+
+		default:
+			err = vm.errorf(errors.CodeRuntime, "unknown opcode %d", op)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (vm *VM) pushGlobal(index int) *object.Error {
+	if value := vm.globals[index]; value != nil {
+		return vm.push(value)
+	}
+	name := vm.globalNames[index]
+	if vm.builtins != nil {
+		if builtin, ok := vm.builtins.Get(name); ok {
+			return vm.push(builtin)
+		}
+	}
+	return vm.errorf(errors.CodeUndefined, "identifier not found: %s", name)
+}
+
+func (vm *VM) buildHash(numElements int) *object.Error {
+	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+	for i := vm.sp - numElements; i < vm.sp; i += 2 {
+		if err := hash.SetPair(vm.stack[i], vm.stack[i+1]); err != nil {
+			return vm.withSpan(err)
+		}
+	}
+	vm.sp -= numElements
+	return vm.push(hash)
+}
+
+// buildStruct creates a struct from the template constant, taking the field
+// defaults from the stack.
+func (vm *VM) buildStruct(constIndex int) *object.Error {
+	template := vm.constants[constIndex].(*object.Struct)
+	numFields := len(template.Fields)
+	s := &object.Struct{
+		Name:    template.Name,
+		Fields:  make([]object.Field, numFields),
+		Methods: make(map[string]object.Object),
+	}
+	for i, f := range template.Fields {
+		s.Fields[i] = object.Field{Name: f.Name, Default: vm.stack[vm.sp-numFields+i]}
+	}
+	vm.sp -= numFields
+	return vm.push(s)
+}
+
+// name returns the string constant at index.
+func (vm *VM) name(index uint16) string {
+	return vm.constants[index].(*object.String).Value
+}
+
+func (vm *VM) pushClosure(constIndex int) *object.Error {
+	fn, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return vm.errorf(errors.CodeRuntime, "not a function: %+v", vm.constants[constIndex])
+	}
+
+	frame := vm.currentFrame()
+	upvalues := make([]*object.Upvalue, len(fn.Upvalues))
+	for i, ref := range fn.Upvalues {
+		if ref.IsLocal {
+			upvalues[i] = vm.captureUpvalue(frame.basePointer + ref.Index)
+		} else {
+			upvalues[i] = frame.cl.Upvalues[ref.Index]
+		}
+	}
+	return vm.push(&object.Closure{Fn: fn, Upvalues: upvalues})
+}
+
+// captureUpvalue returns the upvalue for the stack slot, reusing an open one
+// so closures capturing the same variable share it.
+func (vm *VM) captureUpvalue(slot int) *object.Upvalue {
+	i := len(vm.openUpvalues)
+	for i > 0 && vm.openUpvalues[i-1].Slot >= slot {
+		if vm.openUpvalues[i-1].Slot == slot {
+			return vm.openUpvalues[i-1]
+		}
+		i--
+	}
+
+	upvalue := &object.Upvalue{Value: &vm.stack[slot], Slot: slot}
+	vm.openUpvalues = append(vm.openUpvalues, nil)
+	copy(vm.openUpvalues[i+1:], vm.openUpvalues[i:])
+	vm.openUpvalues[i] = upvalue
+	return upvalue
+}
+
+// closeUpvalues closes the open upvalues of every slot from slot up.
+func (vm *VM) closeUpvalues(slot int) {
+	i := len(vm.openUpvalues)
+	for i > 0 && vm.openUpvalues[i-1].Slot >= slot {
+		vm.openUpvalues[i-1].Close()
+		i--
+	}
+	vm.openUpvalues = vm.openUpvalues[:i]
+}
+
+// callValue calls the function below the numArgs arguments on top of the
+// stack.
+func (vm *VM) callValue(numArgs int) *object.Error {
+	switch callee := vm.stack[vm.sp-1-numArgs].(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.BoundMethod:
+		return vm.callMethod(callee.Method, callee.Receiver, numArgs)
+	case *object.Struct:
+		return vm.callStruct(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return vm.errorf(errors.CodeNotCallable, "not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	if numArgs != cl.Fn.NumParameters {
+		return vm.errorf(errors.CodeRuntime, "wrong number of arguments. got=%d, want=%d",
+			numArgs, cl.Fn.NumParameters)
+	}
+	if vm.framesIndex >= MaxFrames {
+		return vm.errorf(errors.CodeStackOverflow, "stack overflow")
+	}
+
+	basePointer := vm.sp - numArgs
+	if basePointer+cl.Fn.NumLocals >= StackSize {
+		return vm.errorf(errors.CodeStackOverflow, "stack overflow")
+	}
+	// Locals are null until the function assigns them.
+	for i := vm.sp; i < basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = object.NULL
+	}
+	vm.pushFrame(NewFrame(cl, basePointer))
+	vm.sp = basePointer + cl.Fn.NumLocals
+	return nil
+}
+
+// callMethod calls method with receiver as this. The receiver is passed as a
+// hidden first argument, so the arguments move up a slot to make room for it.
+func (vm *VM) callMethod(method object.Object, receiver *object.Instance, numArgs int) *object.Error {
+	cl := method.(*object.Closure)
+	if numArgs != cl.Fn.NumParameters-1 {
+		return vm.errorf(errors.CodeRuntime, "wrong number of arguments. got=%d, want=%d",
+			numArgs, cl.Fn.NumParameters-1)
+	}
+	if err := vm.push(nil); err != nil {
+		return err
+	}
+	args := vm.sp - 1 - numArgs
+	copy(vm.stack[args+1:vm.sp], vm.stack[args:vm.sp-1])
+	vm.stack[args] = receiver
+	return vm.callClosure(cl, numArgs+1)
+}
+
+// callStruct creates an instance of s, running its init method with the
+// arguments if it has one.
+func (vm *VM) callStruct(s *object.Struct, numArgs int) *object.Error {
+	instance := object.NewInstance(s)
+	if init, ok := s.Method("init"); ok {
+		if err := vm.callMethod(init, instance, numArgs); err != nil {
+			return err
+		}
+		vm.currentFrame().instance = instance
+		return nil
+	}
+	if err := instance.SetFields(vm.stack[vm.sp-numArgs : vm.sp]); err != nil {
+		return vm.withSpan(err)
+	}
+	vm.sp = vm.sp - numArgs - 1
+	return vm.push(instance)
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) *object.Error {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+	if err, ok := result.(*object.Error); ok {
+		if err.Code == "" {
+			err.Code = errors.CodeBuiltin
+		}
+		return vm.withSpan(err)
+	}
+	if result == nil {
+		result = object.NULL
+	}
+	return vm.push(result)
+}
+
+// pushResult pushes the result of an operator, or returns it if it failed.
+func (vm *VM) pushResult(result object.Object) *object.Error {
+	if err, ok := result.(*object.Error); ok {
+		return vm.withSpan(err)
+	}
+	return vm.push(result)
+}
+
+func (vm *VM) push(o object.Object) *object.Error {
+	if vm.sp >= StackSize {
+		return vm.errorf(errors.CodeStackOverflow, "stack overflow")
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// span returns the span of the instruction being executed.
+func (vm *VM) span() token.Span {
+	if vm.framesIndex == 0 {
+		return token.Span{}
+	}
+	frame := vm.currentFrame()
+	return frame.cl.Fn.Spans.Lookup(frame.ip - 1)
+}
+
+// withSpan attaches the span of the instruction being executed to err if it
+// lacks one.
+func (vm *VM) withSpan(err *object.Error) *object.Error {
+	if err.Span == (token.Span{}) {
+		err.Span = vm.span()
+	}
+	return err
+}
+
+func (vm *VM) errorf(code string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Code: code, Span: vm.span()}
+}
@@ -0,0 +1,152 @@
+package vm
+
+import (
+	"go-compiler/main/compiler"
+	"go-compiler/main/errors"
+	"go-compiler/main/object"
+	"go-compiler/main/parser"
+	"go-compiler/main/scanner"
+	"testing"
+)
+
+// The language's behaviour is covered by the conformance suite in the
+// evaluator package, which runs on both engines. These tests cover what is
+// particular to the VM.
+
+func TestUpvaluesOutliveTheirFrame(t *testing.T) {
+	input := `
+let make = fn() {
+  let n = 0;
+  let inc = fn() { n = n + 1 };
+  let get = fn() { n };
+  [inc, get];
+};
+let fns = make();
+let inc = fns[0];
+let get = fns[1];
+inc(); inc(); inc();
+get();`
+	result, err := run(t, input, nil)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testIntegerObject(t, result, 3)
+}
+
+func TestCall(t *testing.T) {
+	bytecode := compile(t, "let add = fn(a, b) { a + b };")
+	globals := make([]object.Object, GlobalsSize)
+	if _, err := NewWithGlobals(bytecode, nil, globals).Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	add := globals[0]
+	result, err := New(bytecode, nil).Call(add, &object.Integer{Value: 2}, &object.Integer{Value: 3})
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testIntegerObject(t, result, 5)
+
+	_, err = New(bytecode, nil).Call(add, &object.Integer{Value: 2})
+	if err == nil || err.(*errors.Diagnostic).Message != "wrong number of arguments. got=1, want=2" {
+		t.Errorf("expected arity error, got=%v", err)
+	}
+}
+
+func TestCallStructsAndMethods(t *testing.T) {
+	bytecode := compile(t, "struct P { x; fn add(n) { this.x + n } }; let p = P(2);")
+	globals := make([]object.Object, GlobalsSize)
+	if _, err := NewWithGlobals(bytecode, nil, globals).Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	add := object.GetProperty(globals[1], "add")
+	result, err := New(bytecode, nil).Call(add, &object.Integer{Value: 3})
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testIntegerObject(t, result, 5)
+
+	result, err = New(bytecode, nil).Call(globals[0], &object.Integer{Value: 7})
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	instance, ok := result.(*object.Instance)
+	if !ok {
+		t.Fatalf("result is not an instance. got=%T", result)
+	}
+	testIntegerObject(t, instance.Fields["x"], 7)
+}
+
+func TestBuiltinsAreResolvedAtRunTime(t *testing.T) {
+	builtins := object.NewEnvironment(nil)
+	builtins.Set("double", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return object.NewError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}})
+
+	result, err := run(t, "double(21)", builtins)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testIntegerObject(t, result, 42)
+
+	_, err = run(t, "let x = 1;\ndouble()", builtins)
+	d, ok := err.(*errors.Diagnostic)
+	if !ok {
+		t.Fatalf("expected *errors.Diagnostic, got=%T (%v)", err, err)
+	}
+	if d.Code != errors.CodeBuiltin || d.Span.Start.Line != 2 || d.Span.Start.Column != 1 {
+		t.Errorf("builtin error has wrong code or span. got=%s %v", d.Code, d.Span)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	_, err := run(t, "let f = fn(n) { f(n + 1) + 1 }; f(0);", nil)
+	d, ok := err.(*errors.Diagnostic)
+	if !ok {
+		t.Fatalf("expected *errors.Diagnostic, got=%T (%v)", err, err)
+	}
+	if d.Code != errors.CodeStackOverflow {
+		t.Errorf("wrong error. got=%s %s", d.Code, d.Message)
+	}
+}
+
+func TestDeclarationsProduceNoResult(t *testing.T) {
+	result, err := run(t, "let a = 1;", nil)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if result != nil {
+		t.Errorf("expected no result, got=%s", result.Inspect())
+	}
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+	tokens := scanner.NewScanner(input).ScanTokens()
+	program := parser.NewParser(tokens).Parse()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func run(t *testing.T, input string, builtins Builtins) (object.Object, error) {
+	t.Helper()
+	return New(compile(t, input), builtins).Run()
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) {
+	t.Helper()
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Fatalf("object is not Integer. got=%T (%+v)", obj, obj)
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+}